@@ -5,18 +5,40 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 
+	"github.com/alextreichler/crochetbyjuliette/internal/auth"
+	"github.com/alextreichler/crochetbyjuliette/internal/config"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
 	"github.com/alextreichler/crochetbyjuliette/internal/store"
-	"golang.org/x/crypto/bcrypt"
 )
 
+const usage = "expected 'add-user', 'reset-password', 'disable-2fa' or 'extract-messages' subcommand"
+
 func main() {
 	addUserCmd := flag.NewFlagSet("add-user", flag.ExitOnError)
 	username := addUserCmd.String("username", "", "Username for the new user")
 	password := addUserCmd.String("password", "", "Password for the new user")
+	role := addUserCmd.String("role", models.RoleOwner, "Role for the new user (owner, staff, read_only)")
+
+	resetPasswordCmd := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	resetUsername := resetPasswordCmd.String("username", "", "Username whose password should be reset")
+	resetPassword := resetPasswordCmd.String("password", "", "New password")
+
+	disable2FACmd := flag.NewFlagSet("disable-2fa", flag.ExitOnError)
+	disable2FAUsername := disable2FACmd.String("username", "", "Username to turn two-factor authentication off for")
+
+	extractCmd := flag.NewFlagSet("extract-messages", flag.ExitOnError)
+	localesDir := extractCmd.String("locales", "locales", "Directory holding the message catalogs")
+	templatesDir := extractCmd.String("templates", "templates", "Directory holding the page templates")
+	sourceDir := extractCmd.String("source", "internal", "Directory holding the Go code")
+	newLang := extractCmd.String("lang", "", "Start a catalog for a new language, e.g. de")
+	write := extractCmd.Bool("write", false, "Add the missing messages to the catalogs, untranslated")
 
 	if len(os.Args) < 2 {
-		fmt.Println("expected 'add-user' subcommand")
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 
@@ -28,14 +50,48 @@ func main() {
 			addUserCmd.PrintDefaults()
 			os.Exit(1)
 		}
-		createUser(*username, *password)
+		if !models.ValidRole(*role) {
+			fmt.Printf("invalid role %q\n", *role)
+			addUserCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		checkPasswordPolicy(*password)
+		createUser(*username, *password, *role)
+	case "reset-password":
+		resetPasswordCmd.Parse(os.Args[2:])
+		if *resetUsername == "" || *resetPassword == "" {
+			fmt.Println("username and password are required")
+			resetPasswordCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		checkPasswordPolicy(*resetPassword)
+		resetUserPassword(*resetUsername, *resetPassword)
+	case "disable-2fa":
+		disable2FACmd.Parse(os.Args[2:])
+		if *disable2FAUsername == "" {
+			fmt.Println("username is required")
+			disable2FACmd.PrintDefaults()
+			os.Exit(1)
+		}
+		disableTwoFactor(*disable2FAUsername)
+	case "extract-messages":
+		extractCmd.Parse(os.Args[2:])
+		extractMessages(*localesDir, *templatesDir, *sourceDir, *newLang, *write)
 	default:
-		fmt.Println("expected 'add-user' subcommand")
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+}
+
+// checkPasswordPolicy enforces the same PASSWORD_* rules as the web UI.
+func checkPasswordPolicy(password string) {
+	if err := config.LoadPasswordPolicy().Validate(password); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
-func createUser(username, password string) {
+func openStore() *store.Store {
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
 		dbPath = "./crochet.db"
@@ -49,16 +105,149 @@ func createUser(username, password string) {
 	if err := db.Migrate("migrations"); err != nil {
 		log.Fatalf("Failed to init schema: %v", err)
 	}
+	return db
+}
+
+func createUser(username, password, role string) {
+	db := openStore()
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := auth.HashPassword(password)
 	if err != nil {
 		log.Fatalf("Failed to hash password: %v", err)
 	}
 
-	err = db.CreateUser(username, string(hashedPassword))
+	err = db.CreateUser(username, hashedPassword, role)
 	if err != nil {
 		log.Fatalf("Failed to create user: %v", err)
 	}
 
-	fmt.Printf("User '%s' created successfully.\n", username)
+	fmt.Printf("User '%s' (%s) created successfully.\n", username, role)
+}
+
+func resetUserPassword(username, password string) {
+	db := openStore()
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		log.Fatalf("Failed to look up user: %v", err)
+	}
+	if user == nil {
+		log.Fatalf("User '%s' not found", username)
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+
+	if err := db.UpdateUserPassword(user.ID, hashedPassword); err != nil {
+		log.Fatalf("Failed to update password: %v", err)
+	}
+	// As when the password is changed on the site, log the user out
+	// everywhere, in case someone else had got in. Revoking needs no keys.
+	revoked, err := db.NewSessionStore(0, 0).RevokeUserSessions(user.ID, "")
+	if err != nil {
+		log.Fatalf("Password reset, but failed to revoke sessions: %v", err)
+	}
+
+	fmt.Printf("Password for '%s' reset successfully; %d session(s) logged out.\n", username, revoked)
+}
+
+// disableTwoFactor is the escape hatch for an admin who lost their
+// authenticator app and recovery codes.
+func disableTwoFactor(username string) {
+	db := openStore()
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		log.Fatalf("Failed to look up user: %v", err)
+	}
+	if user == nil {
+		log.Fatalf("User '%s' not found", username)
+	}
+
+	if err := db.DisableTOTP(user.ID); err != nil {
+		log.Fatalf("Failed to disable two-factor authentication: %v", err)
+	}
+
+	fmt.Printf("Two-factor authentication disabled for '%s'.\n", username)
+}
+
+// extractMessages lists, per catalog, the messages the templates and code use
+// that the catalog lacks, and those it has that nothing uses any more. With
+// write, the missing ones are added with empty translations for a translator
+// to fill in; unused ones are kept, in case they come back.
+func extractMessages(localesDir, templatesDir, sourceDir, newLang string, write bool) {
+	messages, err := i18n.Extract(templatesDir, sourceDir)
+	if err != nil {
+		log.Fatalf("Failed to extract messages: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(localesDir, "*.json"))
+	if err != nil {
+		log.Fatalf("Failed to list catalogs: %v", err)
+	}
+	if newLang != "" {
+		path := filepath.Join(localesDir, newLang+".json")
+		if _, err := os.Stat(path); err == nil {
+			log.Fatalf("There is already a catalog for %s", newLang)
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		fmt.Printf("No catalogs in %s; start one with -lang.\n", localesDir)
+		return
+	}
+
+	for _, path := range paths {
+		catalog, err := i18n.ReadCatalog(path)
+		if os.IsNotExist(err) {
+			catalog = i18n.Catalog{}
+		} else if err != nil {
+			log.Fatalf("Failed to read catalog: %v", err)
+		}
+
+		used := make(map[string]bool, len(messages))
+		var missing []string
+		for _, m := range messages {
+			used[m] = true
+			if _, ok := catalog[m]; !ok {
+				missing = append(missing, m)
+			}
+		}
+		untranslated := 0
+		for m, t := range catalog {
+			if used[m] && t == "" {
+				untranslated++
+			}
+		}
+
+		fmt.Printf("%s: %d missing, %d untranslated\n", path, len(missing), untranslated)
+		for _, m := range missing {
+			fmt.Printf("  + %q\n", m)
+		}
+		var unused []string
+		for m := range catalog {
+			if !used[m] {
+				unused = append(unused, m)
+			}
+		}
+		sort.Strings(unused)
+		for _, m := range unused {
+			fmt.Printf("  unused %q\n", m)
+		}
+
+		if write && len(missing) > 0 {
+			for _, m := range missing {
+				catalog[m] = ""
+			}
+			if err := os.MkdirAll(localesDir, 0o755); err != nil {
+				log.Fatalf("Failed to create %s: %v", localesDir, err)
+			}
+			if err := i18n.WriteCatalog(path, catalog); err != nil {
+				log.Fatalf("Failed to write catalog: %v", err)
+			}
+			fmt.Printf("Added %d messages to %s.\n", len(missing), path)
+		}
+	}
 }
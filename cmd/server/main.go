@@ -9,11 +9,20 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+	"github.com/alextreichler/crochetbyjuliette/internal/antispam"
 	"github.com/alextreichler/crochetbyjuliette/internal/config"
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+	"github.com/alextreichler/crochetbyjuliette/internal/discount"
 	"github.com/alextreichler/crochetbyjuliette/internal/handlers"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+	"github.com/alextreichler/crochetbyjuliette/internal/invoice"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/payments"
+	"github.com/alextreichler/crochetbyjuliette/internal/shipping"
 	"github.com/alextreichler/crochetbyjuliette/internal/store"
+	"github.com/alextreichler/crochetbyjuliette/internal/tax"
 	"github.com/gorilla/csrf"
-	"github.com/gorilla/sessions"
 )
 
 func main() {
@@ -46,8 +55,46 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Order links used to be stored in plaintext
+	if n, err := db.HashLegacyOrderTokens(); err != nil {
+		slog.Error("Failed to hash legacy order links", "error", err)
+		os.Exit(1)
+	} else if n > 0 {
+		slog.Info("Hashed legacy order links", "count", n)
+	}
+
+	// Email lookup keys can't be computed in a SQL migration
+	if n, err := db.BackfillEmailKeys(); err != nil {
+		slog.Error("Failed to backfill email keys", "error", err)
+		os.Exit(1)
+	} else if n > 0 {
+		slog.Info("Backfilled email keys", "count", n)
+	}
+
+	// Behind a reverse proxy, client addresses come from its headers
+	if err := handlers.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		slog.Error("Invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	if _, ok := address.Lookup(cfg.DefaultCountry); !ok {
+		slog.Error("Unsupported DEFAULT_COUNTRY", "country", cfg.DefaultCountry)
+		os.Exit(1)
+	}
+	address.DefaultCountry = cfg.DefaultCountry
+	if _, ok := address.Lookup(cfg.ShopCountry); !ok {
+		slog.Error("Unsupported SHOP_COUNTRY", "country", cfg.ShopCountry)
+		os.Exit(1)
+	}
+	money, err := currency.NewFormatter(cfg.Currency, cfg.Locale)
+	if err != nil {
+		slog.Error("Invalid SHOP_CURRENCY or SHOP_LOCALE", "error", err)
+		os.Exit(1)
+	}
+
 	// 3. Session Setup
-	sessionStore := sessions.NewCookieStore(cfg.SessionKey)
+	// Session data lives in the database; the cookie only carries a signed ID.
+	sessionStore := db.NewSessionStore(cfg.SessionIdleTimeout, cfg.SessionMaxLifetime, cfg.SessionKey)
+	sessionStore.ClientIP = handlers.ClientIP
 	sessionStore.Options.HttpOnly = true
 	sessionStore.Options.Secure = cfg.CookieSecure // Configurable for production
 	sessionStore.Options.SameSite = http.SameSiteLaxMode
@@ -56,33 +103,136 @@ func main() {
 		sessionStore.Options.Domain = cfg.CookieDomain
 	}
 
+	// Expired sessions and tokens are already rejected when used; this keeps
+	// the tables small.
+	go func() {
+		for range time.Tick(time.Hour) {
+			if n, err := sessionStore.PurgeExpiredSessions(); err != nil {
+				slog.Error("Failed to purge expired sessions", "error", err)
+			} else if n > 0 {
+				slog.Info("Purged expired sessions", "count", n)
+			}
+			if n, err := db.PurgeExpiredTokens(); err != nil {
+				slog.Error("Failed to purge expired tokens", "error", err)
+			} else if n > 0 {
+				slog.Info("Purged expired tokens", "count", n)
+			}
+		}
+	}()
+
 	// 3. Init Templates
+	messages, err := i18n.Load("locales", cfg.DefaultLanguage)
+	if err != nil {
+		slog.Error("Failed to load translations", "error", err)
+		os.Exit(1)
+	}
 	templates := handlers.NewTemplateCache()
+	templates.Translate(messages)
 
 	// Add other template funcs (prevPage, nextPage)
 	templates.AddFunc("prevPage", func(currentPage int) int { return currentPage - 1 })
 	templates.AddFunc("nextPage", func(currentPage int) int { return currentPage + 1 })
+	templates.AddFunc("roleLabel", models.RoleLabel)
+	templates.AddFunc("deviceLabel", handlers.DeviceLabel)
+	templates.AddFunc("money", handlers.FormatMoney)
+	templates.AddFunc("price", money.Format)
+	templates.AddFunc("converted", money.Converted)
+	templates.AddFunc("shopCurrency", func() string { return money.Base })
+	templates.AddFunc("shippingKindLabel", shipping.KindLabel)
+	templates.AddFunc("paymentStatusLabel", payments.StatusLabel)
+	templates.AddFunc("taxClassLabel", tax.ClassLabel)
+	templates.AddFunc("discountKindLabel", discount.KindLabel)
+	templates.AddFunc("percent", tax.FormatPercent)
+	templates.AddFunc("pricesIncludeTax", func() bool { return cfg.TaxInclusive })
 
 	if err := templates.Load("templates"); err != nil {
 		slog.Error("Failed to load templates", "error", err)
 		os.Exit(1)
 	}
 
+	// Anti-spam for the public forms
+	spamGuard := antispam.NewGuard(cfg.CSRFKey, cfg.SpamMinFillTime)
+	switch cfg.SpamChallenge {
+	case "":
+	case "pow":
+		spamGuard.Challenge = antispam.NewProofOfWork(cfg.CSRFKey, cfg.SpamPowDifficulty)
+	default:
+		slog.Error("Unknown SPAM_CHALLENGE", "value", cfg.SpamChallenge)
+		os.Exit(1)
+	}
+
+	// Online payments
+	var paymentProvider payments.Provider
+	switch cfg.PaymentProvider {
+	case "":
+	case "stripe":
+		if cfg.StripeSecretKey == "" || cfg.PaymentWebhookSecret == "" {
+			slog.Error("PAYMENT_PROVIDER=stripe needs STRIPE_SECRET_KEY and PAYMENT_WEBHOOK_SECRET")
+			os.Exit(1)
+		}
+		paymentProvider = payments.NewStripe(cfg.StripeSecretKey, cfg.PaymentWebhookSecret)
+	case "fake":
+		slog.Warn("Using the fake payment provider. No real payments are taken.")
+		if cfg.PaymentWebhookSecret == "" {
+			cfg.PaymentWebhookSecret = "fake-webhook-secret"
+		}
+		paymentProvider = payments.NewFake(cfg.BaseURL, cfg.PaymentWebhookSecret)
+	default:
+		slog.Error("Unknown PAYMENT_PROVIDER", "value", cfg.PaymentProvider)
+		os.Exit(1)
+	}
+
 	// 4. Setup Handlers
+	invoicing := handlers.Invoicing{
+		Shop: invoice.Shop{
+			Name:    cfg.ShopName,
+			Address: cfg.ShopAddress,
+			Email:   cfg.ShopEmail,
+			TaxID:   cfg.ShopTaxID,
+		},
+		Money:  money,
+		Prefix: cfg.InvoicePrefix,
+		Attach: cfg.AttachInvoices,
+	}
+	taxSettings := tax.Settings{
+		Inclusive: cfg.TaxInclusive,
+		Country:   cfg.ShopCountry,
+		Region:    cfg.ShopRegion,
+	}
 	adminHandler := &handlers.AdminHandler{
-		Store:        db,
-		SessionStore: sessionStore,
-		Templates:    templates,
+		Store:          db,
+		SessionStore:   sessionStore,
+		Templates:      templates,
+		PasswordPolicy: cfg.PasswordPolicy,
+		LabelsDir:      cfg.LabelsDir,
+		Currency:       cfg.Currency,
+		Invoicing:      invoicing,
+		Tax:            taxSettings,
+		Money:          money,
+		Messages:       messages,
+		BaseURL:        cfg.BaseURL,
 	}
 	homeHandler := &handlers.HomeHandler{
 		Store:        db,
 		Templates:    templates,
 		SessionStore: sessionStore,
+		Money:        money,
+		Messages:     messages,
 	}
 	orderHandler := &handlers.OrderHandler{
-		Store:        db,
-		Templates:    templates,
-		SessionStore: sessionStore,
+		Store:               db,
+		Templates:           templates,
+		SessionStore:        sessionStore,
+		Spam:                spamGuard,
+		OrdersPerEmail:      cfg.OrdersPerEmail,
+		StatusLinksPerEmail: cfg.StatusLinksPerEmail,
+		Payments:            paymentProvider,
+		Currency:            cfg.Currency,
+		BaseURL:             cfg.BaseURL,
+		Invoicing:           invoicing,
+		Tax:                 taxSettings,
+		Money:               money,
+		Messages:            messages,
 	}
 	mux := http.NewServeMux()
 
@@ -90,44 +240,138 @@ func main() {
 	fileServer := http.FileServer(http.Dir("./static"))
 	mux.Handle("/static/", http.StripPrefix("/static", fileServer))
 
-	// Rate Limiter (1 request per minute)
-	rateLimiter := handlers.NewRateLimiter(1 * time.Minute)
+	// Rate Limiting: each group of routes has its own per-IP token bucket
+	rateLimiter := handlers.NewRateLimiter(time.Minute)
+	limit := func(name string) *handlers.RateLimitPolicy {
+		l := cfg.RateLimits[name]
+		return rateLimiter.Policy(name, l.Burst, l.Per)
+	}
+	orderLimit := limit("order")
+	orderManageLimit := limit("order-manage")
+	statusLimit := limit("status")
+	// Login attempts are also throttled per username and IP in the database;
+	// this only stops rapid-fire requests from tying up bcrypt.
+	loginLimit := limit("login")
+	passwordResetLimit := limit("password-reset")
 
 	// Public Routes
 	mux.HandleFunc("/", homeHandler.Index)
-	mux.HandleFunc("/order", orderHandler.OrderForm)                                // GET form
-	mux.HandleFunc("POST /order", rateLimiter.Middleware(orderHandler.SubmitOrder)) // POST submit
+	mux.HandleFunc("/order", orderHandler.OrderForm)                               // GET form
+	mux.HandleFunc("POST /order", orderLimit.Middleware(orderHandler.SubmitOrder)) // POST submit
+	mux.HandleFunc("/shipping/quote", orderHandler.ShippingQuote)                  // Delivery options as JSON, for the order form
 
 	// Order Status (Magic Link)
 	mux.HandleFunc("/status-request", orderHandler.RequestStatusLink) // GET form & POST submit (could split)
-	mux.HandleFunc("POST /status-request", rateLimiter.Middleware(orderHandler.SendStatusLink))
-	mux.HandleFunc("/my-orders", orderHandler.MyOrders)            // List all orders for valid token
-	mux.HandleFunc("/order/status/", orderHandler.ViewOrderStatus) // Trailing slash matches /order/status/{token}
+	mux.HandleFunc("POST /status-request", statusLimit.Middleware(orderHandler.SendStatusLink))
+	mux.HandleFunc("/my-orders", orderHandler.MyOrders)                 // Signs in with ?token=, then lists the customer's orders
+	mux.HandleFunc("/order/status/{token}", orderHandler.OpenOrderLink) // Emailed link; redirects to /orders/{ref}
+	mux.HandleFunc("/orders/{ref}", orderHandler.ViewOrderStatus)
+	mux.HandleFunc("/orders/{ref}/invoice", orderHandler.OrderInvoice) // PDF download
+
+	// Customer Accounts (signed in via the emailed link above)
+	mux.HandleFunc("/account", orderHandler.Account)
+	mux.HandleFunc("POST /account", orderHandler.UpdateAccount)
+	mux.HandleFunc("POST /account/addresses", orderHandler.AddAddress)
+	mux.HandleFunc("POST /account/addresses/delete", orderHandler.DeleteAddress)
+	mux.HandleFunc("POST /account/addresses/default", orderHandler.SetDefaultAddress)
+	mux.HandleFunc("/account/logout", orderHandler.CustomerLogout)
 
 	// Order Management (Edit/Cancel)
-	mux.HandleFunc("/order/edit/", orderHandler.EditOrderForm)
-	mux.HandleFunc("POST /order/update", rateLimiter.Middleware(orderHandler.UpdateOrder))
-	mux.HandleFunc("POST /order/cancel", rateLimiter.Middleware(orderHandler.CancelOrder))
+	mux.HandleFunc("/orders/{ref}/edit", orderHandler.EditOrderForm)
+	mux.HandleFunc("POST /order/update", orderManageLimit.Middleware(orderHandler.UpdateOrder))
+	mux.HandleFunc("POST /order/cancel", orderManageLimit.Middleware(orderHandler.CancelOrder))
+	mux.HandleFunc("POST /order/link/reissue", orderManageLimit.Middleware(orderHandler.ReissueOrderLink))
+	mux.HandleFunc("POST /order/link/revoke", orderHandler.RevokeOrderLink)
+
+	// Online Payments
+	mux.HandleFunc("POST /order/pay", orderManageLimit.Middleware(orderHandler.PayOrder))
+	mux.HandleFunc("POST /payments/webhook", orderHandler.PaymentWebhook) // Called by the provider; signed instead of CSRF-protected
+	if cfg.PaymentProvider == "fake" {
+		mux.HandleFunc("/payments/fake/checkout", orderHandler.FakeCheckout)
+	}
 
 	mux.HandleFunc("/login", adminHandler.LoginGet)
-	mux.HandleFunc("POST /login", adminHandler.LoginPost)
+	mux.HandleFunc("POST /login", loginLimit.Middleware(adminHandler.LoginPost))
+	mux.HandleFunc("/login/2fa", adminHandler.LoginTwoFactorForm)
+	mux.HandleFunc("POST /login/2fa", loginLimit.Middleware(adminHandler.LoginTwoFactor))
 	mux.HandleFunc("/logout", adminHandler.Logout)
 
-	// Protected Routes
-	mux.HandleFunc("/admin", adminHandler.AuthMiddleware(adminHandler.Dashboard))
-	mux.HandleFunc("/admin/orders", adminHandler.AuthMiddleware(adminHandler.ListOrders))
-	mux.HandleFunc("POST /admin/orders/update", adminHandler.AuthMiddleware(adminHandler.UpdateOrderStatus))
-
-	mux.HandleFunc("/admin/items", adminHandler.AuthMiddleware(adminHandler.ListItems))       // List all items
-	mux.HandleFunc("/admin/items/new", adminHandler.AuthMiddleware(adminHandler.AddItemForm)) // GET form
-	mux.HandleFunc("POST /admin/items", adminHandler.AuthMiddleware(adminHandler.CreateItem)) // POST submit
-	mux.HandleFunc("POST /admin/items/delete", adminHandler.AuthMiddleware(adminHandler.DeleteItem))
-	mux.HandleFunc("/admin/items/edit", adminHandler.AuthMiddleware(adminHandler.EditItemForm))      // GET form
-	mux.HandleFunc("POST /admin/items/update", adminHandler.AuthMiddleware(adminHandler.UpdateItem)) // POST submit
+	// Invited admins set their password here
+	mux.HandleFunc("/invite", adminHandler.AcceptInviteForm)
+	mux.HandleFunc("POST /invite", adminHandler.AcceptInvite)
+
+	// Password reset
+	mux.HandleFunc("/forgot-password", adminHandler.ForgotPasswordForm)
+	mux.HandleFunc("POST /forgot-password", passwordResetLimit.Middleware(adminHandler.SendPasswordReset))
+	mux.HandleFunc("/reset-password", adminHandler.ResetPasswordForm)
+	mux.HandleFunc("POST /reset-password", adminHandler.ResetPassword)
+
+	// Protected Routes (each checks the permission its action needs)
+	mux.HandleFunc("/admin", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.Dashboard))
+	mux.HandleFunc("/admin/orders", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ListOrders))
+	mux.HandleFunc("POST /admin/orders/update", adminHandler.RequirePermission(models.PermUpdateOrders, adminHandler.UpdateOrderStatus))
+	mux.HandleFunc("/admin/orders/invoice", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.OrderInvoice))
+	mux.HandleFunc("/admin/shipments/label", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ShipmentLabel))
+	mux.HandleFunc("POST /admin/shipments/delete", adminHandler.RequirePermission(models.PermUpdateOrders, adminHandler.DeleteShipment))
+	mux.HandleFunc("POST /admin/payments", adminHandler.RequirePermission(models.PermUpdateOrders, adminHandler.RecordPayment))
+	mux.HandleFunc("POST /admin/payments/delete", adminHandler.RequirePermission(models.PermUpdateOrders, adminHandler.DeletePayment))
+	mux.HandleFunc("POST /admin/refunds", adminHandler.RequirePermission(models.PermUpdateOrders, adminHandler.RecordRefund))
+	mux.HandleFunc("POST /admin/refunds/delete", adminHandler.RequirePermission(models.PermUpdateOrders, adminHandler.DeleteRefund))
+	mux.HandleFunc("POST /admin/orders/link/reissue", adminHandler.RequirePermission(models.PermUpdateOrders, adminHandler.AdminReissueOrderLink))
+	mux.HandleFunc("POST /admin/orders/link/revoke", adminHandler.RequirePermission(models.PermUpdateOrders, adminHandler.AdminRevokeOrderLink))
+
+	mux.HandleFunc("/admin/items", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ListItems))       // List all items
+	mux.HandleFunc("/admin/items/new", adminHandler.RequirePermission(models.PermEditItems, adminHandler.AddItemForm)) // GET form
+	mux.HandleFunc("POST /admin/items", adminHandler.RequirePermission(models.PermEditItems, adminHandler.CreateItem)) // POST submit
+	mux.HandleFunc("POST /admin/items/delete", adminHandler.RequirePermission(models.PermDeleteItems, adminHandler.DeleteItem))
+	mux.HandleFunc("/admin/items/edit", adminHandler.RequirePermission(models.PermEditItems, adminHandler.EditItemForm))      // GET form
+	mux.HandleFunc("POST /admin/items/update", adminHandler.RequirePermission(models.PermEditItems, adminHandler.UpdateItem)) // POST submit
+
+	mux.HandleFunc("/admin/shipping", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ListShipping))
+	mux.HandleFunc("/admin/shipping/zones/edit", adminHandler.RequirePermission(models.PermEditShipping, adminHandler.ShippingZoneForm)) // GET form; new zone without ?id=
+	mux.HandleFunc("POST /admin/shipping/zones", adminHandler.RequirePermission(models.PermEditShipping, adminHandler.CreateShippingZone))
+	mux.HandleFunc("POST /admin/shipping/zones/update", adminHandler.RequirePermission(models.PermEditShipping, adminHandler.UpdateShippingZone))
+	mux.HandleFunc("POST /admin/shipping/zones/delete", adminHandler.RequirePermission(models.PermEditShipping, adminHandler.DeleteShippingZone))
+	mux.HandleFunc("/admin/shipping/methods/edit", adminHandler.RequirePermission(models.PermEditShipping, adminHandler.ShippingMethodForm)) // GET form; new method without ?id=
+	mux.HandleFunc("POST /admin/shipping/methods", adminHandler.RequirePermission(models.PermEditShipping, adminHandler.CreateShippingMethod))
+	mux.HandleFunc("POST /admin/shipping/methods/update", adminHandler.RequirePermission(models.PermEditShipping, adminHandler.UpdateShippingMethod))
+	mux.HandleFunc("POST /admin/shipping/methods/delete", adminHandler.RequirePermission(models.PermEditShipping, adminHandler.DeleteShippingMethod))
+	mux.HandleFunc("/admin/discounts", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ListDiscounts))
+	mux.HandleFunc("/admin/discounts/edit", adminHandler.RequirePermission(models.PermEditDiscounts, adminHandler.DiscountForm)) // GET form; new code without ?id=
+	mux.HandleFunc("POST /admin/discounts", adminHandler.RequirePermission(models.PermEditDiscounts, adminHandler.CreateDiscount))
+	mux.HandleFunc("POST /admin/discounts/update", adminHandler.RequirePermission(models.PermEditDiscounts, adminHandler.UpdateDiscount))
+	mux.HandleFunc("POST /admin/discounts/delete", adminHandler.RequirePermission(models.PermEditDiscounts, adminHandler.DeleteDiscount))
+	mux.HandleFunc("/admin/currencies", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ListCurrencies))
+	mux.HandleFunc("/admin/currencies/edit", adminHandler.RequirePermission(models.PermEditCurrencies, adminHandler.ExchangeRateForm)) // GET form; new rate without ?currency=
+	mux.HandleFunc("POST /admin/currencies", adminHandler.RequirePermission(models.PermEditCurrencies, adminHandler.CreateExchangeRate))
+	mux.HandleFunc("POST /admin/currencies/update", adminHandler.RequirePermission(models.PermEditCurrencies, adminHandler.UpdateExchangeRate))
+	mux.HandleFunc("POST /admin/currencies/delete", adminHandler.RequirePermission(models.PermEditCurrencies, adminHandler.DeleteExchangeRate))
+	mux.HandleFunc("/admin/tax", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ListTax)) // Rates and the report for ?from= to ?to=
+	mux.HandleFunc("/admin/tax/report.csv", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.TaxReportCSV))
+	mux.HandleFunc("/admin/tax/rates/edit", adminHandler.RequirePermission(models.PermEditTax, adminHandler.TaxRateForm)) // GET form; new rate without ?id=
+	mux.HandleFunc("POST /admin/tax/rates", adminHandler.RequirePermission(models.PermEditTax, adminHandler.CreateTaxRate))
+	mux.HandleFunc("POST /admin/tax/rates/update", adminHandler.RequirePermission(models.PermEditTax, adminHandler.UpdateTaxRate))
+	mux.HandleFunc("POST /admin/tax/rates/delete", adminHandler.RequirePermission(models.PermEditTax, adminHandler.DeleteTaxRate))
+
+	mux.HandleFunc("/admin/users", adminHandler.RequirePermission(models.PermManageUsers, adminHandler.ListUsers))
+	mux.HandleFunc("POST /admin/users/invite", adminHandler.RequirePermission(models.PermManageUsers, adminHandler.InviteUser))
+	mux.HandleFunc("/admin/users/edit", adminHandler.RequirePermission(models.PermManageUsers, adminHandler.EditUserForm))
+	mux.HandleFunc("POST /admin/users/update", adminHandler.RequirePermission(models.PermManageUsers, adminHandler.UpdateUser))
+
+	mux.HandleFunc("/admin/account/password", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ChangePasswordForm))
+	mux.HandleFunc("POST /admin/account/password", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ChangePassword))
+	mux.HandleFunc("/admin/account/2fa", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.TwoFactorSettings))
+	mux.HandleFunc("POST /admin/account/2fa/enable", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.EnableTwoFactor))
+	mux.HandleFunc("POST /admin/account/2fa/disable", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.DisableTwoFactor))
+	mux.HandleFunc("POST /admin/account/2fa/recovery-codes", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.RegenerateRecoveryCodes))
+	mux.HandleFunc("/admin/account/sessions", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.ListSessions))
+	mux.HandleFunc("POST /admin/account/sessions/revoke", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.RevokeSession))
+	mux.HandleFunc("POST /admin/account/sessions/revoke-others", adminHandler.RequirePermission(models.PermViewAdmin, adminHandler.RevokeOtherSessions))
 	// 6. Middleware Setup
 	CSRF := csrf.Protect(
 		cfg.CSRFKey,
 		csrf.Secure(cfg.CookieSecure), // Configurable for production
+		csrf.Path("/"),                // One cookie for the whole site, so forms can post across paths
 		// Fix for "Forbidden - origin invalid": Trust local development origins
 		csrf.TrustedOrigins([]string{"localhost:" + cfg.Port, "127.0.0.1:" + cfg.Port, "localhost", "127.0.0.1"}),
 	)
@@ -136,7 +380,7 @@ func main() {
 	// Chain: Logger -> Security Headers -> CSRF -> Mux
 	handler := handlers.LoggingMiddleware(
 		handlers.SecurityHeadersMiddleware(
-			CSRF(mux),
+			handlers.SkipCSRF([]string{"/payments/webhook"}, CSRF(mux)),
 		),
 	)
 
@@ -172,6 +416,7 @@ func main() {
 		slog.Error("Server shutdown failed", "error", err)
 		os.Exit(1)
 	}
+	rateLimiter.Stop()
 
 	slog.Info("Server exited gracefully.")
 }
@@ -0,0 +1,145 @@
+// Package address holds structured postal addresses and the per-country
+// rules used to validate and format them.
+package address
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultCountry is preselected on address forms.
+var DefaultCountry = "US"
+
+// Address is a postal address. Country is an ISO 3166-1 alpha-2 code.
+type Address struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country"`
+}
+
+// Country describes how addresses are written in one country.
+type Country struct {
+	Code string
+	Name string
+
+	RegionLabel    string // e.g. "State"; empty if addresses have no region
+	RegionRequired bool
+	Regions        map[string]string // Code -> name; when set, Region must be one of them
+
+	PostalLabel    string // e.g. "ZIP code"
+	PostalRequired bool
+	postal         *regexp.Regexp // Matched against the upper-cased code
+
+	// Format lays out everything below the street lines, one line per
+	// entry, using {city}, {region} and {postal}. Empty lines are dropped.
+	Format []string
+}
+
+// IsZero reports whether no field has been filled in.
+func (a Address) IsZero() bool {
+	return a == Address{}
+}
+
+// Normalize trims every field, upper-cases the country and postal code,
+// and replaces a region name with its code where the country has them.
+func (a Address) Normalize() Address {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Region = strings.TrimSpace(a.Region)
+	a.PostalCode = strings.ToUpper(strings.Join(strings.Fields(a.PostalCode), " "))
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+
+	if c, ok := Lookup(a.Country); ok && c.Regions != nil {
+		for code, name := range c.Regions {
+			if strings.EqualFold(a.Region, code) || strings.EqualFold(a.Region, name) {
+				a.Region = code
+				break
+			}
+		}
+	}
+	return a
+}
+
+// Validate checks a normalized address against its country's rules. It
+// returns a message per invalid field, keyed by "name", "line1", "city",
+// "region", "postal_code" or "country"; an empty map means it's valid.
+func (a Address) Validate() map[string]string {
+	errors := make(map[string]string)
+	if a.Name == "" {
+		errors["name"] = "Recipient name is required."
+	}
+	if a.Line1 == "" {
+		errors["line1"] = "Street address is required."
+	}
+	if a.City == "" {
+		errors["city"] = "City is required."
+	}
+
+	c, ok := Lookup(a.Country)
+	if !ok {
+		errors["country"] = "Please choose a country we ship to."
+		return errors
+	}
+
+	if a.Region == "" {
+		if c.RegionRequired {
+			errors["region"] = c.RegionLabel + " is required."
+		}
+	} else if c.Regions != nil {
+		if _, ok := c.Regions[a.Region]; !ok {
+			errors["region"] = "Please enter a valid " + strings.ToLower(c.RegionLabel) + "."
+		}
+	}
+
+	if a.PostalCode == "" {
+		if c.PostalRequired {
+			errors["postal_code"] = c.PostalLabel + " is required."
+		}
+	} else if c.postal != nil && !c.postal.MatchString(a.PostalCode) {
+		errors["postal_code"] = "Please enter a valid " + strings.ToLower(c.PostalLabel) + "."
+	}
+	return errors
+}
+
+// Lines formats the address the way the post office of its country
+// expects, ending with the country name.
+func (a Address) Lines() []string {
+	var lines []string
+	for _, l := range []string{a.Name, a.Line1, a.Line2} {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	c, ok := Lookup(a.Country)
+	if !ok {
+		for _, l := range []string{a.City, a.Region, a.PostalCode, a.Country} {
+			if l != "" {
+				lines = append(lines, l)
+			}
+		}
+		return lines
+	}
+
+	r := strings.NewReplacer("{city}", a.City, "{region}", a.Region, "{postal}", a.PostalCode)
+	for _, format := range c.Format {
+		// Collapse separators left behind by empty fields
+		line := strings.Join(strings.Fields(r.Replace(format)), " ")
+		line = strings.Trim(strings.ReplaceAll(line, " ,", ","), ", ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return append(lines, c.Name)
+}
+
+// String is the address on multiple lines, as on an envelope.
+func (a Address) String() string {
+	return strings.Join(a.Lines(), "\n")
+}
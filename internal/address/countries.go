@@ -0,0 +1,108 @@
+package address
+
+import "regexp"
+
+// Countries lists the countries we ship to, in the order shown on forms.
+var Countries = []Country{
+	{
+		Code: "US", Name: "United States",
+		RegionLabel: "State", RegionRequired: true, Regions: usStates,
+		PostalLabel: "ZIP code", PostalRequired: true, postal: regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+		Format: []string{"{city}, {region} {postal}"},
+	},
+	{
+		Code: "CA", Name: "Canada",
+		RegionLabel: "Province", RegionRequired: true, Regions: caProvinces,
+		PostalLabel: "Postal code", PostalRequired: true, postal: regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+		Format: []string{"{city} {region} {postal}"},
+	},
+	{
+		Code: "GB", Name: "United Kingdom",
+		RegionLabel: "County",
+		PostalLabel: "Postcode", PostalRequired: true, postal: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+		Format: []string{"{city}", "{region}", "{postal}"},
+	},
+	{
+		Code: "IE", Name: "Ireland",
+		RegionLabel: "County",
+		PostalLabel: "Eircode", postal: regexp.MustCompile(`^[A-Z]\d[\dW] ?[\dA-Z]{4}$`),
+		Format: []string{"{city}", "{region}", "{postal}"},
+	},
+	{
+		Code: "AU", Name: "Australia",
+		RegionLabel: "State", RegionRequired: true, Regions: auStates,
+		PostalLabel: "Postcode", PostalRequired: true, postal: regexp.MustCompile(`^\d{4}$`),
+		Format: []string{"{city} {region} {postal}"},
+	},
+	{
+		Code: "NZ", Name: "New Zealand",
+		PostalLabel: "Postcode", PostalRequired: true, postal: regexp.MustCompile(`^\d{4}$`),
+		Format: []string{"{city} {postal}"},
+	},
+	europe("AT", "Austria", `^\d{4}$`),
+	europe("BE", "Belgium", `^\d{4}$`),
+	europe("DK", "Denmark", `^\d{4}$`),
+	europe("FR", "France", `^\d{5}$`),
+	europe("DE", "Germany", `^\d{5}$`),
+	{
+		Code: "IT", Name: "Italy",
+		RegionLabel: "Province",
+		PostalLabel: "Postal code", PostalRequired: true, postal: regexp.MustCompile(`^\d{5}$`),
+		Format: []string{"{postal} {city} {region}"},
+	},
+	europe("NL", "Netherlands", `^\d{4} ?[A-Z]{2}$`),
+	europe("NO", "Norway", `^\d{4}$`),
+	europe("PT", "Portugal", `^\d{4}-\d{3}$`),
+	europe("ES", "Spain", `^\d{5}$`),
+	europe("SE", "Sweden", `^\d{3} ?\d{2}$`),
+	europe("CH", "Switzerland", `^\d{4}$`),
+}
+
+// europe is the common continental layout: postal code before the city, no
+// region.
+func europe(code, name, postal string) Country {
+	return Country{
+		Code: code, Name: name,
+		PostalLabel: "Postal code", PostalRequired: true, postal: regexp.MustCompile(postal),
+		Format: []string{"{postal} {city}"},
+	}
+}
+
+// Lookup returns the rules for a country code.
+func Lookup(code string) (Country, bool) {
+	for _, c := range Countries {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return Country{}, false
+}
+
+var usStates = map[string]string{
+	"AL": "Alabama", "AK": "Alaska", "AZ": "Arizona", "AR": "Arkansas", "CA": "California",
+	"CO": "Colorado", "CT": "Connecticut", "DE": "Delaware", "DC": "District of Columbia", "FL": "Florida",
+	"GA": "Georgia", "HI": "Hawaii", "ID": "Idaho", "IL": "Illinois", "IN": "Indiana",
+	"IA": "Iowa", "KS": "Kansas", "KY": "Kentucky", "LA": "Louisiana", "ME": "Maine",
+	"MD": "Maryland", "MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota", "MS": "Mississippi",
+	"MO": "Missouri", "MT": "Montana", "NE": "Nebraska", "NV": "Nevada", "NH": "New Hampshire",
+	"NJ": "New Jersey", "NM": "New Mexico", "NY": "New York", "NC": "North Carolina", "ND": "North Dakota",
+	"OH": "Ohio", "OK": "Oklahoma", "OR": "Oregon", "PA": "Pennsylvania", "RI": "Rhode Island",
+	"SC": "South Carolina", "SD": "South Dakota", "TN": "Tennessee", "TX": "Texas", "UT": "Utah",
+	"VT": "Vermont", "VA": "Virginia", "WA": "Washington", "WV": "West Virginia", "WI": "Wisconsin",
+	"WY": "Wyoming", "PR": "Puerto Rico", "GU": "Guam", "VI": "U.S. Virgin Islands",
+	"AS": "American Samoa", "MP": "Northern Mariana Islands",
+	"AA": "Armed Forces Americas", "AE": "Armed Forces Europe", "AP": "Armed Forces Pacific",
+}
+
+var caProvinces = map[string]string{
+	"AB": "Alberta", "BC": "British Columbia", "MB": "Manitoba", "NB": "New Brunswick",
+	"NL": "Newfoundland and Labrador", "NS": "Nova Scotia", "NT": "Northwest Territories",
+	"NU": "Nunavut", "ON": "Ontario", "PE": "Prince Edward Island", "QC": "Quebec",
+	"SK": "Saskatchewan", "YT": "Yukon",
+}
+
+var auStates = map[string]string{
+	"ACT": "Australian Capital Territory", "NSW": "New South Wales", "NT": "Northern Territory",
+	"QLD": "Queensland", "SA": "South Australia", "TAS": "Tasmania", "VIC": "Victoria",
+	"WA": "Western Australia",
+}
@@ -0,0 +1,128 @@
+// Package antispam keeps bots away from the public forms. A Guard combines
+// a honeypot field, a signed timestamp that rejects forms submitted faster
+// than a person could fill them in, and an optional Challenge.
+package antispam
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Form field names. The honeypot has an ordinary-looking name so that form
+// fillers complete it; people never see it.
+const (
+	HoneypotField  = "website"
+	FormTokenField = "form_token"
+)
+
+var (
+	ErrHoneypot      = errors.New("antispam: honeypot field filled in")
+	ErrTooFast       = errors.New("antispam: form submitted too quickly")
+	ErrFormExpired   = errors.New("antispam: form token missing, invalid or expired")
+	ErrChallengeFail = errors.New("antispam: challenge not solved")
+)
+
+// Challenge is a test a browser must pass before a form is accepted, such as
+// ProofOfWork or a third-party CAPTCHA.
+type Challenge interface {
+	// Widget returns the HTML to place inside the form.
+	Widget() (template.HTML, error)
+	// Verify checks the submitted form, returning ErrChallengeFail if the
+	// challenge wasn't solved.
+	Verify(r *http.Request) error
+}
+
+// Guard checks submissions of the public forms.
+type Guard struct {
+	key []byte
+
+	// MinFillTime is how long a form must have been open before it is
+	// accepted, and MaxFormAge how long it stays valid.
+	MinFillTime time.Duration
+	MaxFormAge  time.Duration
+
+	// Challenge is optional; nil turns it off.
+	Challenge Challenge
+}
+
+// NewGuard returns a Guard that signs form timestamps with key.
+func NewGuard(key []byte, minFillTime time.Duration) *Guard {
+	return &Guard{
+		key:         key,
+		MinFillTime: minFillTime,
+		MaxFormAge:  24 * time.Hour,
+	}
+}
+
+// Fields returns the hidden inputs (and challenge widget, if any) to include
+// in a protected form. Each call starts the fill-time clock afresh.
+func (g *Guard) Fields() template.HTML {
+	var b strings.Builder
+	// Off-screen rather than display:none, which some bots skip.
+	b.WriteString(`<div style="position: absolute; left: -10000px;" aria-hidden="true">`)
+	b.WriteString(`<label>Leave this empty <input type="text" name="` + HoneypotField + `" tabindex="-1" autocomplete="off"></label>`)
+	b.WriteString(`</div>`)
+	b.WriteString(`<input type="hidden" name="` + FormTokenField + `" value="` + html.EscapeString(g.formToken(time.Now())) + `">`)
+	if g.Challenge != nil {
+		widget, err := g.Challenge.Widget()
+		if err == nil {
+			b.WriteString(string(widget))
+		}
+	}
+	return template.HTML(b.String())
+}
+
+// Check returns nil if the submission looks like it came from a person, or
+// one of the Err* values saying why not.
+func (g *Guard) Check(r *http.Request) error {
+	if r.FormValue(HoneypotField) != "" {
+		return ErrHoneypot
+	}
+	issued, ok := g.parseFormToken(r.FormValue(FormTokenField))
+	if !ok {
+		return ErrFormExpired
+	}
+	age := time.Since(issued)
+	if age > g.MaxFormAge {
+		return ErrFormExpired
+	}
+	if age < g.MinFillTime {
+		return ErrTooFast
+	}
+	if g.Challenge != nil {
+		return g.Challenge.Verify(r)
+	}
+	return nil
+}
+
+// formToken is the issue time in Unix seconds and its HMAC.
+func (g *Guard) formToken(now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	return ts + "." + sign(g.key, "form:"+ts)
+}
+
+func (g *Guard) parseFormToken(token string) (time.Time, bool) {
+	ts, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(g.key, "form:"+ts))) {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+func sign(key []byte, msg string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
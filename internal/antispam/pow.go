@@ -0,0 +1,108 @@
+package antispam
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"html/template"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProofOfWork is a self-hosted Challenge: the browser must find a nonce such
+// that SHA-256(challenge + nonce) starts with Difficulty zero bits. That
+// takes a second or two of JavaScript (static/js/pow.js) for a visitor, but
+// makes sending thousands of submissions expensive.
+type ProofOfWork struct {
+	key        []byte
+	Difficulty int
+	TTL        time.Duration
+
+	mu   sync.Mutex
+	used map[string]time.Time // Solved challenges, until they expire
+}
+
+// NewProofOfWork returns a challenge of the given difficulty in bits. Each
+// additional bit doubles the average work.
+func NewProofOfWork(key []byte, difficulty int) *ProofOfWork {
+	return &ProofOfWork{
+		key:        key,
+		Difficulty: difficulty,
+		TTL:        time.Hour,
+		used:       make(map[string]time.Time),
+	}
+}
+
+// Widget issues a fresh signed challenge.
+func (p *ProofOfWork) Widget() (template.HTML, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	payload := fmt.Sprintf("%d.%d.%s", time.Now().Add(p.TTL).Unix(), p.Difficulty, hex.EncodeToString(b))
+	challenge := payload + "." + sign(p.key, "pow:"+payload)
+	return template.HTML(fmt.Sprintf(
+		`<input type="hidden" name="pow_challenge" value="%s" data-difficulty="%d">`+
+			`<input type="hidden" name="pow_nonce" value="">`+
+			`<script src="/static/js/pow.js" defer></script>`,
+		html.EscapeString(challenge), p.Difficulty,
+	)), nil
+}
+
+// Verify checks the signature, expiry and work of the submitted solution.
+// Each challenge can only be used once.
+func (p *ProofOfWork) Verify(r *http.Request) error {
+	challenge := r.FormValue("pow_challenge")
+	nonce := r.FormValue("pow_nonce")
+
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 || nonce == "" || len(nonce) > 20 {
+		return ErrChallengeFail
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(sign(p.key, "pow:"+payload)), []byte(parts[3])) {
+		return ErrChallengeFail
+	}
+	expires, err1 := strconv.ParseInt(parts[0], 10, 64)
+	difficulty, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || time.Now().Unix() > expires || difficulty < p.Difficulty {
+		return ErrChallengeFail
+	}
+
+	sum := sha256.Sum256([]byte(challenge + nonce))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return ErrChallengeFail
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for c, exp := range p.used {
+		if now.After(exp) {
+			delete(p.used, c)
+		}
+	}
+	if _, seen := p.used[challenge]; seen {
+		return ErrChallengeFail
+	}
+	p.used[challenge] = time.Unix(expires, 0)
+	return nil
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
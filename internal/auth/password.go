@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt ignores everything past 72 bytes, so longer passwords are rejected
+// rather than silently truncated.
+const maxPasswordBytes = 72
+
+// PasswordPolicy describes the strength requirements for admin passwords.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireMixed  bool // Both upper and lower case letters
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// DefaultPasswordPolicy is used when nothing is configured.
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 10}
+
+// Validate returns an error describing every requirement the password misses.
+func (p PasswordPolicy) Validate(password string) error {
+	if len(password) > maxPasswordBytes {
+		return errors.New("Password must be at most 72 bytes long.")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	var missing []string
+	if len([]rune(password)) < p.MinLength {
+		missing = append(missing, "be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+	if p.RequireMixed && !(hasUpper && hasLower) {
+		missing = append(missing, "mix upper and lower case letters")
+	}
+	if p.RequireDigit && !hasDigit {
+		missing = append(missing, "contain a number")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		missing = append(missing, "contain a symbol")
+	}
+	if len(missing) > 0 {
+		return errors.New("Password must " + joinRequirements(missing) + ".")
+	}
+	return nil
+}
+
+// Describe summarises the policy for display next to password fields.
+func (p PasswordPolicy) Describe() string {
+	rules := []string{"at least " + strconv.Itoa(p.MinLength) + " characters"}
+	if p.RequireMixed {
+		rules = append(rules, "upper and lower case letters")
+	}
+	if p.RequireDigit {
+		rules = append(rules, "a number")
+	}
+	if p.RequireSymbol {
+		rules = append(rules, "a symbol")
+	}
+	if len(rules) == 1 {
+		return "Use " + rules[0] + "."
+	}
+	return "Use " + rules[0] + ", including " + joinRequirements(rules[1:]) + "."
+}
+
+// HashPassword hashes a password for storage.
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// CheckPassword reports whether password matches the stored hash.
+// An empty hash (e.g. a pending invite) never matches.
+func CheckPassword(hashedPassword, password string) bool {
+	if hashedPassword == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
+}
+
+func joinRequirements(parts []string) string {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
@@ -0,0 +1,146 @@
+// Package chart lays out simple bar charts for drawing as SVG in templates,
+// so the admin pages need no charting script. It only works out the
+// geometry; the templates draw it, which keeps the labels escaped.
+package chart
+
+import (
+	"math"
+	"strconv"
+)
+
+// Chart size, in SVG user units. Templates scale it to fit with viewBox.
+const (
+	Width  = 640
+	Height = 240
+
+	marginLeft   = 64 // Room for the value axis labels
+	marginBottom = 24 // Room for the category labels
+	marginTop    = 8
+
+	ticks     = 4  // Gridlines above the baseline
+	maxLabels = 10 // Category labels shown; the rest would overlap
+	barGap    = 0.2
+)
+
+// Point is one bar's category and value.
+type Point struct {
+	Label string
+	Value float64
+}
+
+// Bar is a bar's position and its tooltip.
+type Bar struct {
+	X, Y, Width, Height float64
+	Title               string
+}
+
+// Tick is a gridline on the value axis.
+type Tick struct {
+	Y     float64
+	Label string
+}
+
+// Label is a category label under the bars.
+type Label struct {
+	X    float64
+	Text string
+}
+
+// Bars is a laid out bar chart.
+type Bars struct {
+	Width, Height float64
+	Left, Bottom  float64 // Where the axes meet
+	Bars          []Bar
+	Ticks         []Tick
+	Labels        []Label
+	Empty         bool // Every value is zero
+}
+
+// TickX is where the value axis labels end.
+func (c Bars) TickX() float64 {
+	return c.Left - 6
+}
+
+// LabelY is the baseline of the category labels.
+func (c Bars) LabelY() float64 {
+	return c.Height - 6
+}
+
+// CenterX and CenterY are the middle of the plot, for a note when it's empty.
+func (c Bars) CenterX() float64 {
+	return (c.Left + c.Width) / 2
+}
+
+func (c Bars) CenterY() float64 {
+	return (marginTop + c.Bottom) / 2
+}
+
+// NewBars lays out a bar chart of points, formatting values with format.
+func NewBars(points []Point, format func(float64) string) Bars {
+	return newBars(points, format, 0)
+}
+
+// NewCountBars lays out a bar chart of whole numbers, whose axis never
+// goes up in fractions.
+func NewCountBars(points []Point) Bars {
+	return newBars(points, func(v float64) string { return strconv.FormatFloat(v, 'f', 0, 64) }, 1)
+}
+
+// newBars lays out a bar chart whose gridlines are at least minStep apart.
+func newBars(points []Point, format func(float64) string, minStep float64) Bars {
+	c := Bars{Width: Width, Height: Height, Left: marginLeft, Bottom: Height - marginBottom, Empty: true}
+	plotWidth := float64(Width - marginLeft)
+	plotHeight := c.Bottom - marginTop
+
+	max := 0.0
+	for _, p := range points {
+		if p.Value > 0 {
+			c.Empty = false
+		}
+		max = math.Max(max, p.Value)
+	}
+	top := math.Max(niceCeil(max/ticks), minStep) * ticks
+	for i := 0; i <= ticks; i++ {
+		v := top * float64(i) / ticks
+		c.Ticks = append(c.Ticks, Tick{Y: c.Bottom - plotHeight*float64(i)/ticks, Label: format(v)})
+	}
+
+	if len(points) == 0 {
+		return c
+	}
+	slot := plotWidth / float64(len(points))
+	every := (len(points) + maxLabels - 1) / maxLabels
+	for i, p := range points {
+		h := 0.0
+		if top > 0 {
+			h = plotHeight * math.Max(p.Value, 0) / top
+		}
+		x := c.Left + slot*float64(i)
+		c.Bars = append(c.Bars, Bar{
+			X:      x + slot*barGap/2,
+			Y:      c.Bottom - h,
+			Width:  slot * (1 - barGap),
+			Height: h,
+			Title:  p.Label + ": " + format(p.Value),
+		})
+		if i%every == 0 {
+			c.Labels = append(c.Labels, Label{X: x + slot/2, Text: p.Label})
+		}
+	}
+	return c
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of ten, so the axis reads
+// in round numbers. It's 1 for zero, so an empty chart still has an axis.
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, step := range []float64{1, 2, 5} {
+		if v <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
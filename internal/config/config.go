@@ -6,7 +6,10 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/auth"
 )
 
 type Config struct {
@@ -16,6 +19,89 @@ type Config struct {
 	SessionKey   []byte
 	CookieDomain string
 	CookieSecure bool
+
+	// Sessions end after SessionIdleTimeout without a request, and after
+	// SessionMaxLifetime regardless of activity.
+	SessionIdleTimeout time.Duration
+	SessionMaxLifetime time.Duration
+
+	PasswordPolicy auth.PasswordPolicy
+
+	// TrustedProxies may report the client address in X-Forwarded-For or
+	// X-Real-IP (IP addresses or CIDR ranges).
+	TrustedProxies []string
+
+	// RateLimits holds the rate limit for each named group of routes.
+	RateLimits map[string]RateLimit
+
+	// Anti-spam for the public order and sign-in link forms. SpamChallenge
+	// is "" (off) or "pow" (proof of work, solved by the browser).
+	SpamChallenge       string
+	SpamPowDifficulty   int
+	SpamMinFillTime     time.Duration
+	OrdersPerEmail      int // Per day
+	StatusLinksPerEmail int // Per hour
+
+	// DefaultCountry is the ISO 3166 code preselected on address forms.
+	DefaultCountry string
+
+	// LabelsDir holds uploaded shipping label PDFs. It must not be served
+	// publicly; admins download labels through the app.
+	LabelsDir string
+
+	// BaseURL is the site's public address, for links that leave the site
+	// and come back, such as emailed links and the payment provider's
+	// return URLs.
+	BaseURL string
+
+	// Currency is what prices are entered in and orders are charged in,
+	// ISO 4217 in lower case. Locale decides how amounts are written, e.g.
+	// "en-US" or "de-DE". Customers may see prices converted to other
+	// currencies, but only to give them an idea.
+	Currency string
+	Locale   string
+
+	// DefaultLanguage is shown to visitors whose browser asks for none of
+	// the languages in the locales directory.
+	DefaultLanguage string
+
+	// Online payments. PaymentProvider is "" (payment is arranged in person),
+	// "stripe" or "fake" (a local stand-in for testing).
+	PaymentProvider      string
+	StripeSecretKey      string
+	PaymentWebhookSecret string
+
+	// Shop details printed on invoices. ShopAddress is one entry per line.
+	ShopName      string
+	ShopAddress   []string
+	ShopEmail     string
+	ShopTaxID     string
+	InvoicePrefix string // Put before invoice numbers, e.g. "INV-00042"
+	// AttachInvoices attaches a PDF invoice to order confirmation emails.
+	AttachInvoices bool
+
+	// Tax. TaxInclusive means item prices and delivery fees already include
+	// tax. ShopCountry and ShopRegion are where the shop is, for taxing
+	// orders that aren't shipped.
+	TaxInclusive bool
+	ShopCountry  string
+	ShopRegion   string
+}
+
+// RateLimit allows Burst requests at once, refilled at Burst per Per.
+type RateLimit struct {
+	Burst int
+	Per   time.Duration
+}
+
+// DefaultRateLimits are the built-in limits, keyed by policy name. Each can be
+// overridden with RATE_LIMITS, e.g. "order=10/1h,login=5/1m".
+var DefaultRateLimits = map[string]RateLimit{
+	"order":          {Burst: 10, Per: time.Hour},       // Placing orders
+	"order-manage":   {Burst: 20, Per: time.Hour},       // Editing, cancelling, and re-sending order links
+	"status":         {Burst: 5, Per: 15 * time.Minute}, // Sign-in links
+	"login":          {Burst: 10, Per: time.Minute},     // Admin login and 2FA; also throttled per account
+	"password-reset": {Burst: 3, Per: 15 * time.Minute}, // Admin password reset emails
 }
 
 func LoadConfig() (*Config, error) {
@@ -24,7 +110,48 @@ func LoadConfig() (*Config, error) {
 		DBPath:       getEnv("DB_PATH", "./crochet.db"),
 		CookieDomain: getEnv("COOKIE_DOMAIN", ""),
 		CookieSecure: getEnv("COOKIE_SECURE", "false") == "true",
+
+		SessionIdleTimeout: getDuration("SESSION_IDLE_TIMEOUT", 2*time.Hour),
+		SessionMaxLifetime: getDuration("SESSION_MAX_LIFETIME", 7*24*time.Hour),
+
+		PasswordPolicy: LoadPasswordPolicy(),
+
+		TrustedProxies: getList("TRUSTED_PROXIES"),
+		RateLimits:     loadRateLimits(os.Getenv("RATE_LIMITS")),
+
+		SpamChallenge:       getEnv("SPAM_CHALLENGE", ""),
+		SpamPowDifficulty:   getInt("SPAM_POW_DIFFICULTY", 16),
+		SpamMinFillTime:     getDuration("SPAM_MIN_FILL_TIME", 3*time.Second),
+		OrdersPerEmail:      getInt("SPAM_ORDERS_PER_EMAIL", 5),
+		StatusLinksPerEmail: getInt("SPAM_LINKS_PER_EMAIL", 3),
+
+		DefaultCountry: strings.ToUpper(getEnv("DEFAULT_COUNTRY", "US")),
+
+		LabelsDir: getEnv("LABELS_DIR", "./labels"),
+
+		// PAYMENT_CURRENCY is what SHOP_CURRENCY used to be called
+		Currency: strings.ToLower(getEnv("SHOP_CURRENCY", getEnv("PAYMENT_CURRENCY", "usd"))),
+		Locale:   getEnv("SHOP_LOCALE", "en-US"),
+
+		DefaultLanguage: getEnv("DEFAULT_LANGUAGE", "en"),
+
+		PaymentProvider:      getEnv("PAYMENT_PROVIDER", ""),
+		StripeSecretKey:      os.Getenv("STRIPE_SECRET_KEY"),
+		PaymentWebhookSecret: os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+
+		ShopName:       getEnv("SHOP_NAME", "Crochet by Juliette"),
+		ShopAddress:    getLines("SHOP_ADDRESS"),
+		ShopEmail:      os.Getenv("SHOP_EMAIL"),
+		ShopTaxID:      os.Getenv("SHOP_TAX_ID"),
+		InvoicePrefix:  getEnv("INVOICE_PREFIX", "INV-"),
+		AttachInvoices: getEnv("ATTACH_INVOICES", "false") == "true",
+
+		TaxInclusive: getEnv("TAX_MODE", "exclusive") == "inclusive",
+		ShopRegion:   strings.ToUpper(os.Getenv("SHOP_REGION")),
 	}
+	cfg.ShopCountry = strings.ToUpper(getEnv("SHOP_COUNTRY", cfg.DefaultCountry))
+
+	cfg.BaseURL = strings.TrimSuffix(getEnv("BASE_URL", "http://localhost:"+cfg.Port), "/")
 
 	// CSRF Key (critical for security)
 	csrfKeyStr := os.Getenv("CSRF_KEY")
@@ -65,6 +192,23 @@ func LoadConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// LoadPasswordPolicy reads the admin password strength rules from the environment.
+// It is separate from LoadConfig so the CLI can enforce the same policy.
+func LoadPasswordPolicy() auth.PasswordPolicy {
+	policy := auth.DefaultPasswordPolicy
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			policy.MinLength = n
+		} else {
+			slog.Warn("Invalid PASSWORD_MIN_LENGTH, using default", "value", v, "default", policy.MinLength)
+		}
+	}
+	policy.RequireMixed = getEnv("PASSWORD_REQUIRE_MIXED_CASE", "false") == "true"
+	policy.RequireDigit = getEnv("PASSWORD_REQUIRE_DIGIT", "false") == "true"
+	policy.RequireSymbol = getEnv("PASSWORD_REQUIRE_SYMBOL", "false") == "true"
+	return policy
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -72,6 +216,84 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getDuration parses a Go duration such as "30m" or "12h", falling back to
+// defaultValue if the variable is unset or invalid.
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration, using default", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getInt parses a positive integer, falling back to defaultValue if the
+// variable is unset or invalid.
+func getInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		slog.Warn("Invalid number, using default", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getList splits a comma-separated variable, dropping empty entries.
+func getList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// getLines splits a variable holding several lines separated by "|", such
+// as a postal address, dropping empty lines.
+func getLines(key string) []string {
+	var lines []string
+	for _, v := range strings.Split(os.Getenv(key), "|") {
+		if v = strings.TrimSpace(v); v != "" {
+			lines = append(lines, v)
+		}
+	}
+	return lines
+}
+
+// loadRateLimits applies overrides such as "order=10/1h,login=5/1m" to the
+// defaults. Invalid entries are logged and ignored.
+func loadRateLimits(spec string) map[string]RateLimit {
+	limits := make(map[string]RateLimit, len(DefaultRateLimits))
+	for name, limit := range DefaultRateLimits {
+		limits[name] = limit
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(entry, "=")
+		burstStr, perStr, _ := strings.Cut(value, "/")
+		burst, err := strconv.Atoi(burstStr)
+		per, perErr := time.ParseDuration(perStr)
+		if _, known := DefaultRateLimits[name]; !known || err != nil || perErr != nil || burst < 1 || per <= 0 {
+			slog.Warn("Invalid RATE_LIMITS entry, ignoring", "entry", entry)
+			continue
+		}
+		limits[name] = RateLimit{Burst: burst, Per: per}
+	}
+	return limits
+}
+
 // generateRandomBytes generates a random byte slice of specified length
 // Uses crypto/rand for secure random numbers.
 func generateRandomBytes(n int) []byte {
@@ -0,0 +1,146 @@
+// Package currency writes amounts of money the way the shop's locale does,
+// and converts them into other currencies for display at the exchange rates
+// the shop keeps. Orders are always charged in the shop's own currency.
+package currency
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// Valid reports whether code is an ISO 4217 currency code, in either case.
+func Valid(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	_, err := currency.ParseISO(strings.ToUpper(code))
+	return err == nil
+}
+
+// Formatter writes amounts the way its locale does, e.g. "$1,234.50" for
+// en-US or "1.234,50 €" for de-DE.
+type Formatter struct {
+	Base   string // ISO 4217 code of the shop's currency, upper case
+	Locale language.Tag
+}
+
+// NewFormatter returns a Formatter for the shop's currency base, e.g.
+// "usd", written the way locale, e.g. "en-US", writes amounts.
+func NewFormatter(base, locale string) (Formatter, error) {
+	if !Valid(base) {
+		return Formatter{}, fmt.Errorf("currency: unknown currency %q", base)
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return Formatter{}, fmt.Errorf("currency: invalid locale %q: %w", locale, err)
+	}
+	return Formatter{Base: strings.ToUpper(base), Locale: tag}, nil
+}
+
+// Format writes an amount of the shop's currency.
+func (f Formatter) Format(amount float64) string {
+	return f.FormatIn(amount, f.Base)
+}
+
+// Scale is how many decimal places the currency code uses, e.g. 2 for
+// dollars and 0 for yen; 2 if it isn't a currency.
+func Scale(code string) int {
+	unit, err := currency.ParseISO(strings.ToUpper(code))
+	if err != nil {
+		return 2
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+	return scale
+}
+
+// Round rounds an amount of the currency code to the decimal places it
+// uses.
+func Round(amount float64, code string) float64 {
+	pow := math.Pow10(Scale(code))
+	return math.Round(amount*pow) / pow
+}
+
+// FormatIn writes an amount of the currency code, to the decimal places
+// that currency uses; yen have none.
+func (f Formatter) FormatIn(amount float64, code string) string {
+	unit, err := currency.ParseISO(strings.ToUpper(code))
+	if err != nil {
+		return fmt.Sprintf("%.2f %s", amount, code)
+	}
+	scale := Scale(code)
+	amount = Round(amount, code)
+
+	p := message.NewPrinter(f.Locale)
+	symbol := p.Sprint(currency.Symbol(unit))
+	digits := p.Sprint(number.Decimal(math.Abs(amount), number.Scale(scale)))
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	if symbolAfter(f.Locale) {
+		return sign + digits + "\u00a0" + symbol
+	}
+	return sign + symbol + digits
+}
+
+// Converted writes amount of the shop's currency in rate's currency, marked
+// as approximate, e.g. "≈ €27.60". It returns "" when rate is nil, which is
+// how templates are given the shop's own currency.
+func (f Formatter) Converted(rate *Rate, amount float64) string {
+	if rate == nil {
+		return ""
+	}
+	return "≈ " + f.FormatIn(rate.Convert(amount), rate.Currency)
+}
+
+// symbolAfterLanguages write the currency symbol after the amount, as in
+// "12,50 €". Everywhere else it goes in front.
+var symbolAfterLanguages = map[string]bool{
+	"bg": true, "cs": true, "da": true, "de": true, "el": true, "es": true,
+	"et": true, "fi": true, "fr": true, "hr": true, "hu": true, "it": true,
+	"lt": true, "lv": true, "nb": true, "nn": true, "no": true, "pl": true,
+	"ro": true, "ru": true, "sk": true, "sl": true, "sv": true, "uk": true,
+}
+
+func symbolAfter(tag language.Tag) bool {
+	base, _ := tag.Base()
+	return symbolAfterLanguages[base.String()]
+}
+
+// Rate is how much of another currency one unit of the shop's currency
+// buys. Rates are kept by hand and only used to show customers rough
+// prices; nothing is charged in them.
+type Rate struct {
+	Currency  string    `json:"currency"` // ISO 4217, upper case
+	Rate      float64   `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Convert turns an amount of the shop's currency into r.Currency.
+func (r Rate) Convert(amount float64) float64 {
+	return amount * r.Rate
+}
+
+// Validate returns a message per invalid field, keyed by "currency" or
+// "rate"; an empty map means the rate is valid. base is the shop's
+// currency, which needs no rate.
+func (r Rate) Validate(base string) map[string]string {
+	errors := make(map[string]string)
+	switch {
+	case !Valid(r.Currency):
+		errors["currency"] = "Enter a three letter currency code, e.g. EUR."
+	case strings.EqualFold(r.Currency, base):
+		errors["currency"] = "Prices are already in " + strings.ToUpper(base) + "."
+	}
+	if !(r.Rate > 0) {
+		errors["rate"] = "The rate must be positive."
+	}
+	return errors
+}
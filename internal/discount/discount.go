@@ -0,0 +1,169 @@
+// Package discount checks and applies the discount codes customers enter
+// when ordering.
+package discount
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Discount kinds.
+const (
+	KindPercent = "percent" // Value is a percentage of the items' price
+	KindFixed   = "fixed"   // Value is taken off the items' price
+)
+
+// Kinds lists the discount kinds in display order.
+var Kinds = []string{KindPercent, KindFixed}
+
+// KindLabel returns a human readable name for a discount kind.
+func KindLabel(kind string) string {
+	switch kind {
+	case KindPercent:
+		return "Percentage off"
+	case KindFixed:
+		return "Fixed amount off"
+	}
+	return kind
+}
+
+// Reasons a code can't be used, for Check.
+var (
+	ErrInactive    = errors.New("discount: code is switched off")
+	ErrExpired     = errors.New("discount: code has expired")
+	ErrItem        = errors.New("discount: code doesn't cover this item")
+	ErrMinOrder    = errors.New("discount: order is below the code's minimum")
+	ErrUsedUp      = errors.New("discount: code has been used as often as allowed")
+	ErrUsedByEmail = errors.New("discount: customer has used the code as often as allowed")
+)
+
+// Code is a discount code. Discounts come off the price of the items, not
+// delivery.
+type Code struct {
+	ID              int       `json:"id"`
+	Code            string    `json:"code"` // Upper case, see Normalize
+	Kind            string    `json:"kind"`
+	Value           float64   `json:"value"`
+	MinOrder        float64   `json:"min_order"`          // Items' price needed to use the code; 0 for none
+	ExpiresAt       time.Time `json:"expires_at"`         // Zero if it never expires
+	MaxUses         int       `json:"max_uses"`           // Orders in total; 0 for no limit
+	MaxUsesPerEmail int       `json:"max_uses_per_email"` // Orders per customer email; 0 for no limit
+	ItemIDs         []int     `json:"item_ids"`           // Items it can be used on; empty for all
+	Active          bool      `json:"active"`
+	CreatedAt       time.Time `json:"created_at"`
+	Redemptions     int       `json:"redemptions"` // Orders placed with it, not counting cancelled ones
+}
+
+var codePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// Normalize tidies a code as typed by a customer or admin. Codes are
+// matched without regard to case.
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate returns a message per invalid field, keyed by "code", "kind",
+// "value", "min_order", "max_uses" or "max_uses_per_email"; an empty map
+// means the code is valid.
+func (c Code) Validate() map[string]string {
+	errors := make(map[string]string)
+	if !codePattern.MatchString(c.Code) {
+		errors["code"] = "Codes are 3 to 32 letters, digits, dashes or underscores."
+	}
+	switch c.Kind {
+	case KindPercent:
+		if !(c.Value > 0) || c.Value > 100 {
+			errors["value"] = "A percentage must be above 0 and up to 100."
+		}
+	case KindFixed:
+		if !(c.Value > 0) {
+			errors["value"] = "The amount off must be positive."
+		}
+	default:
+		errors["kind"] = "Invalid discount type."
+	}
+	if c.MinOrder < 0 {
+		errors["min_order"] = "The minimum order can't be negative."
+	}
+	if c.MaxUses < 0 {
+		errors["max_uses"] = "Limits can't be negative."
+	}
+	if c.MaxUsesPerEmail < 0 {
+		errors["max_uses_per_email"] = "Limits can't be negative."
+	}
+	return errors
+}
+
+// Label describes the discount, e.g. "10% off", writing fixed amounts
+// with money.
+func (c Code) Label(money func(float64) string) string {
+	if c.Kind == KindPercent {
+		return strings.TrimRight(strings.TrimRight(strconv.FormatFloat(c.Value, 'f', 2, 64), "0"), ".") + "% off"
+	}
+	return money(c.Value) + " off"
+}
+
+// Expired reports whether the code had expired by now.
+func (c Code) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt)
+}
+
+// AppliesTo reports whether the code can be used on the item.
+func (c Code) AppliesTo(itemID int) bool {
+	return len(c.ItemIDs) == 0 || slices.Contains(c.ItemIDs, itemID)
+}
+
+// Amount is the discount on items costing subtotal, which it never exceeds.
+func (c Code) Amount(subtotal float64) float64 {
+	amount := c.Value
+	if c.Kind == KindPercent {
+		amount = subtotal * c.Value / 100
+	}
+	return math.Round(math.Min(amount, subtotal)*100) / 100
+}
+
+// Check returns why the code can't be used now on an order for itemID
+// costing subtotal, or nil if it can. uses and emailUses are how many
+// orders have used it in all and from the customer's email.
+func (c Code) Check(itemID int, subtotal float64, uses, emailUses int, now time.Time) error {
+	switch {
+	case !c.Active:
+		return ErrInactive
+	case c.Expired(now):
+		return ErrExpired
+	case !c.AppliesTo(itemID):
+		return ErrItem
+	case subtotal < c.MinOrder:
+		return ErrMinOrder
+	case c.MaxUses > 0 && uses >= c.MaxUses:
+		return ErrUsedUp
+	case c.MaxUsesPerEmail > 0 && emailUses >= c.MaxUsesPerEmail:
+		return ErrUsedByEmail
+	}
+	return nil
+}
+
+// FormatItemIDs and ParseItemIDs convert item restrictions to and from the
+// comma separated form they are stored in.
+func FormatItemIDs(ids []int) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+	return strings.Join(s, ",")
+}
+
+func ParseItemIDs(s string) []int {
+	var ids []int
+	for _, f := range strings.Split(s, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(f)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,92 @@
+// Package emailaddr validates and normalizes email addresses typed into
+// forms, and derives the case-folded key used to look them up.
+package emailaddr
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+)
+
+var ErrInvalid = errors.New("invalid email address")
+
+// profile converts domains to ASCII the way a mail client would look them
+// up, rejecting labels that aren't valid host names.
+var profile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+var folder = cases.Fold()
+
+// Normalize parses an address as typed into a form and returns it in the
+// form to store and send mail to: trimmed, with the domain lower-cased and
+// converted to ASCII (so "jane@bücher.example" becomes
+// "jane@xn--bcher-kva.example"). The local part keeps its case, since mail
+// servers are allowed to treat it as significant.
+//
+// Display names ("Jane <jane@example.com>"), quoted local parts and IP
+// address domains are rejected: they are valid RFC 5322 but nobody types
+// them into an order form by accident, and they cause trouble downstream.
+func Normalize(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || len(s) > 254 || strings.ContainsAny(s, "<>\"") {
+		return "", ErrInvalid
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" {
+		return "", ErrInvalid
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	local, domain := addr.Address[:at], addr.Address[at+1:]
+	if len(local) > 64 || strings.ContainsAny(local, " \\(),:;[]") {
+		return "", ErrInvalid
+	}
+
+	domain, err = profile.ToASCII(domain)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	domain = strings.ToLower(domain)
+	dot := strings.LastIndex(domain, ".")
+	if dot <= 0 || !validTLD(domain[dot+1:]) {
+		return "", ErrInvalid
+	}
+	return local + "@" + domain, nil
+}
+
+// Valid reports whether s is an address Normalize accepts.
+func Valid(s string) bool {
+	_, err := Normalize(s)
+	return err == nil
+}
+
+// Key returns the string two addresses share if they belong to the same
+// person in practice: the normalized address with its local part
+// case-folded. Invalid input is trimmed and folded as-is, so lookups with
+// it simply find nothing.
+func Key(s string) string {
+	addr, err := Normalize(s)
+	if err != nil {
+		return folder.String(strings.TrimSpace(s))
+	}
+	at := strings.LastIndex(addr, "@")
+	return folder.String(addr[:at]) + addr[at:]
+}
+
+// validTLD accepts letters-only top-level domains and punycode ones.
+func validTLD(tld string) bool {
+	if strings.HasPrefix(tld, "xn--") {
+		return len(tld) > 4
+	}
+	if len(tld) < 2 {
+		return false
+	}
+	for _, c := range tld {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
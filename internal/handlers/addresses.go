@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+)
+
+// Address forms use these field names, each prefixed with "ship_".
+const addressFieldPrefix = "ship_"
+
+// addressFromForm reads and normalizes the ship_* fields of a form.
+func addressFromForm(r *http.Request) address.Address {
+	p := addressFieldPrefix
+	return address.Address{
+		Name:       r.FormValue(p + "name"),
+		Line1:      r.FormValue(p + "line1"),
+		Line2:      r.FormValue(p + "line2"),
+		City:       r.FormValue(p + "city"),
+		Region:     r.FormValue(p + "region"),
+		PostalCode: r.FormValue(p + "postal_code"),
+		Country:    r.FormValue(p + "country"),
+	}.Normalize()
+}
+
+// addAddressErrors validates a and adds any problems to errors, keyed by
+// form field name.
+func addAddressErrors(a address.Address, errors map[string]string) {
+	for field, msg := range a.Validate() {
+		errors[addressFieldPrefix+field] = msg
+	}
+}
+
+// addressErrorMessage joins an address's problems into one sentence list,
+// for pages that report errors with a flash rather than next to each field.
+func addressErrorMessage(a address.Address) string {
+	errors := a.Validate()
+	var msgs []string
+	// Fixed order, so the message reads like the form
+	for _, field := range []string{"name", "line1", "city", "region", "postal_code", "country"} {
+		if msg, ok := errors[field]; ok {
+			msgs = append(msgs, msg)
+		}
+	}
+	return strings.Join(msgs, " ")
+}
+
+// setAddressValues fills the ship_* fields of a form with a.
+func setAddressValues(values url.Values, a address.Address) {
+	p := addressFieldPrefix
+	values.Set(p+"name", a.Name)
+	values.Set(p+"line1", a.Line1)
+	values.Set(p+"line2", a.Line2)
+	values.Set(p+"city", a.City)
+	values.Set(p+"region", a.Region)
+	values.Set(p+"postal_code", a.PostalCode)
+	values.Set(p+"country", a.Country)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/jpeg"
@@ -9,21 +10,33 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
+	"github.com/alextreichler/crochetbyjuliette/internal/auth"
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
 	"github.com/alextreichler/crochetbyjuliette/internal/models"
 	"github.com/alextreichler/crochetbyjuliette/internal/store"
+	"github.com/alextreichler/crochetbyjuliette/internal/tax"
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/sessions"
 	"github.com/nfnt/resize"
-	"golang.org/x/crypto/bcrypt"
 	"log/slog"
 	"github.com/google/uuid"
 )
 
 type AdminHandler struct {
-	Store        *store.Store
-	SessionStore *sessions.CookieStore
-	Templates    *TemplateCache
+	Store          *store.Store
+	SessionStore   *store.SessionStore
+	Templates      *TemplateCache
+	PasswordPolicy auth.PasswordPolicy
+	LabelsDir      string // Shipping label PDFs
+	Currency       string // Of recorded payments
+	Money          currency.Formatter
+	Invoicing      Invoicing
+	Tax            tax.Settings
+	Messages       *i18n.Bundle // Languages items can be translated into
+	BaseURL        string       // For emailed links
 }
 
 func (h *AdminHandler) LoginGet(w http.ResponseWriter, r *http.Request) {
@@ -52,6 +65,22 @@ func (h *AdminHandler) LoginPost(w http.ResponseWriter, r *http.Request) {
 
 	username := r.FormValue("username")
 	password := r.FormValue("password")
+	attemptKey := normalizeLoginUsername(username)
+
+	// Throttled attempts are rejected before the password is even checked.
+	wait, err := h.loginWait(attemptKey, ClientIP(r))
+	if err != nil {
+		slog.Error("Failed to check login attempts", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Internal Server Error"})
+		saveAndRedirect(w, r, session, "/login")
+		return
+	}
+	if wait > 0 {
+		h.recordLoginAttempt(r, attemptKey, false, loginReasonThrottled)
+		session.AddFlash(FlashMessage{Type: "error", Message: waitMessage(wait)})
+		saveAndRedirect(w, r, session, "/login")
+		return
+	}
 
 	user, err := h.Store.GetUserByUsername(username)
 	if err != nil {
@@ -61,21 +90,49 @@ func (h *AdminHandler) LoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if user == nil {
+	// Invited users have no password until they accept, and deactivated users can't log in.
+	if user == nil || user.Password == "" || !user.Active {
+		h.recordLoginAttempt(r, attemptKey, false, loginReasonBadPassword)
 		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid username or password"})
 		session.Save(r, w) // Save before redirect
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
+	if !auth.CheckPassword(user.Password, password) {
+		h.recordLoginAttempt(r, attemptKey, false, loginReasonBadPassword)
 		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid username or password"})
 		session.Save(r, w) // Save before redirect
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
+	// With 2FA enabled the password only gets the user as far as the code prompt.
+	if user.TOTPEnabled {
+		session.Values["authenticated"] = false
+		session.Values[pendingTwoFactorUserKey] = user.ID
+		session.Values[pendingTwoFactorSinceKey] = time.Now().Unix()
+		session.Values[pendingTwoFactorAttemptsKey] = 0
+		slog.Info("Password accepted, awaiting second factor", "user_id", user.ID)
+		saveAndRedirect(w, r, session, "/login/2fa")
+		return
+	}
+
+	h.completeLogin(w, r, session, user)
+}
+
+// completeLogin marks the session as authenticated once every required
+// factor has been verified.
+func (h *AdminHandler) completeLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, user *models.User) {
+	clearPendingTwoFactor(session)
+
+	// Log in under a fresh session ID so one planted before login is useless.
+	if err := h.SessionStore.RenewID(session); err != nil {
+		slog.Error("Failed to renew session ID", "error", err)
+		http.Error(w, "Failed to save session", http.StatusInternalServerError)
+		return
+	}
+
 	// Set authenticated session
 	session.Values["authenticated"] = true
 	session.Values["user_id"] = user.ID
@@ -89,6 +146,7 @@ func (h *AdminHandler) LoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.recordLoginAttempt(r, normalizeLoginUsername(user.Username), true, "")
 	slog.Info("Login successful, redirecting to /admin", "user_id", user.ID)
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
@@ -98,11 +156,21 @@ func (h *AdminHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	session.Values["authenticated"] = false
 	session.Options.MaxAge = -1 // Expire immediately
 	session.AddFlash(FlashMessage{Type: "success", Message: "Logged out successfully!"})
-	session.Save(r, w)
-	http.Redirect(w, r, "/login", http.StatusSeeOther)
+	saveAndRedirect(w, r, session, "/login")
+}
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// CurrentUser returns the admin user loaded by AuthMiddleware, or nil.
+func CurrentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
 }
 
-// AuthMiddleware ensures the user is logged in
+// AuthMiddleware ensures the user is logged in and their account is still active.
+// The user is loaded on every request so role changes and deactivation apply immediately.
 func (h *AdminHandler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("AuthMiddleware triggered for path", "path", r.URL.Path)
@@ -110,14 +178,53 @@ func (h *AdminHandler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		if auth, ok := session.Values["authenticated"].(bool); !ok || !auth {
 			slog.Info("AuthMiddleware: User not authenticated, redirecting to /login", "path", r.URL.Path)
 			session.AddFlash(FlashMessage{Type: "error", Message: "You must be logged in to access this page."})
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			saveAndRedirect(w, r, session, "/login")
 			return
 		}
-		slog.Info("AuthMiddleware: User authenticated", "user_id", session.Values["user_id"], "path", r.URL.Path)
-		next(w, r)
+
+		userID, _ := session.Values["user_id"].(int)
+		user, err := h.Store.GetUserByID(userID)
+		if err != nil {
+			slog.Error("AuthMiddleware: Failed to load user", "user_id", userID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil || !user.Active {
+			slog.Warn("AuthMiddleware: User missing or deactivated, ending session", "user_id", userID)
+			session.Values["authenticated"] = false
+			delete(session.Values, "user_id")
+			session.AddFlash(FlashMessage{Type: "error", Message: "Your account is no longer active."})
+			saveAndRedirect(w, r, session, "/login")
+			return
+		}
+
+		slog.Info("AuthMiddleware: User authenticated", "user_id", user.ID, "role", user.Role, "path", r.URL.Path)
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next(w, r.WithContext(ctx))
 	}
 }
 
+// RequirePermission wraps next in AuthMiddleware and additionally checks that
+// the logged-in user's role grants perm.
+func (h *AdminHandler) RequirePermission(perm models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return h.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		user := CurrentUser(r)
+		if !user.Can(perm) {
+			slog.Warn("Permission denied", "user_id", user.ID, "role", user.Role, "permission", perm, "path", r.URL.Path)
+			if perm == models.PermViewAdmin {
+				// Redirecting to the dashboard would loop.
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			session, _ := h.SessionStore.Get(r, "admin-session")
+			session.AddFlash(FlashMessage{Type: "error", Message: "You don't have permission to do that."})
+			saveAndRedirect(w, r, session, "/admin")
+			return
+		}
+		next(w, r)
+	})
+}
+
 // New methods moved from dashboard.go
 func (h *AdminHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 	stats, err := h.Store.GetDashboardStats()
@@ -126,6 +233,25 @@ func (h *AdminHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	from, to, bucket := salesPeriod(r)
+	sales, err := h.Store.GetSalesReport(from, to, bucket, topItemCount)
+	if err != nil {
+		slog.Error("Failed to build sales report", "error", err)
+		http.Error(w, "Error fetching sales", http.StatusInternalServerError)
+		return
+	}
+	ordersChart, revenueChart := salesCharts(sales, h.Money.Format)
+
+	// Failed logins are only of interest to the people who manage accounts.
+	var failedLogins []models.LoginAttempt
+	if CurrentUser(r).Can(models.PermManageUsers) {
+		failedLogins, err = h.Store.GetRecentFailedLogins(10)
+		if err != nil {
+			http.Error(w, "Error fetching login attempts", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	tmpl := h.Templates.Get("admin.html")
 	if tmpl == nil {
 		http.Error(w, "Template not found", http.StatusInternalServerError)
@@ -134,8 +260,17 @@ func (h *AdminHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 	// Add flash messages to the data
 	session, _ := h.SessionStore.Get(r, "admin-session")
 	data := map[string]interface{}{
-		"Stats":   stats,
-		"Flashes": GetFlash(session),
+		"Stats":        stats,
+		"Sales":        sales,
+		"OrdersChart":  ordersChart,
+		"RevenueChart": revenueChart,
+		"TopItems":     topItems(sales),
+		"From":         from.Format("2006-01-02"),
+		"To":           to.Format("2006-01-02"),
+		"Buckets":      store.Buckets,
+		"FailedLogins": failedLogins,
+		"Flashes":      GetFlash(session),
+		"CurrentUser":  CurrentUser(r),
 	}
 	session.Save(r, w) // Save session to clear flashes
 	tmpl.Execute(w, data)
@@ -151,7 +286,8 @@ func (h *AdminHandler) AddItemForm(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
 		"CsrfField": csrf.TemplateField(r),
 		"Flashes":   GetFlash(session),
-		"Values":    r.Form, // Pre-fill form on error
+		"Values":     r.Form, // Pre-fill form on error
+		"TaxClasses": tax.Classes,
 	}
 	session.Save(r, w) // Save session to clear flashes
 	tmpl.Execute(w, data)
@@ -159,13 +295,12 @@ func (h *AdminHandler) AddItemForm(w http.ResponseWriter, r *http.Request) {
 
 func (h *AdminHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.SessionStore.Get(r, "admin-session")
-	defer session.Save(r, w) // Save session to clear flashes if any were added and to persist others
 
 	// 1. Parse Multipart Form
 	err := r.ParseMultipartForm(10 << 20) // 10MB
 	if err != nil {
 		session.AddFlash(FlashMessage{Type: "error", Message: "File too large. Max 10MB."})
-		http.Redirect(w, r, "/admin/items/new", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin/items/new")
 		return
 	}
 
@@ -199,6 +334,11 @@ func (h *AdminHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 	if !validStatuses[status] {
 		errors["status"] = "Invalid status selected."
 	}
+	pkg := models.Item{Price: price}
+	setItemPackage(r, &pkg, errors)
+	setItemDeposit(r, &pkg, errors)
+	setItemStock(r, &pkg, errors)
+	setItemTaxClass(r, &pkg, errors)
 
 	file, header, fileErr := r.FormFile("image")
 	if fileErr != nil {
@@ -210,7 +350,7 @@ func (h *AdminHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 			session.AddFlash(FlashMessage{Type: "error", Message: msg})
 		}
 		// Redirect back to form, preserving values if possible (r.Form already has them)
-		http.Redirect(w, r, "/admin/items/new", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin/items/new")
 		return
 	}
 	// If fileErr was nil, it means file exists, defer close.
@@ -226,13 +366,13 @@ func (h *AdminHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 		img, err = jpeg.Decode(file)
 	} else {
 		session.AddFlash(FlashMessage{Type: "error", Message: "Unsupported image format. Only PNG, JPG, JPEG are allowed."})
-		http.Redirect(w, r, "/admin/items/new", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin/items/new")
 		return
 	}
 
 	if err != nil {
 		session.AddFlash(FlashMessage{Type: "error", Message: "Failed to decode image."})
-		http.Redirect(w, r, "/admin/items/new", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin/items/new")
 		return
 	}
 
@@ -247,7 +387,7 @@ func (h *AdminHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 	out, err := os.Create(uploadPath)
 	if err != nil {
 		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving image file."})
-		http.Redirect(w, r, "/admin/items/new", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin/items/new")
 		return
 	}
 	defer out.Close()
@@ -256,7 +396,7 @@ func (h *AdminHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 	err = jpeg.Encode(out, newImage, &jpeg.Options{Quality: 80}) // Add quality for JPEG
 	if err != nil {
 		session.AddFlash(FlashMessage{Type: "error", Message: "Error encoding image."})
-		http.Redirect(w, r, "/admin/items/new", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin/items/new")
 		return
 	}
 
@@ -268,36 +408,44 @@ func (h *AdminHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 		DeliveryTime: delivery,
 		ImageURL:     "/static/uploads/" + filename,
 		Status:       status,
+		WeightGrams:  pkg.WeightGrams,
+		LengthCm:     pkg.LengthCm,
+		WidthCm:      pkg.WidthCm,
+		HeightCm:     pkg.HeightCm,
+		DepositType:  pkg.DepositType,
+		DepositValue: pkg.DepositValue,
+		TrackStock:   pkg.TrackStock,
+		Stock:        pkg.Stock,
+		TaxClass:     pkg.TaxClass,
 	}
 
 	if err := h.Store.CreateItem(item); err != nil {
 		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving item to database."})
-		http.Redirect(w, r, "/admin/items/new", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin/items/new")
 		return
 	}
 
 	session.AddFlash(FlashMessage{Type: "success", Message: "Item added successfully!"})
-	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	saveAndRedirect(w, r, session, "/admin")
 }
 
 func (h *AdminHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.SessionStore.Get(r, "admin-session")
-	defer session.Save(r, w)
 
 	idStr := r.FormValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid ID."})
-		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin")
 		return
 	}
 
 	if err := h.Store.DeleteItem(id); err != nil {
 		session.AddFlash(FlashMessage{Type: "error", Message: "Error deleting item."})
-		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin")
 		return
 	}
 
 	session.AddFlash(FlashMessage{Type: "success", Message: "Item deleted successfully!"})
-	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	saveAndRedirect(w, r, session, "/admin")
 }
@@ -5,17 +5,117 @@ import (
 	"image"
 	"image/jpeg"
 	"image/png"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
 	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/tax"
 	"github.com/gorilla/csrf"
 	"github.com/nfnt/resize"
 	"github.com/google/uuid"
 )
 
+// setItemPackage reads the optional packed weight and size fields into item,
+// adding a message to errors for any that aren't a non-negative number.
+// Blank fields count as zero.
+func setItemPackage(r *http.Request, item *models.Item, errors map[string]string) {
+	if v := r.FormValue("weight_grams"); v != "" {
+		grams, err := strconv.Atoi(v)
+		if err != nil || grams < 0 {
+			errors["weight_grams"] = "Weight must be a whole number of grams."
+		}
+		item.WeightGrams = grams
+	}
+	for _, f := range []struct {
+		name string
+		dest *float64
+	}{{"length_cm", &item.LengthCm}, {"width_cm", &item.WidthCm}, {"height_cm", &item.HeightCm}} {
+		v := r.FormValue(f.name)
+		if v == "" {
+			continue
+		}
+		cm, err := strconv.ParseFloat(v, 64)
+		if err != nil || cm < 0 {
+			errors["package"] = "Package dimensions must be positive numbers of centimetres."
+		}
+		*f.dest = cm
+	}
+}
+
+// setItemDeposit reads the optional deposit fields into item, recording
+// problems in errors. item.Price must already be set.
+func setItemDeposit(r *http.Request, item *models.Item, errors map[string]string) {
+	item.DepositType = r.FormValue("deposit_type")
+	if item.DepositType == "" {
+		item.DepositValue = 0
+		return
+	}
+	value, err := strconv.ParseFloat(r.FormValue("deposit_value"), 64)
+	switch {
+	case item.DepositType != models.DepositPercent && item.DepositType != models.DepositFixed:
+		errors["deposit"] = "Invalid deposit type selected."
+	case err != nil || !(value > 0):
+		errors["deposit"] = "Deposit must be a positive number."
+	case item.DepositType == models.DepositPercent && value > 100:
+		errors["deposit"] = "A deposit can't be more than 100% of the price."
+	case item.DepositType == models.DepositFixed && value > item.Price:
+		errors["deposit"] = "A deposit can't be more than the item's price."
+	}
+	item.DepositValue = value
+}
+
+// setItemStock reads the optional stock count into item. Leaving it blank
+// means the item is made to order and doesn't track stock.
+func setItemStock(r *http.Request, item *models.Item, errors map[string]string) {
+	v := strings.TrimSpace(r.FormValue("stock"))
+	item.TrackStock = v != ""
+	if !item.TrackStock {
+		item.Stock = 0
+		return
+	}
+	stock, err := strconv.Atoi(v)
+	if err != nil || stock < 0 {
+		errors["stock"] = "Stock must be a whole number, or blank for made to order."
+	}
+	item.Stock = stock
+}
+
+// itemLanguage is a tab of the item form: the item's own title and
+// description, in the default language, or its translation into another.
+type itemLanguage struct {
+	languageOption
+	Default     bool
+	Translation models.ItemTranslation
+}
+
+// itemLanguages lists the tabs of the item form, the default language first.
+func (h *AdminHandler) itemLanguages(translations map[string]models.ItemTranslation) []itemLanguage {
+	langs := []itemLanguage{{languageOption: languageOption{Code: h.Messages.Default, Name: i18n.Name(h.Messages.Default)}, Default: true}}
+	for _, option := range languageOptions(h.Messages) {
+		if option.Code != h.Messages.Default {
+			langs = append(langs, itemLanguage{languageOption: option, Translation: translations[option.Code]})
+		}
+	}
+	return langs
+}
+
+// setItemTaxClass reads the item's tax class, defaulting to the standard rate.
+func setItemTaxClass(r *http.Request, item *models.Item, errors map[string]string) {
+	item.TaxClass = r.FormValue("tax_class")
+	if item.TaxClass == "" {
+		item.TaxClass = tax.ClassStandard
+	}
+	if !slices.Contains(tax.Classes, item.TaxClass) {
+		errors["tax_class"] = "Invalid tax class selected."
+	}
+}
+
 func (h *AdminHandler) EditItemForm(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 	id, err := strconv.Atoi(idStr)
@@ -24,11 +124,17 @@ func (h *AdminHandler) EditItemForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	item, err := h.Store.GetItemByID(id)
+	item, err := h.Store.GetItemByID(id, "")
 	if err != nil {
 		http.Error(w, "Item not found", http.StatusNotFound)
 		return
 	}
+	translations, err := h.Store.ListItemTranslations(id)
+	if err != nil {
+		slog.Error("Failed to load item translations", "item_id", id, "error", err)
+		http.Error(w, "Error fetching item", http.StatusInternalServerError)
+		return
+	}
 
 	tmpl := h.Templates.Get("admin_edit_item.html")
 	if tmpl == nil {
@@ -39,7 +145,9 @@ func (h *AdminHandler) EditItemForm(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
 		"CsrfField": csrf.TemplateField(r),
 		"Flashes":   GetFlash(session),
-		"Item":      item,
+		"Item":       item,
+		"TaxClasses": tax.Classes,
+		"Languages":  h.itemLanguages(translations),
 	}
 	session.Save(r, w)
 	tmpl.Execute(w, data)
@@ -47,12 +155,11 @@ func (h *AdminHandler) EditItemForm(w http.ResponseWriter, r *http.Request) {
 
 func (h *AdminHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.SessionStore.Get(r, "admin-session")
-	defer session.Save(r, w)
 
 	err := r.ParseMultipartForm(10 << 20) // 10MB
 	if err != nil {
 		session.AddFlash(FlashMessage{Type: "error", Message: "File too large."})
-		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		saveAndRedirect(w, r, session, "/admin")
 		return
 	}
 
@@ -74,13 +181,42 @@ func (h *AdminHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 		DeliveryTime: delivery,
 		Status:       status,
 	}
+	errors := make(map[string]string)
+	setItemPackage(r, item, errors)
+	setItemDeposit(r, item, errors)
+	setItemStock(r, item, errors)
+	setItemTaxClass(r, item, errors)
+	if len(errors) > 0 {
+		for _, msg := range errors {
+			session.AddFlash(FlashMessage{Type: "error", Message: msg})
+		}
+		saveAndRedirect(w, r, session, fmt.Sprintf("/admin/items/edit?id=%d", id))
+		return
+	}
 
 	if err := h.Store.UpdateItem(item); err != nil {
 		session.AddFlash(FlashMessage{Type: "error", Message: "Error updating item."})
-		http.Redirect(w, r, fmt.Sprintf("/admin/items/edit?id=%d", id), http.StatusSeeOther)
+		saveAndRedirect(w, r, session, fmt.Sprintf("/admin/items/edit?id=%d", id))
 		return
 	}
 
+	for _, lang := range h.Messages.Languages() {
+		if lang == h.Messages.Default {
+			continue
+		}
+		t := models.ItemTranslation{
+			Lang:        lang,
+			Title:       strings.TrimSpace(r.FormValue("title_" + lang)),
+			Description: strings.TrimSpace(r.FormValue("description_" + lang)),
+		}
+		if err := h.Store.SaveItemTranslation(id, t); err != nil {
+			slog.Error("Failed to save item translation", "item_id", id, "lang", lang, "error", err)
+			session.AddFlash(FlashMessage{Type: "error", Message: "Error saving translations."})
+			saveAndRedirect(w, r, session, fmt.Sprintf("/admin/items/edit?id=%d", id))
+			return
+		}
+	}
+
 	// Handle optional image update
 	file, header, err := r.FormFile("image")
 	if err == nil {
@@ -94,7 +230,7 @@ func (h *AdminHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 			img, err = jpeg.Decode(file)
 		} else {
 			session.AddFlash(FlashMessage{Type: "error", Message: "Unsupported image format."})
-			http.Redirect(w, r, fmt.Sprintf("/admin/items/edit?id=%d", id), http.StatusSeeOther)
+			saveAndRedirect(w, r, session, fmt.Sprintf("/admin/items/edit?id=%d", id))
 			return
 		}
 
@@ -112,5 +248,5 @@ func (h *AdminHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	session.AddFlash(FlashMessage{Type: "success", Message: "Item updated successfully!"})
-	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	saveAndRedirect(w, r, session, "/admin")
 }
@@ -21,9 +21,10 @@ func (h *AdminHandler) ListItems(w http.ResponseWriter, r *http.Request) {
 	}
 	session, _ := h.SessionStore.Get(r, "admin-session")
 	data := map[string]interface{}{
-		"Items":     items,
-		"Flashes":   GetFlash(session),
-		"CsrfField": csrf.TemplateField(r),
+		"Items":       items,
+		"Flashes":     GetFlash(session),
+		"CsrfField":   csrf.TemplateField(r),
+		"CurrentUser": CurrentUser(r),
 	}
 	session.Save(r, w)
 	tmpl.Execute(w, data)
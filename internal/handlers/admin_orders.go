@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/payments"
+	"github.com/alextreichler/crochetbyjuliette/internal/shipping"
+	"github.com/alextreichler/crochetbyjuliette/internal/store"
 	"github.com/gorilla/csrf"
 )
 
@@ -22,13 +31,31 @@ func (h *AdminHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 
 	offset := (page - 1) * limit
 
-	orders, err := h.Store.GetAllOrders(limit, offset)
+	filter := store.OrderFilter{Unpaid: r.URL.Query().Get("filter") == "unpaid"}
+	orders, err := h.Store.GetAllOrders(filter, limit, offset)
 	if err != nil {
 		http.Error(w, "Error fetching orders", http.StatusInternalServerError)
 		return
 	}
 
-	totalOrders, err := h.Store.GetTotalOrdersCount()
+	for i := range orders {
+		if orders[i].Shipments, err = h.Store.ListShipments(orders[i].ID); err != nil {
+			http.Error(w, "Error fetching shipments", http.StatusInternalServerError)
+			return
+		}
+		if err := h.Store.LoadPayments(&orders[i]); err != nil {
+			http.Error(w, "Error fetching payments", http.StatusInternalServerError)
+			return
+		}
+		if orders[i].Status == "Cancelled" {
+			if orders[i].Cancellation, err = h.Store.GetCancellation(orders[i].ID); err != nil {
+				http.Error(w, "Error fetching cancellation", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	totalOrders, err := h.Store.GetTotalOrdersCount(filter)
 	if err != nil {
 		http.Error(w, "Error fetching total order count", http.StatusInternalServerError)
 		return
@@ -53,12 +80,24 @@ func (h *AdminHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 		"CurrentPage": page,
 		"TotalPages":  totalPages,
 		"Limit":       limit,
+		"CurrentUser": CurrentUser(r),
+		"Carriers":    shipping.Carriers,
+		"Filter":      r.URL.Query().Get("filter"),
+		"PaymentMethods": payments.ManualMethods,
+		"CancelReasons": models.CancelReasons,
+		"Today":       time.Now().Format("2006-01-02"),
 	}
 	session.Save(r, w)
 	tmpl.Execute(w, data)
 }
 
 func (h *AdminHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	// The form is multipart so a shipping label can be attached
+	if err := r.ParseMultipartForm(maxLabelSize); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
 	idStr := r.FormValue("id")
 	status := r.FormValue("status")
 	adminComments := r.FormValue("admin_comments")
@@ -69,12 +108,111 @@ func (h *AdminHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	order, err := h.Store.GetOrderByID(id)
+	if err != nil || order == nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	shipments, err := h.Store.ListShipments(id)
+	if err != nil {
+		http.Error(w, "Error fetching shipments", http.StatusInternalServerError)
+		return
+	}
+
+	if !models.ValidOrderStatus(status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	errors := make(map[string]string)
+	// Made-to-order work only starts once the deposit is in, so an order
+	// can't move on from Ordered without it, only be cancelled
+	if order.Status == "Ordered" && status != "Ordered" && status != "Cancelled" && order.Deposit > 0 {
+		if err := h.Store.LoadPayments(order); err != nil {
+			http.Error(w, "Error fetching payments", http.StatusInternalServerError)
+			return
+		}
+		if due := order.DepositDue(); due > 0 {
+			errors["status"] = "Record the " + h.Money.Format(due) + " deposit still owed before moving this order on from Ordered."
+		}
+	}
+	// Cancelling records why and returns stock, so it can't be undone here
+	var cancellation *models.Cancellation
+	if order.Status == "Cancelled" && status != "Cancelled" {
+		errors["status"] = "Cancelled orders can't be reopened."
+	} else if status == "Cancelled" && order.Status != "Cancelled" {
+		var errMsg string
+		cancellation, errMsg = cancellationFromForm(i18n.Printer{Lang: i18n.Source}, r, id, models.CancelledByAdmin)
+		if errMsg != "" {
+			errors["cancel_reason"] = errMsg
+		}
+		cancellation.UserID = CurrentUser(r).ID
+	}
+	shipment := shipmentFromForm(r, id, errors)
+	if len(errors) == 0 && status == "Shipped" && order.DeliveryMethod == "shipping" && shipment == nil && len(shipments) == 0 {
+		errors["tracking_number"] = "Add a tracking number to mark this order as Shipped."
+	}
+	if len(errors) == 0 && shipment != nil {
+		shipment.LabelFile, err = h.saveLabel(r)
+		if err == errNotPDF {
+			errors["label"] = "The shipping label must be a PDF."
+		} else if err != nil {
+			slog.Error("Failed to save shipping label", "order_id", id, "error", err)
+			errors["label"] = "Error saving the shipping label."
+		}
+	}
+	if len(errors) > 0 {
+		for _, msg := range errors {
+			session.AddFlash(FlashMessage{Type: "error", Message: msg})
+		}
+		saveAndRedirect(w, r, session, "/admin/orders")
+		return
+	}
+
+	if shipment != nil {
+		if err := h.Store.CreateShipment(shipment); err != nil {
+			if shipment.LabelFile != "" {
+				os.Remove(filepath.Join(h.LabelsDir, shipment.LabelFile))
+			}
+			http.Error(w, "Error saving shipment", http.StatusInternalServerError)
+			return
+		}
+		shipments = append(shipments, *shipment)
+		slog.Info("Shipment recorded", "user_id", CurrentUser(r).ID, "order_id", id, "shipment_id", shipment.ID, "carrier", shipment.Carrier)
+	}
+
+	if cancellation != nil {
+		cancelled, err := h.Store.CancelOrder(cancellation)
+		if err != nil {
+			slog.Error("Failed to cancel order", "order_id", id, "error", err)
+			http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+			return
+		}
+		// The customer may have cancelled it meanwhile
+		if !cancelled {
+			session.AddFlash(FlashMessage{Type: "error", Message: "This order was already cancelled."})
+			saveAndRedirect(w, r, session, "/admin/orders")
+			return
+		}
+		slog.Info("Order cancelled", "user_id", CurrentUser(r).ID, "order_id", id, "by", cancellation.CancelledBy, "reason", cancellation.Reason)
+	}
 	if err := h.Store.UpdateOrderStatus(id, status, adminComments); err != nil {
 		http.Error(w, "Error updating status", http.StatusInternalServerError)
 		return
 	}
+	if cancellation != nil {
+		order.Status = status
+		if err := h.Store.LoadPayments(order); err != nil {
+			slog.Error("Failed to load payments", "order_id", id, "error", err)
+		}
+		sendCancelledEmail(order, cancellation, h.Money)
+	}
+	if status == "Shipped" && order.Status != "Shipped" && len(shipments) > 0 {
+		h.sendShippedEmail(order, shipments)
+	}
 
-	session, _ := h.SessionStore.Get(r, "admin-session")
 	session.AddFlash(FlashMessage{Type: "success", Message: "Order updated!"})
 	session.Save(r, w)
 	http.Redirect(w, r, "/admin/orders", http.StatusSeeOther)
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/auth"
+	"github.com/gorilla/csrf"
+)
+
+const resetTokenPurpose = "reset"
+
+// resetValidFor matches the lifetime of customer login tokens.
+const resetValidFor = time.Hour
+
+// checkNewPassword applies the configured policy and confirmation check,
+// returning a message for the user or "" when the password is acceptable.
+func (h *AdminHandler) checkNewPassword(password, confirm string) string {
+	if err := h.PasswordPolicy.Validate(password); err != nil {
+		return err.Error()
+	}
+	if password != confirm {
+		return "Passwords do not match."
+	}
+	return ""
+}
+
+func (h *AdminHandler) ChangePasswordForm(w http.ResponseWriter, r *http.Request) {
+	tmpl := h.Templates.Get("admin_change_password.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"PasswordRules": h.PasswordPolicy.Describe(),
+		"CsrfField":     csrf.TemplateField(r),
+		"Flashes":       GetFlash(session),
+		"CurrentUser":   CurrentUser(r),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+func (h *AdminHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	user := CurrentUser(r)
+	current := r.FormValue("current_password")
+	password := r.FormValue("password")
+	confirm := r.FormValue("confirm_password")
+
+	if !auth.CheckPassword(user.Password, current) {
+		slog.Warn("Change password: current password incorrect", "user_id", user.ID)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Your current password is incorrect."})
+		saveAndRedirect(w, r, session, "/admin/account/password")
+		return
+	}
+	if msg := h.checkNewPassword(password, confirm); msg != "" {
+		session.AddFlash(FlashMessage{Type: "error", Message: msg})
+		saveAndRedirect(w, r, session, "/admin/account/password")
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Internal Server Error"})
+		saveAndRedirect(w, r, session, "/admin/account/password")
+		return
+	}
+	if err := h.Store.UpdateUserPassword(user.ID, hashedPassword); err != nil {
+		slog.Error("Failed to change password", "user_id", user.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving your password."})
+		saveAndRedirect(w, r, session, "/admin/account/password")
+		return
+	}
+
+	// Anyone else holding a session for this account is logged out.
+	if _, err := h.SessionStore.RevokeUserSessions(user.ID, session.ID); err != nil {
+		slog.Error("Failed to revoke other sessions", "user_id", user.ID, "error", err)
+	}
+
+	slog.Info("Password changed", "user_id", user.ID)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Password changed successfully!"})
+	saveAndRedirect(w, r, session, "/admin")
+}
+
+func (h *AdminHandler) ForgotPasswordForm(w http.ResponseWriter, r *http.Request) {
+	tmpl := h.Templates.Get("forgot_password.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"CsrfField": csrf.TemplateField(r),
+		"Flashes":   GetFlash(session),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+// SendPasswordReset emails a single-use reset link, in the same way customers
+// receive their order login links.
+func (h *AdminHandler) SendPasswordReset(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	identifier := strings.TrimSpace(r.FormValue("identifier"))
+
+	user, err := h.Store.GetUserByUsername(identifier)
+	if err == nil && user == nil {
+		user, err = h.Store.GetUserByEmail(identifier)
+	}
+	if err != nil {
+		slog.Error("Password reset lookup failed", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Internal Error processing your request."})
+		saveAndRedirect(w, r, session, "/forgot-password")
+		return
+	}
+
+	switch {
+	case user == nil || !user.Active:
+		slog.Info("Password reset requested for unknown or inactive user", "identifier", identifier)
+	case user.Email == "":
+		slog.Warn("Password reset requested but user has no email; use the CLI reset-password command", "user_id", user.ID)
+	default:
+		token := generateToken()
+		if err := h.Store.CreateUserToken(token, user.ID, resetTokenPurpose, resetValidFor); err != nil {
+			slog.Error("Failed to create reset token", "user_id", user.ID, "error", err)
+			session.AddFlash(FlashMessage{Type: "error", Message: "Error generating reset link. Please try again."})
+			saveAndRedirect(w, r, session, "/forgot-password")
+			return
+		}
+
+		// MOCK EMAIL
+		slog.Info("==========================================")
+		slog.Info("📧 EMAIL SENT TO: " + user.Email)
+		slog.Info("Subject: Reset your password - Crochet by Juliette")
+		slog.Info("Reset Link: " + h.BaseURL + "/reset-password?token=" + token)
+		slog.Info("==========================================")
+	}
+
+	// Same message either way so usernames can't be probed
+	session.AddFlash(FlashMessage{Type: "success", Message: "If that account exists and has an email address, a reset link has been sent."})
+	saveAndRedirect(w, r, session, "/login")
+}
+
+func (h *AdminHandler) ResetPasswordForm(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	token := r.URL.Query().Get("token")
+	if _, err := h.Store.GetUserIDByToken(token, resetTokenPurpose); err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid or expired reset link. Please request a new one."})
+		saveAndRedirect(w, r, session, "/forgot-password")
+		return
+	}
+
+	tmpl := h.Templates.Get("reset_password.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Token":         token,
+		"PasswordRules": h.PasswordPolicy.Describe(),
+		"CsrfField":     csrf.TemplateField(r),
+		"Flashes":       GetFlash(session),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+func (h *AdminHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	token := r.FormValue("token")
+	password := r.FormValue("password")
+	confirm := r.FormValue("confirm_password")
+
+	userID, err := h.Store.GetUserIDByToken(token, resetTokenPurpose)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid or expired reset link. Please request a new one."})
+		saveAndRedirect(w, r, session, "/forgot-password")
+		return
+	}
+
+	formURL := "/reset-password?token=" + token
+	if msg := h.checkNewPassword(password, confirm); msg != "" {
+		session.AddFlash(FlashMessage{Type: "error", Message: msg})
+		saveAndRedirect(w, r, session, formURL)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Internal Server Error"})
+		saveAndRedirect(w, r, session, formURL)
+		return
+	}
+	if err := h.Store.UpdateUserPassword(userID, hashedPassword); err != nil {
+		slog.Error("Failed to reset password", "user_id", userID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving your password."})
+		saveAndRedirect(w, r, session, formURL)
+		return
+	}
+	// Reset links are single-use
+	if err := h.Store.DeleteUserTokens(userID, resetTokenPurpose); err != nil {
+		slog.Error("Failed to delete reset tokens", "user_id", userID, "error", err)
+	}
+
+	if _, err := h.SessionStore.RevokeUserSessions(userID, ""); err != nil {
+		slog.Error("Failed to revoke sessions", "user_id", userID, "error", err)
+	}
+
+	slog.Info("Password reset via link", "user_id", userID)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Password reset! You can now log in."})
+	saveAndRedirect(w, r, session, "/login")
+}
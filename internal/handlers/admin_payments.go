@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/payments"
+)
+
+// ordersURL returns to the order list, keeping its filter.
+func ordersURL(r *http.Request) string {
+	if r.FormValue("filter") == "unpaid" {
+		return "/admin/orders?filter=unpaid"
+	}
+	return "/admin/orders"
+}
+
+// RecordPayment records a payment taken outside the payment provider, such
+// as cash or a bank transfer, for part or all of an order.
+func (h *AdminHandler) RecordPayment(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	orderID, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	order, err := h.Store.GetOrderByID(orderID)
+	if err != nil || order == nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	payment := &models.Payment{
+		OrderID:   orderID,
+		Provider:  payments.ProviderManual,
+		Method:    r.FormValue("method"),
+		Reference: strings.TrimSpace(r.FormValue("reference")),
+		Currency:  h.Currency,
+		Status:    payments.StatusPaid,
+		PaidAt:    time.Now(),
+	}
+
+	errors := make(map[string]string)
+	amount, err := strconv.ParseFloat(strings.TrimSpace(r.FormValue("amount")), 64)
+	payment.Amount = currency.Round(amount, h.Currency)
+	if err != nil || !(payment.Amount > 0) || math.IsInf(amount, 1) {
+		errors["amount"] = "Enter the amount received."
+	}
+	if m, ok := payments.LookupMethod(payment.Method); !ok || m.Code == payments.MethodOnline {
+		errors["method"] = "Choose how the payment was made."
+	}
+	if len(payment.Reference) > 100 {
+		errors["reference"] = "The reference is too long."
+	}
+	if v := r.FormValue("paid_at"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			errors["paid_at"] = "Invalid payment date."
+		} else if t.After(time.Now()) {
+			errors["paid_at"] = "The payment date can't be in the future."
+		} else {
+			payment.PaidAt = t
+		}
+	}
+	if len(errors) > 0 {
+		for _, msg := range errors {
+			session.AddFlash(FlashMessage{Type: "error", Message: msg})
+		}
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+
+	if err := h.Store.CreatePayment(payment); err != nil {
+		slog.Error("Failed to record payment", "order_id", orderID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error recording payment."})
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+
+	slog.Info("Payment recorded", "user_id", CurrentUser(r).ID, "order_id", orderID, "payment_id", payment.ID, "amount", payment.Amount, "method", payment.Method)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Payment of " + h.Money.Format(payment.Amount) + " recorded for order " + order.OrderRef + "."})
+	saveAndRedirect(w, r, session, ordersURL(r))
+}
+
+// DeletePayment removes a payment recorded by mistake. Payments taken by
+// the payment provider can't be deleted; they are refunded there instead.
+func (h *AdminHandler) DeletePayment(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	payment, err := h.Store.GetPayment(id)
+	if err != nil || payment == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Payment not found."})
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+	if !payment.IsManual() {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Online payments can't be removed."})
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+	if err := h.Store.DeletePayment(id); err != nil {
+		slog.Error("Failed to delete payment", "payment_id", id, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error removing payment."})
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+
+	slog.Info("Payment deleted", "user_id", CurrentUser(r).ID, "order_id", payment.OrderID, "payment_id", id, "amount", payment.Amount)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Payment removed."})
+	saveAndRedirect(w, r, session, ordersURL(r))
+}
+
+// RecordRefund records money given back to the customer outside the payment
+// provider. Refunds made through the provider are recorded from its
+// webhooks instead.
+func (h *AdminHandler) RecordRefund(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	orderID, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	order, err := h.Store.GetOrderByID(orderID)
+	if err != nil || order == nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err := h.Store.LoadPayments(order); err != nil {
+		http.Error(w, "Error fetching payments", http.StatusInternalServerError)
+		return
+	}
+
+	refund := &models.Refund{
+		OrderID:   orderID,
+		Method:    r.FormValue("method"),
+		Reference: strings.TrimSpace(r.FormValue("reference")),
+		Note:      strings.TrimSpace(r.FormValue("note")),
+	}
+
+	errors := make(map[string]string)
+	amount, err := strconv.ParseFloat(strings.TrimSpace(r.FormValue("amount")), 64)
+	refund.Amount = currency.Round(amount, h.Currency)
+	if err != nil || !(refund.Amount > 0) || math.IsInf(amount, 1) {
+		errors["amount"] = "Enter the amount refunded."
+	} else if refund.Amount > order.AmountPaid() {
+		errors["amount"] = "You can't refund more than the " + h.Money.Format(order.AmountPaid()) + " paid."
+	}
+	if m, ok := payments.LookupMethod(refund.Method); !ok || m.Code == payments.MethodOnline {
+		errors["method"] = "Choose how the money was given back."
+	}
+	if len(refund.Reference) > 100 {
+		errors["reference"] = "The reference is too long."
+	}
+	if len(refund.Note) > 1000 {
+		errors["note"] = "The note is too long."
+	}
+	if len(errors) > 0 {
+		for _, msg := range errors {
+			session.AddFlash(FlashMessage{Type: "error", Message: msg})
+		}
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+
+	if err := h.Store.CreateRefund(refund); err != nil {
+		slog.Error("Failed to record refund", "order_id", orderID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error recording refund."})
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+
+	slog.Info("Refund recorded", "user_id", CurrentUser(r).ID, "order_id", orderID, "refund_id", refund.ID, "amount", refund.Amount, "method", refund.Method)
+	sendRefundEmail(order, refund, h.Money)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Refund of " + h.Money.Format(refund.Amount) + " recorded for order " + order.OrderRef + "."})
+	saveAndRedirect(w, r, session, ordersURL(r))
+}
+
+// DeleteRefund removes a refund recorded by mistake. Refunds made through
+// the payment provider can't be deleted.
+func (h *AdminHandler) DeleteRefund(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	refund, err := h.Store.GetRefund(id)
+	if err != nil || refund == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Refund not found."})
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+	if !refund.IsManual() {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Online refunds can't be removed."})
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+	if err := h.Store.DeleteRefund(id); err != nil {
+		slog.Error("Failed to delete refund", "refund_id", id, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error removing refund."})
+		saveAndRedirect(w, r, session, ordersURL(r))
+		return
+	}
+
+	slog.Info("Refund deleted", "user_id", CurrentUser(r).ID, "order_id", refund.OrderID, "refund_id", id, "amount", refund.Amount)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Refund removed."})
+	saveAndRedirect(w, r, session, ordersURL(r))
+}
+
+// sendRefundEmail tells the customer about a refund.
+func sendRefundEmail(order *models.Order, refund *models.Refund, money currency.Formatter) {
+	// MOCK EMAIL
+	slog.Info("==========================================")
+	slog.Info("📧 EMAIL SENT TO: " + order.CustomerEmail)
+	slog.Info("Subject: Refund issued - Crochet by Juliette")
+	slog.Info("Order Reference: " + order.OrderRef)
+	slog.Info("Amount: " + money.Format(refund.Amount) + " (" + refund.MethodLabel() + ")")
+	slog.Info("==========================================")
+}
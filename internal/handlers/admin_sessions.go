@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/gorilla/csrf"
+)
+
+// ListSessions shows the current user's active logins. Users who manage
+// accounts see everyone's.
+func (h *AdminHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	user := CurrentUser(r)
+
+	userID := user.ID
+	if user.Can(models.PermManageUsers) {
+		userID = 0
+	}
+	list, err := h.SessionStore.ActiveSessions(userID, session.ID)
+	if err != nil {
+		http.Error(w, "Error fetching sessions", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := h.Templates.Get("admin_sessions.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Sessions":    list,
+		"ShowUsers":   userID == 0,
+		"CsrfField":   csrf.TemplateField(r),
+		"Flashes":     GetFlash(session),
+		"CurrentUser": user,
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+// RevokeSession ends a single session. Users may end their own sessions;
+// ending someone else's requires permission to manage users.
+func (h *AdminHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	user := CurrentUser(r)
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid session."})
+		saveAndRedirect(w, r, session, "/admin/account/sessions")
+		return
+	}
+
+	ownerID, err := h.SessionStore.GetSessionUserID(id)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Internal Server Error"})
+		saveAndRedirect(w, r, session, "/admin/account/sessions")
+		return
+	}
+	if ownerID == 0 {
+		session.AddFlash(FlashMessage{Type: "error", Message: "That session has already ended."})
+		saveAndRedirect(w, r, session, "/admin/account/sessions")
+		return
+	}
+	if ownerID != user.ID && !user.Can(models.PermManageUsers) {
+		slog.Warn("Permission denied revoking session", "user_id", user.ID, "session_owner", ownerID)
+		session.AddFlash(FlashMessage{Type: "error", Message: "You don't have permission to do that."})
+		saveAndRedirect(w, r, session, "/admin/account/sessions")
+		return
+	}
+
+	if err := h.SessionStore.RevokeSession(id); err != nil {
+		slog.Error("Failed to revoke session", "session", id, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error ending session."})
+		saveAndRedirect(w, r, session, "/admin/account/sessions")
+		return
+	}
+
+	slog.Info("Session revoked", "revoked_by", user.ID, "session_owner", ownerID, "session", id)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Session ended."})
+	// If that was this session, the save below is a no-op and the
+	// redirect lands on the login page.
+	saveAndRedirect(w, r, session, "/admin/account/sessions")
+}
+
+// RevokeOtherSessions logs the current user out everywhere except here.
+func (h *AdminHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	user := CurrentUser(r)
+
+	n, err := h.SessionStore.RevokeUserSessions(user.ID, session.ID)
+	if err != nil {
+		slog.Error("Failed to revoke sessions", "user_id", user.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error ending sessions."})
+		saveAndRedirect(w, r, session, "/admin/account/sessions")
+		return
+	}
+
+	slog.Info("Logged out everywhere else", "user_id", user.ID, "sessions", n)
+	session.AddFlash(FlashMessage{Type: "success", Message: fmt.Sprintf("Logged out of %d other session%s.", n, plural(int(n)))})
+	saveAndRedirect(w, r, session, "/admin/account/sessions")
+}
+
+// DeviceLabel turns a User-Agent header into a short description such as
+// "Firefox on Windows" for the sessions page.
+func DeviceLabel(userAgent string) string {
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(userAgent, "curl/"):
+		browser = "curl"
+	}
+
+	os := ""
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		os = "iOS"
+	case strings.Contains(userAgent, "Android"):
+		os = "Android"
+	case strings.Contains(userAgent, "Windows"):
+		os = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		os = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		os = "Linux"
+	}
+
+	if os == "" {
+		return browser
+	}
+	return browser + " on " + os
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/shipping"
+	"github.com/google/uuid"
+)
+
+// maxLabelSize caps uploaded shipping label PDFs.
+const maxLabelSize = 10 << 20
+
+var errNotPDF = fmt.Errorf("label is not a PDF")
+
+// shipmentFromForm reads the optional shipment fields of the order status
+// form. It returns nil if no tracking number was entered, and adds a message
+// to errors for anything invalid. The label file is only checked here;
+// saveLabel stores it.
+func shipmentFromForm(r *http.Request, orderID int, errors map[string]string) *models.Shipment {
+	tracking := strings.Join(strings.Fields(r.FormValue("tracking_number")), "")
+	carrier := r.FormValue("carrier")
+	_, _, labelErr := r.FormFile("label")
+	if tracking == "" {
+		if labelErr == nil {
+			errors["tracking_number"] = "Enter the tracking number for this label."
+		}
+		return nil
+	}
+
+	if _, ok := shipping.LookupCarrier(carrier); !ok {
+		errors["carrier"] = "Please choose a carrier."
+	}
+	if len(tracking) > 64 {
+		errors["tracking_number"] = "That tracking number is too long."
+	}
+	shippedAt := time.Now()
+	if v := r.FormValue("shipped_at"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			errors["shipped_at"] = "Invalid ship date."
+		} else if t.After(time.Now()) {
+			errors["shipped_at"] = "The ship date can't be in the future."
+		} else {
+			shippedAt = t
+		}
+	}
+	return &models.Shipment{OrderID: orderID, Carrier: carrier, TrackingNumber: tracking, ShippedAt: shippedAt}
+}
+
+// saveLabel stores the uploaded label PDF, if any, and returns its file name
+// in the labels directory ("" if none was uploaded).
+func (h *AdminHandler) saveLabel(r *http.Request) (string, error) {
+	file, header, err := r.FormFile("label")
+	if err == http.ErrMissingFile {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if header.Size > maxLabelSize {
+		return "", fmt.Errorf("label is %d bytes, over the %d byte limit", header.Size, maxLabelSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxLabelSize+1))
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", errNotPDF
+	}
+
+	if err := os.MkdirAll(h.LabelsDir, 0o750); err != nil {
+		return "", err
+	}
+	name := uuid.New().String() + ".pdf"
+	if err := os.WriteFile(filepath.Join(h.LabelsDir, name), data, 0o640); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// ShipmentLabel serves a shipment's label PDF to admins.
+func (h *AdminHandler) ShipmentLabel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	shipment, err := h.Store.GetShipment(id)
+	if err != nil {
+		http.Error(w, "Error fetching shipment", http.StatusInternalServerError)
+		return
+	}
+	if shipment == nil || shipment.LabelFile == "" {
+		http.Error(w, "Label not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(h.LabelsDir, filepath.Base(shipment.LabelFile)))
+	if err != nil {
+		slog.Error("Failed to open shipping label", "shipment_id", id, "error", err)
+		http.Error(w, "Label not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Label not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="label-%d.pdf"`, shipment.ID))
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// DeleteShipment removes a shipment recorded by mistake, with its label.
+func (h *AdminHandler) DeleteShipment(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid ID."})
+		saveAndRedirect(w, r, session, "/admin/orders")
+		return
+	}
+	shipment, err := h.Store.GetShipment(id)
+	if err != nil || shipment == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Shipment not found."})
+		saveAndRedirect(w, r, session, "/admin/orders")
+		return
+	}
+	if err := h.Store.DeleteShipment(id); err != nil {
+		slog.Error("Failed to delete shipment", "shipment_id", id, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error deleting shipment."})
+		saveAndRedirect(w, r, session, "/admin/orders")
+		return
+	}
+	if shipment.LabelFile != "" {
+		if err := os.Remove(filepath.Join(h.LabelsDir, filepath.Base(shipment.LabelFile))); err != nil {
+			slog.Warn("Failed to remove shipping label", "shipment_id", id, "error", err)
+		}
+	}
+
+	slog.Info("Shipment deleted", "user_id", CurrentUser(r).ID, "order_id", shipment.OrderID, "shipment_id", id)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Shipment removed."})
+	saveAndRedirect(w, r, session, "/admin/orders")
+}
+
+// sendShippedEmail tells the customer their order is on its way, with a
+// tracking link per parcel. Customers who turned off order updates in their
+// account don't get it.
+func (h *AdminHandler) sendShippedEmail(order *models.Order, shipments []models.Shipment) {
+	if order.CustomerID != 0 {
+		customer, err := h.Store.GetCustomerByID(order.CustomerID)
+		if err != nil {
+			slog.Error("Failed to load customer for shipping email", "order_id", order.ID, "error", err)
+		} else if customer != nil && !customer.OrderUpdates {
+			return
+		}
+	}
+
+	// MOCK EMAIL
+	slog.Info("==========================================")
+	slog.Info("📧 EMAIL SENT TO: " + order.CustomerEmail)
+	slog.Info("Subject: Your order has shipped - Crochet by Juliette")
+	slog.Info("Order Reference: " + order.OrderRef)
+	for _, s := range shipments {
+		line := "Shipped " + s.ShippedAt.Format("Jan 2") + " via " + s.CarrierName() + ", tracking number " + s.TrackingNumber
+		if url := s.TrackingURL(); url != "" {
+			line += ": " + url
+		}
+		slog.Info(line)
+	}
+	slog.Info("Open your order from the link in your confirmation email for details.")
+	slog.Info("==========================================")
+}
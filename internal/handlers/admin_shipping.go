@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+	"github.com/alextreichler/crochetbyjuliette/internal/shipping"
+	"github.com/gorilla/csrf"
+)
+
+func (h *AdminHandler) ListShipping(w http.ResponseWriter, r *http.Request) {
+	table, err := h.Store.ShippingTable()
+	if err != nil {
+		slog.Error("Failed to load shipping methods", "error", err)
+		http.Error(w, "Error fetching shipping methods", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := h.Templates.Get("admin_shipping.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Zones":       table.Zones,
+		"Methods":     table.Methods,
+		"CsrfField":   csrf.TemplateField(r),
+		"Flashes":     GetFlash(session),
+		"CurrentUser": CurrentUser(r),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+// ShippingZoneForm shows the form for a new zone, or for the zone in ?id=.
+func (h *AdminHandler) ShippingZoneForm(w http.ResponseWriter, r *http.Request) {
+	zone := &shipping.Zone{}
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		zone, err = h.Store.GetShippingZone(id)
+		if err != nil {
+			http.Error(w, "Error fetching zone", http.StatusInternalServerError)
+			return
+		}
+		if zone == nil {
+			http.Error(w, "Zone not found", http.StatusNotFound)
+			return
+		}
+	}
+	h.renderShippingZoneForm(w, r, zone, nil)
+}
+
+func (h *AdminHandler) renderShippingZoneForm(w http.ResponseWriter, r *http.Request, zone *shipping.Zone, errors map[string]string) {
+	tmpl := h.Templates.Get("admin_edit_shipping_zone.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	selected := make(map[string]bool)
+	for _, c := range zone.Countries {
+		selected[c] = true
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Zone":      zone,
+		"Selected":  selected,
+		"Countries": address.Countries,
+		"Errors":    errors,
+		"CsrfField": csrf.TemplateField(r),
+		"Flashes":   GetFlash(session),
+	}
+	session.Save(r, w)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	tmpl.Execute(w, data)
+}
+
+// zoneFromForm reads and validates the zone form. Besides the zone's own
+// rules, a country may only be in one zone and only one zone may cover the
+// rest of the world.
+func (h *AdminHandler) zoneFromForm(r *http.Request) (*shipping.Zone, map[string]string, error) {
+	r.ParseForm()
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	zone := &shipping.Zone{
+		ID:        id,
+		Name:      strings.TrimSpace(r.FormValue("name")),
+		Countries: shipping.ParseCountries(strings.Join(r.Form["countries"], ",")),
+	}
+	errors := zone.Validate()
+
+	zones, err := h.Store.ListShippingZones()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, other := range zones {
+		if other.ID == zone.ID {
+			continue
+		}
+		if zone.IsRestOfWorld() && other.IsRestOfWorld() {
+			errors["countries"] = other.Name + " already covers the rest of the world. Choose some countries."
+			break
+		}
+		for _, c := range zone.Countries {
+			if other.Covers(c) {
+				errors["countries"] = c + " is already in " + other.Name + "."
+				break
+			}
+		}
+	}
+	return zone, errors, nil
+}
+
+func (h *AdminHandler) CreateShippingZone(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	zone, errors, err := h.zoneFromForm(r)
+	if err != nil {
+		slog.Error("Failed to load shipping zones", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving zone."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+	zone.ID = 0
+	if len(errors) > 0 {
+		h.renderShippingZoneForm(w, r, zone, errors)
+		return
+	}
+
+	if err := h.Store.CreateShippingZone(zone); err != nil {
+		slog.Error("Failed to create shipping zone", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving zone."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+
+	slog.Info("Shipping zone created", "user_id", CurrentUser(r).ID, "name", zone.Name)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Zone added. Add a shipping method to it next."})
+	saveAndRedirect(w, r, session, "/admin/shipping")
+}
+
+func (h *AdminHandler) UpdateShippingZone(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	zone, errors, err := h.zoneFromForm(r)
+	if err != nil {
+		slog.Error("Failed to load shipping zones", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving zone."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+	if len(errors) > 0 {
+		h.renderShippingZoneForm(w, r, zone, errors)
+		return
+	}
+
+	if err := h.Store.UpdateShippingZone(zone); err != nil {
+		slog.Error("Failed to update shipping zone", "zone_id", zone.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving zone."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+
+	slog.Info("Shipping zone updated", "user_id", CurrentUser(r).ID, "zone_id", zone.ID)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Zone updated."})
+	saveAndRedirect(w, r, session, "/admin/shipping")
+}
+
+func (h *AdminHandler) DeleteShippingZone(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid ID."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+	if err := h.Store.DeleteShippingZone(id); err != nil {
+		slog.Error("Failed to delete shipping zone", "zone_id", id, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error deleting zone."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+
+	slog.Info("Shipping zone deleted", "user_id", CurrentUser(r).ID, "zone_id", id)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Zone and its methods deleted."})
+	saveAndRedirect(w, r, session, "/admin/shipping")
+}
+
+// ShippingMethodForm shows the form for a new method, or for the method in
+// ?id=. A new method can be started in a zone with ?zone_id=, or as a pickup
+// method with ?kind=pickup.
+func (h *AdminHandler) ShippingMethodForm(w http.ResponseWriter, r *http.Request) {
+	method := &shipping.Method{Kind: shipping.KindFlat, Active: true}
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		method, err = h.Store.GetShippingMethod(id)
+		if err != nil {
+			http.Error(w, "Error fetching method", http.StatusInternalServerError)
+			return
+		}
+		if method == nil {
+			http.Error(w, "Method not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		method.ZoneID, _ = strconv.Atoi(r.URL.Query().Get("zone_id"))
+		if r.URL.Query().Get("kind") == shipping.KindPickup {
+			method.Kind = shipping.KindPickup
+		}
+	}
+	h.renderShippingMethodForm(w, r, method, nil)
+}
+
+func (h *AdminHandler) renderShippingMethodForm(w http.ResponseWriter, r *http.Request, method *shipping.Method, errors map[string]string) {
+	zones, err := h.Store.ListShippingZones()
+	if err != nil {
+		http.Error(w, "Error fetching zones", http.StatusInternalServerError)
+		return
+	}
+	tmpl := h.Templates.Get("admin_edit_shipping_method.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Method":    method,
+		"Zones":     zones,
+		"Kinds":     shipping.Kinds,
+		"Errors":    errors,
+		"CsrfField": csrf.TemplateField(r),
+		"Flashes":   GetFlash(session),
+	}
+	session.Save(r, w)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	tmpl.Execute(w, data)
+}
+
+// methodFromForm reads and validates the method form. Blank amounts count
+// as zero.
+func methodFromForm(r *http.Request) (*shipping.Method, map[string]string) {
+	errors := make(map[string]string)
+	number := func(field string) float64 {
+		v := strings.TrimSpace(r.FormValue(field))
+		if v == "" {
+			return 0
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errors[field] = "Please enter a number."
+		}
+		return n
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	zoneID, _ := strconv.Atoi(r.FormValue("zone_id"))
+	method := &shipping.Method{
+		ID:             id,
+		ZoneID:         zoneID,
+		Name:           strings.TrimSpace(r.FormValue("name")),
+		Kind:           r.FormValue("kind"),
+		Active:         r.FormValue("active") == "on",
+		BaseFee:        number("base_fee"),
+		PerKg:          number("per_kg"),
+		MaxWeightGrams: int(number("max_weight_grams")),
+		FreeOver:       number("free_over"),
+	}
+	// Pickup is offered everywhere and is free, so the other settings don't apply
+	if method.IsPickup() {
+		method.ZoneID = 0
+		method.BaseFee, method.PerKg, method.MaxWeightGrams, method.FreeOver = 0, 0, 0, 0
+	}
+	if method.Kind != shipping.KindWeight {
+		method.PerKg = 0
+	}
+	for field, msg := range method.Validate() {
+		if errors[field] == "" {
+			errors[field] = msg
+		}
+	}
+	return method, errors
+}
+
+func (h *AdminHandler) CreateShippingMethod(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	method, errors := methodFromForm(r)
+	method.ID = 0
+	if len(errors) > 0 {
+		h.renderShippingMethodForm(w, r, method, errors)
+		return
+	}
+
+	if err := h.Store.CreateShippingMethod(method); err != nil {
+		slog.Error("Failed to create shipping method", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving shipping method."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+
+	slog.Info("Shipping method created", "user_id", CurrentUser(r).ID, "name", method.Name)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Shipping method added."})
+	saveAndRedirect(w, r, session, "/admin/shipping")
+}
+
+func (h *AdminHandler) UpdateShippingMethod(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	method, errors := methodFromForm(r)
+	if len(errors) > 0 {
+		h.renderShippingMethodForm(w, r, method, errors)
+		return
+	}
+
+	if err := h.Store.UpdateShippingMethod(method); err != nil {
+		slog.Error("Failed to update shipping method", "method_id", method.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving shipping method."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+
+	slog.Info("Shipping method updated", "user_id", CurrentUser(r).ID, "method_id", method.ID)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Shipping method updated."})
+	saveAndRedirect(w, r, session, "/admin/shipping")
+}
+
+func (h *AdminHandler) DeleteShippingMethod(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid ID."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+	if err := h.Store.DeleteShippingMethod(id); err != nil {
+		slog.Error("Failed to delete shipping method", "method_id", id, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error deleting shipping method."})
+		saveAndRedirect(w, r, session, "/admin/shipping")
+		return
+	}
+
+	slog.Info("Shipping method deleted", "user_id", CurrentUser(r).ID, "method_id", id)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Shipping method deleted."})
+	saveAndRedirect(w, r, session, "/admin/shipping")
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/auth"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/sessions"
+	"rsc.io/qr"
+)
+
+const totpIssuer = "Crochet by Juliette"
+
+// Session keys used between the password step and the code step of a login.
+const (
+	pendingTwoFactorUserKey     = "2fa_user_id"
+	pendingTwoFactorSinceKey    = "2fa_since"
+	pendingTwoFactorAttemptsKey = "2fa_attempts"
+)
+
+const (
+	// twoFactorLoginWindow is how long after the password step a code is accepted.
+	twoFactorLoginWindow = 5 * time.Minute
+	// maxTwoFactorAttempts wrong codes send the user back to the password step.
+	maxTwoFactorAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+func clearPendingTwoFactor(session *sessions.Session) {
+	delete(session.Values, pendingTwoFactorUserKey)
+	delete(session.Values, pendingTwoFactorSinceKey)
+	delete(session.Values, pendingTwoFactorAttemptsKey)
+}
+
+// pendingTwoFactorUser returns the user who passed the password step in this
+// session, or nil if there is none or it has expired.
+func (h *AdminHandler) pendingTwoFactorUser(session *sessions.Session) (*models.User, error) {
+	userID, ok := session.Values[pendingTwoFactorUserKey].(int)
+	if !ok {
+		return nil, nil
+	}
+	since, _ := session.Values[pendingTwoFactorSinceKey].(int64)
+	if time.Since(time.Unix(since, 0)) > twoFactorLoginWindow {
+		return nil, nil
+	}
+	user, err := h.Store.GetUserByID(userID)
+	if err != nil || user == nil || !user.Active || !user.TOTPEnabled {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (h *AdminHandler) LoginTwoFactorForm(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	user, err := h.pendingTwoFactorUser(session)
+	if err != nil || user == nil {
+		clearPendingTwoFactor(session)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Please log in again."})
+		saveAndRedirect(w, r, session, "/login")
+		return
+	}
+
+	tmpl := h.Templates.Get("login_2fa.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"CsrfField": csrf.TemplateField(r),
+		"Flashes":   GetFlash(session),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+// LoginTwoFactor accepts either a current TOTP code or an unused recovery code.
+func (h *AdminHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	user, err := h.pendingTwoFactorUser(session)
+	if err != nil || user == nil {
+		clearPendingTwoFactor(session)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Please log in again."})
+		saveAndRedirect(w, r, session, "/login")
+		return
+	}
+
+	attemptKey := normalizeLoginUsername(user.Username)
+	wait, err := h.loginWait(attemptKey, ClientIP(r))
+	if err != nil {
+		slog.Error("Failed to check login attempts", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Internal Server Error"})
+		saveAndRedirect(w, r, session, "/login/2fa")
+		return
+	}
+	if wait > 0 {
+		h.recordLoginAttempt(r, attemptKey, false, loginReasonThrottled)
+		session.AddFlash(FlashMessage{Type: "error", Message: waitMessage(wait)})
+		saveAndRedirect(w, r, session, "/login/2fa")
+		return
+	}
+
+	code := strings.TrimSpace(r.FormValue("code"))
+	verified := false
+	if step, ok := auth.VerifyTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		// A concurrent request may have just accepted the same code
+		used, err := h.Store.UseTOTPStep(user.ID, step)
+		if err != nil {
+			slog.Error("Failed to record TOTP step", "user_id", user.ID, "error", err)
+			session.AddFlash(FlashMessage{Type: "error", Message: "Internal Server Error"})
+			saveAndRedirect(w, r, session, "/login/2fa")
+			return
+		}
+		if !used {
+			slog.Warn("Replayed TOTP code rejected", "user_id", user.ID)
+		}
+		verified = used
+	} else if len(code) > 6 {
+		used, err := h.Store.UseRecoveryCode(user.ID, auth.HashRecoveryCode(code))
+		if err != nil {
+			slog.Error("Failed to check recovery code", "user_id", user.ID, "error", err)
+		}
+		if used {
+			slog.Warn("Recovery code used for login", "user_id", user.ID)
+			session.AddFlash(FlashMessage{Type: "error", Message: "You logged in with a recovery code. Consider generating new codes."})
+			verified = true
+		}
+	}
+
+	if !verified {
+		attempts, _ := session.Values[pendingTwoFactorAttemptsKey].(int)
+		attempts++
+		h.recordLoginAttempt(r, attemptKey, false, loginReasonBad2FACode)
+		if attempts >= maxTwoFactorAttempts {
+			clearPendingTwoFactor(session)
+			session.AddFlash(FlashMessage{Type: "error", Message: "Too many invalid codes. Please log in again."})
+			saveAndRedirect(w, r, session, "/login")
+			return
+		}
+		session.Values[pendingTwoFactorAttemptsKey] = attempts
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid authentication code."})
+		saveAndRedirect(w, r, session, "/login/2fa")
+		return
+	}
+
+	h.completeLogin(w, r, session, user)
+}
+
+// TwoFactorSettings shows the 2FA status, or the enrollment QR code if 2FA is off.
+func (h *AdminHandler) TwoFactorSettings(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	data := map[string]interface{}{}
+
+	if user.TOTPEnabled {
+		remaining, err := h.Store.CountUnusedRecoveryCodes(user.ID)
+		if err != nil {
+			http.Error(w, "Error fetching recovery codes", http.StatusInternalServerError)
+			return
+		}
+		data["RecoveryCodesLeft"] = remaining
+	} else {
+		// Keep an existing pending secret so reloading doesn't invalidate a scanned code.
+		secret := user.TOTPSecret
+		if secret == "" {
+			var err error
+			if secret, err = auth.GenerateTOTPSecret(); err != nil {
+				http.Error(w, "Error generating secret", http.StatusInternalServerError)
+				return
+			}
+			if err := h.Store.SetPendingTOTPSecret(user.ID, secret); err != nil {
+				http.Error(w, "Error saving secret", http.StatusInternalServerError)
+				return
+			}
+		}
+		uri := auth.TOTPProvisioningURI(totpIssuer, user.Username, secret)
+		data["Secret"] = secret
+		data["ProvisioningURI"] = uri
+		if code, err := qr.Encode(uri, qr.M); err == nil {
+			data["QRCode"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG()))
+		} else {
+			slog.Error("Failed to render QR code", "error", err)
+		}
+	}
+
+	h.renderTwoFactorSettings(w, r, data)
+}
+
+func (h *AdminHandler) renderTwoFactorSettings(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	tmpl := h.Templates.Get("admin_two_factor.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data["CsrfField"] = csrf.TemplateField(r)
+	data["Flashes"] = GetFlash(session)
+	data["CurrentUser"] = CurrentUser(r)
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+// newRecoveryCodes generates codes to show the user and the hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// EnableTwoFactor confirms enrollment with a code from the app and shows the
+// recovery codes once.
+func (h *AdminHandler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	user := CurrentUser(r)
+
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+
+	step, ok := auth.VerifyTOTP(user.TOTPSecret, r.FormValue("code"), time.Now(), 0)
+	if !ok {
+		session.AddFlash(FlashMessage{Type: "error", Message: "That code didn't match. Check your authenticator app and try again."})
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Internal Server Error"})
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+	if err := h.Store.EnableTOTP(user.ID, step, hashes); err != nil {
+		slog.Error("Failed to enable 2FA", "user_id", user.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error enabling two-factor authentication."})
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+
+	slog.Info("2FA enabled", "user_id", user.ID)
+	user.TOTPEnabled = true
+	session.AddFlash(FlashMessage{Type: "success", Message: "Two-factor authentication is now on."})
+	h.renderTwoFactorSettings(w, r, map[string]interface{}{
+		"RecoveryCodes":     codes,
+		"RecoveryCodesLeft": len(codes),
+	})
+}
+
+func (h *AdminHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	user := CurrentUser(r)
+
+	if !auth.CheckPassword(user.Password, r.FormValue("password")) {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Your password is incorrect."})
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+	if err := h.Store.DisableTOTP(user.ID); err != nil {
+		slog.Error("Failed to disable 2FA", "user_id", user.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error disabling two-factor authentication."})
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+
+	slog.Warn("2FA disabled", "user_id", user.ID)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Two-factor authentication has been turned off."})
+	saveAndRedirect(w, r, session, "/admin")
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current code.
+func (h *AdminHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	user := CurrentUser(r)
+
+	if !user.TOTPEnabled {
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+	step, ok := auth.VerifyTOTP(user.TOTPSecret, r.FormValue("code"), time.Now(), user.TOTPLastStep)
+	if !ok {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid authentication code."})
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+
+	used, err := h.Store.UseTOTPStep(user.ID, step)
+	if err == nil && !used {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid authentication code."})
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+	var codes, hashes []string
+	if err == nil {
+		codes, hashes, err = newRecoveryCodes()
+	}
+	if err == nil {
+		err = h.Store.ReplaceRecoveryCodes(user.ID, hashes)
+	}
+	if err != nil {
+		slog.Error("Failed to regenerate recovery codes", "user_id", user.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error generating recovery codes."})
+		saveAndRedirect(w, r, session, "/admin/account/2fa")
+		return
+	}
+
+	slog.Info("Recovery codes regenerated", "user_id", user.ID)
+	session.AddFlash(FlashMessage{Type: "success", Message: "New recovery codes generated. The old ones no longer work."})
+	h.renderTwoFactorSettings(w, r, map[string]interface{}{
+		"RecoveryCodes":     codes,
+		"RecoveryCodesLeft": len(codes),
+	})
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/auth"
+	"github.com/alextreichler/crochetbyjuliette/internal/emailaddr"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/gorilla/csrf"
+)
+
+const inviteTokenPurpose = "invite"
+
+// inviteValidFor is how long an invite link can be used to set a password.
+const inviteValidFor = 7 * 24 * time.Hour
+
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.Store.ListUsers()
+	if err != nil {
+		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := h.Templates.Get("admin_users.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Users":       users,
+		"Roles":       models.Roles,
+		"CsrfField":   csrf.TemplateField(r),
+		"Flashes":     GetFlash(session),
+		"CurrentUser": CurrentUser(r),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+func (h *AdminHandler) InviteUser(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	email := strings.TrimSpace(r.FormValue("email"))
+	role := r.FormValue("role")
+
+	errors := make(map[string]string)
+	if username == "" {
+		errors["username"] = "Username is required."
+	}
+	if email == "" {
+		errors["email"] = "Email address is required to send the invite."
+	} else if normalized, err := emailaddr.Normalize(email); err != nil {
+		errors["email"] = "Please enter a valid email address."
+	} else {
+		email = normalized
+	}
+	if !models.ValidRole(role) {
+		errors["role"] = "Invalid role selected."
+	}
+	if username != "" {
+		existing, err := h.Store.GetUserByUsername(username)
+		if err != nil {
+			session.AddFlash(FlashMessage{Type: "error", Message: "Internal Server Error"})
+			saveAndRedirect(w, r, session, "/admin/users")
+			return
+		}
+		if existing != nil {
+			errors["username"] = "That username is already taken."
+		}
+	}
+
+	if len(errors) > 0 {
+		for _, msg := range errors {
+			session.AddFlash(FlashMessage{Type: "error", Message: msg})
+		}
+		saveAndRedirect(w, r, session, "/admin/users")
+		return
+	}
+
+	userID, err := h.Store.CreateInvitedUser(username, email, role)
+	if err != nil {
+		slog.Error("Failed to create invited user", "username", username, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error creating user."})
+		saveAndRedirect(w, r, session, "/admin/users")
+		return
+	}
+
+	token := generateToken()
+	if err := h.Store.CreateUserToken(token, userID, inviteTokenPurpose, inviteValidFor); err != nil {
+		slog.Error("Failed to create invite token", "user_id", userID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "User created, but the invite link could not be generated."})
+		saveAndRedirect(w, r, session, "/admin/users")
+		return
+	}
+
+	// MOCK EMAIL
+	slog.Info("==========================================")
+	slog.Info("📧 EMAIL SENT TO: " + email)
+	slog.Info("Subject: You've been invited to Crochet by Juliette")
+	slog.Info("Set your password: " + h.BaseURL + "/invite?token=" + token)
+	slog.Info("==========================================")
+
+	slog.Info("User invited", "invited_by", CurrentUser(r).ID, "user_id", userID, "role", role)
+	session.AddFlash(FlashMessage{Type: "success", Message: fmt.Sprintf("Invitation sent to %s.", email)})
+	saveAndRedirect(w, r, session, "/admin/users")
+}
+
+func (h *AdminHandler) EditUserForm(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Store.GetUserByID(id)
+	if err != nil {
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	tmpl := h.Templates.Get("admin_edit_user.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"User":        user,
+		"Roles":       models.Roles,
+		"CsrfField":   csrf.TemplateField(r),
+		"Flashes":     GetFlash(session),
+		"CurrentUser": CurrentUser(r),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+func (h *AdminHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid ID."})
+		saveAndRedirect(w, r, session, "/admin/users")
+		return
+	}
+	editURL := fmt.Sprintf("/admin/users/edit?id=%d", id)
+
+	user, err := h.Store.GetUserByID(id)
+	if err != nil || user == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "User not found."})
+		saveAndRedirect(w, r, session, "/admin/users")
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	role := r.FormValue("role")
+	active := r.FormValue("active") == "on"
+
+	if !models.ValidRole(role) {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid role selected."})
+		saveAndRedirect(w, r, session, editURL)
+		return
+	}
+	if email != "" {
+		normalized, err := emailaddr.Normalize(email)
+		if err != nil {
+			session.AddFlash(FlashMessage{Type: "error", Message: "Please enter a valid email address."})
+			saveAndRedirect(w, r, session, editURL)
+			return
+		}
+		email = normalized
+	}
+	// Owners can't demote or deactivate themselves, which also guarantees
+	// that at least one active owner always remains.
+	if user.ID == CurrentUser(r).ID && (role != user.Role || !active) {
+		session.AddFlash(FlashMessage{Type: "error", Message: "You can't change your own role or deactivate yourself."})
+		saveAndRedirect(w, r, session, editURL)
+		return
+	}
+
+	user.Email = email
+	user.Role = role
+	user.Active = active
+	if err := h.Store.UpdateUser(user); err != nil {
+		slog.Error("Failed to update user", "user_id", user.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error updating user."})
+		saveAndRedirect(w, r, session, editURL)
+		return
+	}
+
+	if !active {
+		if _, err := h.SessionStore.RevokeUserSessions(user.ID, ""); err != nil {
+			slog.Error("Failed to revoke sessions", "user_id", user.ID, "error", err)
+		}
+	}
+
+	slog.Info("User updated", "updated_by", CurrentUser(r).ID, "user_id", user.ID, "role", role, "active", active)
+	session.AddFlash(FlashMessage{Type: "success", Message: "User updated successfully!"})
+	saveAndRedirect(w, r, session, "/admin/users")
+}
+
+// AcceptInviteForm lets an invited user choose their password.
+func (h *AdminHandler) AcceptInviteForm(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	token := r.URL.Query().Get("token")
+	userID, err := h.Store.GetUserIDByToken(token, inviteTokenPurpose)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid or expired invitation. Please ask for a new one."})
+		saveAndRedirect(w, r, session, "/login")
+		return
+	}
+	user, err := h.Store.GetUserByID(userID)
+	if err != nil || user == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid or expired invitation. Please ask for a new one."})
+		saveAndRedirect(w, r, session, "/login")
+		return
+	}
+
+	tmpl := h.Templates.Get("accept_invite.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Username":      user.Username,
+		"Token":         token,
+		"PasswordRules": h.PasswordPolicy.Describe(),
+		"CsrfField":     csrf.TemplateField(r),
+		"Flashes":       GetFlash(session),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+func (h *AdminHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	token := r.FormValue("token")
+	password := r.FormValue("password")
+	confirm := r.FormValue("confirm_password")
+
+	userID, err := h.Store.GetUserIDByToken(token, inviteTokenPurpose)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid or expired invitation. Please ask for a new one."})
+		saveAndRedirect(w, r, session, "/login")
+		return
+	}
+
+	formURL := "/invite?token=" + token
+	if msg := h.checkNewPassword(password, confirm); msg != "" {
+		session.AddFlash(FlashMessage{Type: "error", Message: msg})
+		saveAndRedirect(w, r, session, formURL)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Internal Server Error"})
+		saveAndRedirect(w, r, session, formURL)
+		return
+	}
+	if err := h.Store.UpdateUserPassword(userID, hashedPassword); err != nil {
+		slog.Error("Failed to set password from invite", "user_id", userID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving your password."})
+		saveAndRedirect(w, r, session, formURL)
+		return
+	}
+	if err := h.Store.DeleteUserTokens(userID, inviteTokenPurpose); err != nil {
+		slog.Error("Failed to delete invite tokens", "user_id", userID, "error", err)
+	}
+
+	slog.Info("Invite accepted", "user_id", userID)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Password set! You can now log in."})
+	saveAndRedirect(w, r, session, "/login")
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+	"github.com/alextreichler/crochetbyjuliette/internal/store"
+	"github.com/gorilla/csrf"
+)
+
+// displayCurrencyKey holds the currency a visitor chose to see prices in,
+// in their public session.
+const displayCurrencyKey = "display_currency"
+
+// displayRate returns the exchange rate for the currency the visitor chose
+// to see prices in, or nil for the shop's own currency, base. ?currency=
+// changes the choice.
+func displayRate(s *store.Store, sessionStore *store.SessionStore, base string, w http.ResponseWriter, r *http.Request) *currency.Rate {
+	session, _ := sessionStore.Get(r, "public-session")
+	if code := strings.ToUpper(r.URL.Query().Get("currency")); currency.Valid(code) {
+		session.Values[displayCurrencyKey] = code
+		session.Save(r, w)
+	}
+	code, _ := session.Values[displayCurrencyKey].(string)
+	if code == "" || code == base {
+		return nil
+	}
+	// The rate may since have been removed
+	rate, err := s.GetExchangeRate(code)
+	if err != nil {
+		slog.Error("Failed to load exchange rate", "currency", code, "error", err)
+		return nil
+	}
+	return rate
+}
+
+// ListCurrencies shows the shop's currency and the exchange rates customers
+// can see prices in.
+func (h *AdminHandler) ListCurrencies(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.Store.ListExchangeRates()
+	if err != nil {
+		slog.Error("Failed to load exchange rates", "error", err)
+		http.Error(w, "Error fetching exchange rates", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := h.Templates.Get("admin_currencies.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Rates":       rates,
+		"Locale":      h.Money.Locale.String(),
+		"CsrfField":   csrf.TemplateField(r),
+		"Flashes":     GetFlash(session),
+		"CurrentUser": CurrentUser(r),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+// ExchangeRateForm shows the form for a new rate, or for the currency in
+// ?currency=.
+func (h *AdminHandler) ExchangeRateForm(w http.ResponseWriter, r *http.Request) {
+	rate := &currency.Rate{}
+	if code := r.URL.Query().Get("currency"); code != "" {
+		var err error
+		rate, err = h.Store.GetExchangeRate(strings.ToUpper(code))
+		if err != nil {
+			http.Error(w, "Error fetching exchange rate", http.StatusInternalServerError)
+			return
+		}
+		if rate == nil {
+			http.Error(w, "Exchange rate not found", http.StatusNotFound)
+			return
+		}
+	}
+	h.renderExchangeRateForm(w, r, rate, rate.Currency != "", nil)
+}
+
+// renderExchangeRateForm shows the rate form; editing means the rate is
+// already saved, so its currency can't be changed.
+func (h *AdminHandler) renderExchangeRateForm(w http.ResponseWriter, r *http.Request, rate *currency.Rate, editing bool, errors map[string]string) {
+	tmpl := h.Templates.Get("admin_edit_exchange_rate.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Rate":      rate,
+		"Editing":   editing,
+		"Errors":    errors,
+		"CsrfField": csrf.TemplateField(r),
+		"Flashes":   GetFlash(session),
+	}
+	session.Save(r, w)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	tmpl.Execute(w, data)
+}
+
+// exchangeRateFromForm reads and validates the exchange rate form.
+func (h *AdminHandler) exchangeRateFromForm(r *http.Request) (*currency.Rate, map[string]string) {
+	rate := &currency.Rate{Currency: strings.ToUpper(strings.TrimSpace(r.FormValue("currency")))}
+	value, err := strconv.ParseFloat(strings.TrimSpace(r.FormValue("rate")), 64)
+	rate.Rate = value
+	errors := rate.Validate(h.Money.Base)
+	if err != nil {
+		errors["rate"] = "Please enter a number."
+	}
+	return rate, errors
+}
+
+func (h *AdminHandler) CreateExchangeRate(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	rate, errors := h.exchangeRateFromForm(r)
+	if len(errors) == 0 {
+		if existing, err := h.Store.GetExchangeRate(rate.Currency); err == nil && existing != nil {
+			errors["currency"] = "There is already a rate for " + rate.Currency + "."
+		}
+	}
+	if len(errors) > 0 {
+		h.renderExchangeRateForm(w, r, rate, false, errors)
+		return
+	}
+
+	if err := h.Store.CreateExchangeRate(rate); err != nil {
+		slog.Error("Failed to create exchange rate", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving exchange rate."})
+		saveAndRedirect(w, r, session, "/admin/currencies")
+		return
+	}
+
+	slog.Info("Exchange rate created", "user_id", CurrentUser(r).ID, "currency", rate.Currency, "rate", rate.Rate)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Customers can now see prices in " + rate.Currency + "."})
+	saveAndRedirect(w, r, session, "/admin/currencies")
+}
+
+func (h *AdminHandler) UpdateExchangeRate(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	rate, errors := h.exchangeRateFromForm(r)
+	if len(errors) > 0 {
+		h.renderExchangeRateForm(w, r, rate, true, errors)
+		return
+	}
+
+	if err := h.Store.UpdateExchangeRate(rate); err != nil {
+		slog.Error("Failed to update exchange rate", "currency", rate.Currency, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving exchange rate."})
+		saveAndRedirect(w, r, session, "/admin/currencies")
+		return
+	}
+
+	slog.Info("Exchange rate updated", "user_id", CurrentUser(r).ID, "currency", rate.Currency, "rate", rate.Rate)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Exchange rate for " + rate.Currency + " updated."})
+	saveAndRedirect(w, r, session, "/admin/currencies")
+}
+
+func (h *AdminHandler) DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	code := strings.ToUpper(r.FormValue("currency"))
+	if err := h.Store.DeleteExchangeRate(code); err != nil {
+		slog.Error("Failed to delete exchange rate", "currency", code, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error deleting exchange rate."})
+		saveAndRedirect(w, r, session, "/admin/currencies")
+		return
+	}
+
+	slog.Info("Exchange rate deleted", "user_id", CurrentUser(r).ID, "currency", code)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Customers can no longer see prices in " + code + "."})
+	saveAndRedirect(w, r, session, "/admin/currencies")
+}
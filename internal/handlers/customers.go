@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/sessions"
+)
+
+// customerSessionKey holds the signed-in customer's ID in the order-session,
+// and customerSignedInKey when they signed in (Unix seconds).
+const (
+	customerSessionKey  = "customer_id"
+	customerSignedInKey = "customer_signed_in"
+)
+
+// customerSessionTTL is how long a sign-in link keeps a customer signed in.
+// Customers have no password, so this is kept short.
+const customerSessionTTL = 24 * time.Hour
+
+// currentCustomer returns the customer signed in to this session, or nil.
+func (h *OrderHandler) currentCustomer(session *sessions.Session) (*models.Customer, error) {
+	id, ok := session.Values[customerSessionKey].(int)
+	if !ok {
+		return nil, nil
+	}
+	signedIn, _ := session.Values[customerSignedInKey].(int64)
+	if time.Since(time.Unix(signedIn, 0)) > customerSessionTTL {
+		return nil, nil
+	}
+	return h.Store.GetCustomerByID(id)
+}
+
+// signInCustomer is called once an emailed login link has been verified. It
+// creates the account on first sign-in and links any orders placed with the
+// same email that aren't attached to an account yet.
+func (h *OrderHandler) signInCustomer(session *sessions.Session, email string) (*models.Customer, error) {
+	customer, err := h.Store.GetCustomerByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		if customer, err = h.Store.CreateCustomer(email); err != nil {
+			return nil, err
+		}
+		slog.Info("Customer account created", "customer_id", customer.ID)
+	}
+
+	linked, err := h.Store.LinkOrdersByEmail(customer.ID, customer.Email)
+	if err != nil {
+		return nil, err
+	}
+	if linked > 0 {
+		slog.Info("Linked past orders to customer", "customer_id", customer.ID, "orders", linked)
+	}
+	if err := h.Store.RecordCustomerLogin(customer.ID); err != nil {
+		slog.Error("Failed to record customer login", "customer_id", customer.ID, "error", err)
+	}
+
+	// Fresh session ID, as for admin logins.
+	if err := h.SessionStore.RenewID(session); err != nil {
+		return nil, err
+	}
+	session.Values[customerSessionKey] = customer.ID
+	session.Values[customerSignedInKey] = time.Now().Unix()
+	return customer, nil
+}
+
+// requireCustomer returns the signed-in customer, or redirects to the sign-in
+// page and returns nil.
+func (h *OrderHandler) requireCustomer(w http.ResponseWriter, r *http.Request, session *sessions.Session) *models.Customer {
+	tr := h.printer(w, r)
+	customer, err := h.currentCustomer(session)
+	if err != nil {
+		slog.Error("Failed to load customer", "error", err)
+	}
+	if customer == nil {
+		delete(session.Values, customerSessionKey)
+		delete(session.Values, customerSignedInKey)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Please sign in to view your account.")})
+		saveAndRedirect(w, r, session, "/status-request")
+		return nil
+	}
+	return customer
+}
+
+func (h *OrderHandler) Account(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "order-session")
+	customer := h.requireCustomer(w, r, session)
+	if customer == nil {
+		return
+	}
+
+	addresses, err := h.Store.ListCustomerAddresses(customer.ID)
+	if err != nil {
+		http.Error(w, "Error fetching addresses", http.StatusInternalServerError)
+		return
+	}
+
+	tr := h.printer(w, r)
+	tmpl := h.Templates.GetLang("account.html", tr.Lang)
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Lang":      tr.Lang,
+		"Customer":  customer,
+		"Addresses": addresses,
+		"Countries": address.Countries,
+		"Country":   address.DefaultCountry,
+		"CsrfField": csrf.TemplateField(r),
+		"Flashes":   GetFlash(session),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+// UpdateAccount saves the customer's name, phone and contact preferences.
+func (h *OrderHandler) UpdateAccount(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+	customer := h.requireCustomer(w, r, session)
+	if customer == nil {
+		return
+	}
+
+	customer.Name = strings.TrimSpace(r.FormValue("name"))
+	customer.Phone = strings.TrimSpace(r.FormValue("phone"))
+	customer.OrderUpdates = r.FormValue("order_updates") == "on"
+	customer.Newsletter = r.FormValue("newsletter") == "on"
+
+	if err := h.Store.UpdateCustomer(customer); err != nil {
+		slog.Error("Failed to update customer", "customer_id", customer.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Error saving your details.")})
+		saveAndRedirect(w, r, session, "/account")
+		return
+	}
+
+	session.AddFlash(FlashMessage{Type: "success", Message: tr.T("Your details have been saved.")})
+	saveAndRedirect(w, r, session, "/account")
+}
+
+func (h *OrderHandler) AddAddress(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+	customer := h.requireCustomer(w, r, session)
+	if customer == nil {
+		return
+	}
+
+	label := strings.TrimSpace(r.FormValue("label"))
+	addr := addressFromForm(r)
+	if addr.Name == "" {
+		addr.Name = customer.Name
+	}
+	if msg := addressErrorMessage(addr); msg != "" {
+		session.AddFlash(FlashMessage{Type: "error", Message: msg})
+		saveAndRedirect(w, r, session, "/account")
+		return
+	}
+
+	if err := h.Store.AddCustomerAddress(customer.ID, label, addr); err != nil {
+		slog.Error("Failed to add address", "customer_id", customer.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Error saving address.")})
+		saveAndRedirect(w, r, session, "/account")
+		return
+	}
+
+	session.AddFlash(FlashMessage{Type: "success", Message: tr.T("Address saved.")})
+	saveAndRedirect(w, r, session, "/account")
+}
+
+func (h *OrderHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+	customer := h.requireCustomer(w, r, session)
+	if customer == nil {
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err == nil {
+		err = h.Store.DeleteCustomerAddress(customer.ID, id)
+	}
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Error removing address.")})
+		saveAndRedirect(w, r, session, "/account")
+		return
+	}
+
+	session.AddFlash(FlashMessage{Type: "success", Message: tr.T("Address removed.")})
+	saveAndRedirect(w, r, session, "/account")
+}
+
+func (h *OrderHandler) SetDefaultAddress(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+	customer := h.requireCustomer(w, r, session)
+	if customer == nil {
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err == nil {
+		err = h.Store.SetDefaultCustomerAddress(customer.ID, id)
+	}
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Error updating address.")})
+		saveAndRedirect(w, r, session, "/account")
+		return
+	}
+
+	session.AddFlash(FlashMessage{Type: "success", Message: tr.T("Default address updated.")})
+	saveAndRedirect(w, r, session, "/account")
+}
+
+func (h *OrderHandler) CustomerLogout(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+	delete(session.Values, customerSessionKey)
+	delete(session.Values, customerSignedInKey)
+	session.AddFlash(FlashMessage{Type: "success", Message: tr.T("You have been signed out.")})
+	saveAndRedirect(w, r, session, "/status-request")
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+	"github.com/alextreichler/crochetbyjuliette/internal/discount"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/gorilla/csrf"
+)
+
+// checkDiscount looks up the code a customer entered for an order of item
+// costing subtotal. Pass an empty email where the customer hasn't given one
+// yet, to skip the per-email limit. It returns the code, or a message for
+// the customer if it can't be used.
+func (h *OrderHandler) checkDiscount(tr i18n.Printer, entered string, itemID int, subtotal float64, email string) (*discount.Code, string, error) {
+	code, err := h.Store.GetDiscountCodeByCode(entered)
+	if err != nil {
+		return nil, "", err
+	}
+	if code == nil {
+		return nil, tr.T("This code isn't valid."), nil
+	}
+	emailUses := 0
+	if email != "" {
+		if emailUses, err = h.Store.CountEmailRedemptions(code.ID, email); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := code.Check(itemID, subtotal, code.Redemptions, emailUses, time.Now()); err != nil {
+		return nil, discountMessage(tr, err, code, h.Money), nil
+	}
+	return code, "", nil
+}
+
+// discountMessage explains to the customer why code can't be used.
+func discountMessage(tr i18n.Printer, err error, code *discount.Code, money currency.Formatter) string {
+	switch {
+	case errors.Is(err, discount.ErrExpired):
+		return tr.T("This code has expired.")
+	case errors.Is(err, discount.ErrItem):
+		return tr.T("This code can't be used on this item.")
+	case errors.Is(err, discount.ErrMinOrder):
+		return tr.T("This code needs an order of at least %s.", money.Format(code.MinOrder))
+	case errors.Is(err, discount.ErrUsedUp):
+		return tr.T("Sorry, this code has been used up.")
+	case errors.Is(err, discount.ErrUsedByEmail):
+		return tr.T("You've already used this code.")
+	}
+	return tr.T("This code isn't valid.")
+}
+
+// usedUp reports whether err is the store finding an order's code had been
+// used up since it was checked.
+func usedUp(err error) bool {
+	return errors.Is(err, discount.ErrUsedUp) || errors.Is(err, discount.ErrUsedByEmail)
+}
+
+// rediscountOrder updates the discount after the quantity of an order
+// changed from oldQuantity. Percentage discounts follow the quantity and
+// fixed ones are worked out again from the code, so one that was cut down
+// to a smaller order comes back in full; neither is checked against the
+// code's limits again. If the code was deleted, the discount stays as it
+// was, up to the new subtotal.
+func (h *OrderHandler) rediscountOrder(order *models.Order, oldQuantity int) error {
+	if order.Discount == 0 {
+		return nil
+	}
+	if order.DiscountCodeID != 0 {
+		code, err := h.Store.GetDiscountCode(order.DiscountCodeID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case code != nil && code.Kind == discount.KindPercent:
+			order.Discount = math.Round(order.Discount/float64(oldQuantity)*float64(order.Quantity)*100) / 100
+		case code != nil && code.Kind == discount.KindFixed:
+			order.Discount = code.Amount(order.Subtotal())
+		}
+	}
+	order.Discount = math.Min(order.Discount, order.Subtotal())
+	return nil
+}
+
+// ListDiscounts shows the discount codes and how often they were used.
+func (h *AdminHandler) ListDiscounts(w http.ResponseWriter, r *http.Request) {
+	codes, err := h.Store.ListDiscountCodes()
+	if err != nil {
+		slog.Error("Failed to load discount codes", "error", err)
+		http.Error(w, "Error fetching discount codes", http.StatusInternalServerError)
+		return
+	}
+	items, err := h.Store.GetAllItems()
+	if err != nil {
+		http.Error(w, "Error fetching items", http.StatusInternalServerError)
+		return
+	}
+	itemTitles := make(map[int]string)
+	for _, item := range items {
+		itemTitles[item.ID] = item.Title
+	}
+
+	tmpl := h.Templates.Get("admin_discounts.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Codes":       codes,
+		"ItemTitles":  itemTitles,
+		"Now":         time.Now(),
+		"CsrfField":   csrf.TemplateField(r),
+		"Flashes":     GetFlash(session),
+		"CurrentUser": CurrentUser(r),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+// DiscountForm shows the form for a new code, or for the code in ?id=.
+func (h *AdminHandler) DiscountForm(w http.ResponseWriter, r *http.Request) {
+	code := &discount.Code{Kind: discount.KindPercent, Active: true}
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		code, err = h.Store.GetDiscountCode(id)
+		if err != nil {
+			http.Error(w, "Error fetching discount code", http.StatusInternalServerError)
+			return
+		}
+		if code == nil {
+			http.Error(w, "Discount code not found", http.StatusNotFound)
+			return
+		}
+	}
+	h.renderDiscountForm(w, r, code, nil)
+}
+
+func (h *AdminHandler) renderDiscountForm(w http.ResponseWriter, r *http.Request, code *discount.Code, errors map[string]string) {
+	tmpl := h.Templates.Get("admin_edit_discount.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	items, err := h.Store.GetAllItems()
+	if err != nil {
+		http.Error(w, "Error fetching items", http.StatusInternalServerError)
+		return
+	}
+	selected := make(map[int]bool)
+	for _, id := range code.ItemIDs {
+		selected[id] = true
+	}
+	expires := ""
+	if !code.ExpiresAt.IsZero() {
+		expires = code.ExpiresAt.Format("2006-01-02")
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Code":      code,
+		"Expires":   expires,
+		"Kinds":     discount.Kinds,
+		"Items":     items,
+		"Selected":  selected,
+		"Errors":    errors,
+		"CsrfField": csrf.TemplateField(r),
+		"Flashes":   GetFlash(session),
+	}
+	session.Save(r, w)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	tmpl.Execute(w, data)
+}
+
+// discountFromForm reads and validates the discount code form.
+func discountFromForm(r *http.Request) (*discount.Code, map[string]string) {
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	code := &discount.Code{
+		ID:     id,
+		Code:   discount.Normalize(r.FormValue("code")),
+		Kind:   r.FormValue("kind"),
+		Active: r.FormValue("active") == "on",
+	}
+	numErrors := make(map[string]string)
+	parse := func(field string, dest *float64) {
+		v := strings.TrimSpace(r.FormValue(field))
+		if v == "" {
+			return
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			numErrors[field] = "Please enter a number."
+		}
+		*dest = f
+	}
+	parse("value", &code.Value)
+	parse("min_order", &code.MinOrder)
+	for _, f := range []struct {
+		name string
+		dest *int
+	}{{"max_uses", &code.MaxUses}, {"max_uses_per_email", &code.MaxUsesPerEmail}} {
+		v := strings.TrimSpace(r.FormValue(f.name))
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			numErrors[f.name] = "Please enter a whole number, or leave blank for no limit."
+		}
+		*f.dest = n
+	}
+	if v := r.FormValue("expires"); v != "" {
+		// Codes work until the end of their last day
+		if day, err := time.Parse("2006-01-02", v); err != nil {
+			numErrors["expires"] = "Please enter a date."
+		} else {
+			code.ExpiresAt = day.Add(24*time.Hour - time.Second)
+		}
+	}
+	for _, v := range r.Form["item_ids"] {
+		if itemID, err := strconv.Atoi(v); err == nil {
+			code.ItemIDs = append(code.ItemIDs, itemID)
+		}
+	}
+
+	errors := code.Validate()
+	for field, msg := range numErrors {
+		errors[field] = msg
+	}
+	return code, errors
+}
+
+func (h *AdminHandler) CreateDiscount(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	code, errors := discountFromForm(r)
+	code.ID = 0
+	if len(errors) == 0 {
+		if existing, err := h.Store.GetDiscountCodeByCode(code.Code); err == nil && existing != nil {
+			errors["code"] = "There is already a code " + code.Code + "."
+		}
+	}
+	if len(errors) > 0 {
+		h.renderDiscountForm(w, r, code, errors)
+		return
+	}
+
+	if err := h.Store.CreateDiscountCode(code); err != nil {
+		slog.Error("Failed to create discount code", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving discount code."})
+		saveAndRedirect(w, r, session, "/admin/discounts")
+		return
+	}
+
+	slog.Info("Discount code created", "user_id", CurrentUser(r).ID, "code", code.Code)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Discount code " + code.Code + " added."})
+	saveAndRedirect(w, r, session, "/admin/discounts")
+}
+
+func (h *AdminHandler) UpdateDiscount(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	code, errors := discountFromForm(r)
+	if len(errors) == 0 {
+		if existing, err := h.Store.GetDiscountCodeByCode(code.Code); err == nil && existing != nil && existing.ID != code.ID {
+			errors["code"] = "There is already a code " + code.Code + "."
+		}
+	}
+	if len(errors) > 0 {
+		h.renderDiscountForm(w, r, code, errors)
+		return
+	}
+
+	if err := h.Store.UpdateDiscountCode(code); err != nil {
+		slog.Error("Failed to update discount code", "code_id", code.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving discount code."})
+		saveAndRedirect(w, r, session, "/admin/discounts")
+		return
+	}
+
+	slog.Info("Discount code updated", "user_id", CurrentUser(r).ID, "code_id", code.ID)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Discount code updated. Orders already placed keep their discount."})
+	saveAndRedirect(w, r, session, "/admin/discounts")
+}
+
+func (h *AdminHandler) DeleteDiscount(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid ID."})
+		saveAndRedirect(w, r, session, "/admin/discounts")
+		return
+	}
+	if err := h.Store.DeleteDiscountCode(id); err != nil {
+		slog.Error("Failed to delete discount code", "code_id", id, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error deleting discount code."})
+		saveAndRedirect(w, r, session, "/admin/discounts")
+		return
+	}
+
+	slog.Info("Discount code deleted", "user_id", CurrentUser(r).ID, "code_id", id)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Discount code deleted."})
+	saveAndRedirect(w, r, session, "/admin/discounts")
+}
@@ -1,26 +1,32 @@
 package handlers
 
 import (
+	"log/slog"
 	"net/http"
+	"slices"
 
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
 	"github.com/alextreichler/crochetbyjuliette/internal/store"
-	"github.com/gorilla/sessions"
 )
 
 type HomeHandler struct {
 	Store     *store.Store
 	Templates *TemplateCache
-	SessionStore *sessions.CookieStore
+	SessionStore *store.SessionStore
+	Money        currency.Formatter
+	Messages     *i18n.Bundle
 }
 
 func (h *HomeHandler) Index(w http.ResponseWriter, r *http.Request) {
-	items, err := h.Store.GetPublicItems()
+	lang := visitorLanguage(h.Messages, h.SessionStore, w, r)
+	items, err := h.Store.GetPublicItems(lang)
 	if err != nil {
 		http.Error(w, "Error fetching items", http.StatusInternalServerError)
 		return
 	}
 
-	tmpl := h.Templates.Get("home.html")
+	tmpl := h.Templates.GetLang("home.html", lang)
 	if tmpl == nil {
 		http.Error(w, "Template not found", http.StatusInternalServerError)
 		return
@@ -33,10 +39,22 @@ func (h *HomeHandler) Index(w http.ResponseWriter, r *http.Request) {
 		isAdmin = true
 	}
 
+	// Customers can see rough prices in the currencies the shop has rates
+	// for, leaving out a rate kept from before the shop changed currency
+	currencies, err := h.Store.ListExchangeRates()
+	if err != nil {
+		slog.Error("Failed to load exchange rates", "error", err)
+	}
+	currencies = slices.DeleteFunc(currencies, func(rate currency.Rate) bool { return rate.Currency == h.Money.Base })
+
 	data := map[string]interface{}{
-		"Items":   items,
-		"Flashes": GetFlash(publicSession),
-		"IsAdmin": isAdmin,
+		"Items":      items,
+		"Flashes":    GetFlash(publicSession),
+		"IsAdmin":    isAdmin,
+		"Currencies": currencies,
+		"Display":    displayRate(h.Store, h.SessionStore, h.Money.Base, w, r),
+		"Lang":       lang,
+		"Languages":  languageOptions(h.Messages),
 	}
 	publicSession.Save(r, w)
 	tmpl.Execute(w, data)
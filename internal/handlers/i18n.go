@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+	"github.com/alextreichler/crochetbyjuliette/internal/store"
+)
+
+// languageKey holds the language a visitor chose, in their public session.
+const languageKey = "language"
+
+// visitorLanguage returns the language to show the visitor: the one they
+// chose, else the best match for their browser's. ?lang= changes the
+// choice.
+func visitorLanguage(messages *i18n.Bundle, sessionStore *store.SessionStore, w http.ResponseWriter, r *http.Request) string {
+	session, _ := sessionStore.Get(r, "public-session")
+	if lang := r.URL.Query().Get("lang"); messages.Supported(lang) {
+		session.Values[languageKey] = lang
+		session.Save(r, w)
+	}
+	if lang, _ := session.Values[languageKey].(string); messages.Supported(lang) {
+		return lang
+	}
+	return messages.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// languageOption is a language visitors can choose.
+type languageOption struct {
+	Code string
+	Name string // In the language itself
+}
+
+// languageOptions lists the languages offered, for the language picker.
+func languageOptions(messages *i18n.Bundle) []languageOption {
+	var options []languageOption
+	for _, lang := range messages.Languages() {
+		options = append(options, languageOption{Code: lang, Name: i18n.Name(lang)})
+	}
+	return options
+}
+
+// printer translates messages into the visitor's language.
+func (h *OrderHandler) printer(w http.ResponseWriter, r *http.Request) i18n.Printer {
+	return h.Messages.Printer(visitorLanguage(h.Messages, h.SessionStore, w, r))
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+	"github.com/alextreichler/crochetbyjuliette/internal/invoice"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/payments"
+	"github.com/alextreichler/crochetbyjuliette/internal/store"
+	"github.com/alextreichler/crochetbyjuliette/internal/tax"
+)
+
+// Invoicing is how invoices are made out, shared by the admin and customer
+// downloads.
+type Invoicing struct {
+	Shop   invoice.Shop
+	Money  currency.Formatter // Writes amounts as the site does
+	Prefix string             // Put before invoice numbers
+	Attach bool               // Attach invoices to order confirmation emails
+}
+
+// errNotInvoiced is returned by Invoicing.Invoice for an order cancelled
+// before it had an invoice.
+var errNotInvoiced = errors.New("order was cancelled before it was invoiced")
+
+// Invoice makes out the order's invoice, numbering it the first time it's
+// made out, whether viewed or sent, unless the order is cancelled: cancelled
+// orders only keep an invoice issued before, so that the numbers run on
+// without gaps for orders that were never invoiced. What the invoice
+// charges is saved when it's numbered and reused after, so a later change
+// to the order doesn't alter an invoice already sent; the payments are as
+// they stand. Code is the currency the order's amounts are in.
+func (in Invoicing) Invoice(s *store.Store, order *models.Order, code string) (*invoice.Invoice, error) {
+	charges, err := orderCharges(s, order)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := json.Marshal(charges)
+	if err != nil {
+		return nil, err
+	}
+	issued, err := s.IssueInvoice(order.ID, string(saved))
+	if err != nil {
+		return nil, err
+	}
+	if issued == nil {
+		return nil, errNotInvoiced
+	}
+	if err := json.Unmarshal([]byte(issued.Charges), &charges); err != nil {
+		return nil, fmt.Errorf("invoice %d charges: %w", issued.Number, err)
+	}
+	if err := s.LoadPayments(order); err != nil {
+		return nil, err
+	}
+
+	inv := &invoice.Invoice{
+		Number:        fmt.Sprintf("%s%05d", in.Prefix, issued.Number),
+		Issued:        issued.IssuedAt,
+		OrderRef:      order.OrderRef,
+		OrderDate:     order.CreatedAt,
+		Currency:      code,
+		Money:         in.Money,
+		Shop:          in.Shop,
+		Charges:       charges,
+		Paid:          order.AmountPaid(),
+		Refunded:      order.AmountRefunded(),
+		RefundDue:     order.RefundDue(),
+		PaymentStatus: payments.StatusLabel(order.PaymentStatus()),
+		PaymentMethod: order.PaymentLabel(),
+	}
+	if order.Status != "Cancelled" {
+		inv.BalanceDue = math.Max(math.Round((inv.Total-inv.Paid)*100)/100, 0)
+	} else {
+		inv.Note = "This order was cancelled."
+		c, err := s.GetCancellation(order.ID)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			inv.Note = "This order was cancelled: " + c.ReasonLabel() + "."
+		}
+	}
+	return inv, nil
+}
+
+// orderCharges is what an invoice for the order as it is now would charge.
+func orderCharges(s *store.Store, order *models.Order) (invoice.Charges, error) {
+	c := invoice.Charges{Total: order.Total()}
+	// The shipping address starts with the recipient's name
+	if order.DeliveryMethod == "shipping" {
+		c.BillTo = append(order.AddressLines(), order.CustomerEmail)
+	} else {
+		c.BillTo = []string{order.CustomerName, order.CustomerEmail}
+	}
+	c.Lines = append(c.Lines, invoice.Line{
+		Description: order.ItemTitle,
+		Quantity:    order.Quantity,
+		UnitPrice:   order.UnitPrice,
+		Amount:      order.Subtotal(),
+	})
+	if order.Discount > 0 {
+		c.Lines = append(c.Lines, invoice.Line{
+			Description: "Discount (" + order.DiscountCode + ")",
+			Amount:      -order.Discount,
+		})
+	}
+	c.Lines = append(c.Lines, invoice.Line{
+		Description: "Delivery: " + order.DeliveryLabel(),
+		Amount:      order.ShippingFee,
+	})
+
+	taxes, err := s.ListOrderTaxes(order.ID)
+	if err != nil {
+		return c, err
+	}
+	for _, t := range tax.Summarize(taxes) {
+		label := t.Label()
+		if order.TaxInclusive {
+			label = "Includes " + label
+		}
+		c.Taxes = append(c.Taxes, invoice.TaxLine{Label: label, Amount: t.Amount})
+	}
+	return c, nil
+}
+
+// serveInvoice sends the invoice as a PDF download.
+func serveInvoice(w http.ResponseWriter, inv *invoice.Invoice) {
+	var buf bytes.Buffer
+	if err := inv.WritePDF(&buf); err != nil {
+		slog.Error("Failed to render invoice", "number", inv.Number, "error", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, inv.Filename()))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(buf.Bytes())
+}
+
+// OrderInvoice downloads an order's invoice for admins.
+func (h *AdminHandler) OrderInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	order, err := h.Store.GetOrderByID(id)
+	if err != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	inv, err := h.Invoicing.Invoice(h.Store, order, h.Currency)
+	if err == errNotInvoiced {
+		session, _ := h.SessionStore.Get(r, "admin-session")
+		session.AddFlash(FlashMessage{Type: "error", Message: "Order " + order.OrderRef + " was cancelled before it was invoiced, so it has no invoice."})
+		saveAndRedirect(w, r, session, "/admin/orders")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to issue invoice", "order_id", id, "error", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+	serveInvoice(w, inv)
+}
+
+// OrderInvoice downloads an order's invoice for the customer.
+func (h *OrderHandler) OrderInvoice(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+
+	order := h.orderForSession(session, r.PathValue("ref"))
+	if order == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Order not found or link is invalid.")})
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+	inv, err := h.Invoicing.Invoice(h.Store, order, h.Currency)
+	if err == errNotInvoiced {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("This order was cancelled before an invoice was issued.")})
+		saveAndRedirect(w, r, session, "/orders/"+order.OrderRef)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to issue invoice", "order_id", order.ID, "error", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+	serveInvoice(w, inv)
+}
+
+// attachInvoice adds the order's invoice to a confirmation email, if
+// invoices are attached.
+func (h *OrderHandler) attachInvoice(orderID int) {
+	if !h.Invoicing.Attach {
+		return
+	}
+	// Reload the order for the fields the database fills in
+	order, err := h.Store.GetOrderByID(orderID)
+	if err != nil {
+		slog.Error("Failed to load order for invoice", "order_id", orderID, "error", err)
+		return
+	}
+	inv, err := h.Invoicing.Invoice(h.Store, order, h.Currency)
+	if err != nil {
+		slog.Error("Failed to issue invoice", "order_id", order.ID, "error", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := inv.WritePDF(&buf); err != nil {
+		slog.Error("Failed to render invoice", "number", inv.Number, "error", err)
+		return
+	}
+	slog.Info(fmt.Sprintf("Attachment: %s (%d bytes)", inv.Filename(), buf.Len()))
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Login throttling. Every failed attempt is stored per username and per IP;
+// once a key has a few recent failures each further attempt must wait an
+// exponentially growing delay, and past the lockout threshold the key is
+// locked out for a fixed period. A successful login clears the username's
+// count, but not the IP's.
+const (
+	loginFailureWindow   = 15 * time.Minute
+	loginDelayAfter      = 3
+	loginMaxDelay        = 30 * time.Second
+	loginLockoutUsername = 10
+	loginLockoutIP       = 25 // higher, since several people may share an address
+	loginLockoutDuration = 15 * time.Minute
+)
+
+// Reasons recorded for failed login attempts. Throttled attempts never reach
+// the password check, so the store does not count them as failures.
+const (
+	loginReasonBadPassword = "bad_password"
+	loginReasonBad2FACode  = "bad_2fa_code"
+	loginReasonThrottled   = "throttled"
+)
+
+// loginWaitFor returns how long a key with count recent failures, the last
+// at last, must still wait before trying again.
+func loginWaitFor(count int, last time.Time, lockoutAfter int) time.Duration {
+	var delay time.Duration
+	switch {
+	case count >= lockoutAfter:
+		delay = loginLockoutDuration
+	case count >= loginDelayAfter:
+		delay = time.Second << (count - loginDelayAfter)
+		if delay > loginMaxDelay {
+			delay = loginMaxDelay
+		}
+	default:
+		return 0
+	}
+	return time.Until(last.Add(delay))
+}
+
+// loginWait checks both the username and the IP and returns the longer wait.
+func (h *AdminHandler) loginWait(username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	checks := []struct {
+		column, value string
+		lockoutAfter  int
+	}{
+		{"username", username, loginLockoutUsername},
+		{"ip", ip, loginLockoutIP},
+	}
+	for _, c := range checks {
+		count, last, err := h.Store.LoginFailures(c.column, c.value, loginFailureWindow)
+		if err != nil {
+			return 0, err
+		}
+		if d := loginWaitFor(count, last, c.lockoutAfter); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// recordLoginAttempt stores the attempt and logs failures as security events.
+func (h *AdminHandler) recordLoginAttempt(r *http.Request, username string, success bool, reason string) {
+	ip := ClientIP(r)
+	if err := h.Store.RecordLoginAttempt(username, ip, success, reason); err != nil {
+		slog.Error("Failed to record login attempt", "username", username, "ip", ip, "error", err)
+	}
+	if !success {
+		slog.Warn("Security event: login failed", "username", username, "ip", ip, "reason", reason)
+	}
+}
+
+// waitMessage describes a throttling delay to the user.
+func waitMessage(wait time.Duration) string {
+	if wait >= time.Minute {
+		minutes := int((wait + time.Minute - 1) / time.Minute)
+		return fmt.Sprintf("Too many failed login attempts. Please try again in %d minute%s.", minutes, plural(minutes))
+	}
+	seconds := int((wait + time.Second - 1) / time.Second)
+	return fmt.Sprintf("Too many failed login attempts. Please wait %d second%s and try again.", seconds, plural(seconds))
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// normalizeLoginUsername keeps attempts for "Admin" and "admin " under one key.
+func normalizeLoginUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
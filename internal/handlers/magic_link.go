@@ -3,56 +3,114 @@ package handlers
 import (
 	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/alextreichler/crochetbyjuliette/internal/antispam"
+	"github.com/alextreichler/crochetbyjuliette/internal/emailaddr"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
 	"github.com/gorilla/csrf"
 )
 
+// statusLinkSentMessage is shown whether or not a link was sent, so the form
+// doesn't reveal which addresses have orders.
+func statusLinkSentMessage(tr i18n.Printer) string {
+	return tr.T("If you have orders or an account with us, a sign-in link has been sent to your email.")
+}
+
 func (h *OrderHandler) RequestStatusLink(w http.ResponseWriter, r *http.Request) {
-	tmpl := h.Templates.Get("status_request.html")
+	session, _ := h.SessionStore.Get(r, "order-session")
+	if customer, _ := h.currentCustomer(session); customer != nil {
+		saveAndRedirect(w, r, session, "/my-orders")
+		return
+	}
+
+	tr := h.printer(w, r)
+	tmpl := h.Templates.GetLang("status_request.html", tr.Lang)
 	if tmpl == nil {
 		http.Error(w, "Template not found", http.StatusInternalServerError)
 		return
 	}
-	session, _ := h.SessionStore.Get(r, "order-session")
 	data := map[string]interface{}{
-		"CsrfField": csrf.TemplateField(r),
-		"Flashes":   GetFlash(session),
+		"Lang":       tr.Lang,
+		"CsrfField":  csrf.TemplateField(r),
+		"Flashes":    GetFlash(session),
+		"SpamFields": h.Spam.Fields(),
 	}
 	session.Save(r, w) // Save session to clear flashes
 	tmpl.Execute(w, data)
 }
 
 func (h *OrderHandler) SendStatusLink(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
 	session, _ := h.SessionStore.Get(r, "order-session")
-	defer session.Save(r, w)
 
-	email := r.FormValue("email")
-	
+	if err := h.Spam.Check(r); err != nil {
+		slog.Warn("Sign-in link form rejected", "reason", err, "ip", ClientIP(r))
+		if err == antispam.ErrHoneypot {
+			session.AddFlash(FlashMessage{Type: "success", Message: statusLinkSentMessage(tr)})
+		} else {
+			session.AddFlash(FlashMessage{Type: "error", Message: spamMessage(tr, err)})
+		}
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+
+	email, err := emailaddr.Normalize(r.FormValue("email"))
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Please enter a valid email address.")})
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+
+	// Past the cap, quietly stop sending so the mailbox isn't flooded
+	sent, err := h.Store.CountFormSubmissions(spamFormStatus, email, time.Hour)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Internal Error processing your request.")})
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+	if sent >= h.StatusLinksPerEmail {
+		slog.Warn("Sign-in link cap reached for email", "ip", ClientIP(r))
+		session.AddFlash(FlashMessage{Type: "success", Message: statusLinkSentMessage(tr)})
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+
 	// Check if any orders exist for this email (case-insensitive)
 	orders, err := h.Store.GetOrdersByEmail(email)
 	if err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Internal Error processing your request."})
-		http.Redirect(w, r, "/status-request", http.StatusInternalServerError) // Use Redirect instead of http.Error
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Internal Error processing your request.")})
+		saveAndRedirect(w, r, session, "/status-request")
 		return
 	}
 
-	if len(orders) > 0 {
-		// Generate a global access token for "My Orders" page
+	customer, err := h.Store.GetCustomerByEmail(email)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Internal Error processing your request.")})
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+
+	if len(orders) > 0 || customer != nil {
+		// Generate a sign-in token for the customer's account
 		token := generateToken()
 		
 		if err := h.Store.CreateLoginToken(email, token); err != nil {
-			session.AddFlash(FlashMessage{Type: "error", Message: "Error generating access link. Please try again."})
-			http.Redirect(w, r, "/status-request", http.StatusInternalServerError)
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Error generating access link. Please try again.")})
+			saveAndRedirect(w, r, session, "/status-request")
 			return
 		}
 
+		if err := h.Store.RecordFormSubmission(spamFormStatus, email, ClientIP(r)); err != nil {
+			slog.Error("Failed to record sign-in link request", "error", err)
+		}
+
 		// MOCK EMAIL
 		slog.Info("==========================================")
 		slog.Info("📧 EMAIL SENT TO: " + email)
-		slog.Info("Subject: Your Orders - Crochet by Juliette")
-		slog.Info("Access All Orders: http://localhost:8585/my-orders?token=" + token)
+		slog.Info("Subject: Sign in to Crochet by Juliette")
+		slog.Info("Sign In: " + h.BaseURL + "/my-orders?token=" + token)
 		slog.Info("==========================================")
 	} else {
 		// Security: Don't reveal if email exists, but maybe log it.
@@ -60,87 +118,130 @@ func (h *OrderHandler) SendStatusLink(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Show "Check your email" message regardless of success (security)
-	session.AddFlash(FlashMessage{Type: "success", Message: "If you have active orders, a link has been sent to your email."})
-	http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+	session.AddFlash(FlashMessage{Type: "success", Message: statusLinkSentMessage(tr)})
+	saveAndRedirect(w, r, session, "/status-request")
 }
 
+// MyOrders lists the signed-in customer's orders. Following an emailed link
+// (?token=...) signs the customer in first and then redirects here without
+// the token, so it doesn't linger in the address bar or browser history.
 func (h *OrderHandler) MyOrders(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
 	session, _ := h.SessionStore.Get(r, "order-session")
-	defer session.Save(r, w)
 
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Missing access token."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+	if token := r.URL.Query().Get("token"); token != "" {
+		// Validate token and get email
+		// Sign-in links are single-use; the token is deleted here.
+		email, err := h.Store.ConsumeLoginToken(token)
+		if err != nil || email == "" {
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Invalid or Expired Link. Please request a new one.")})
+			saveAndRedirect(w, r, session, "/status-request")
+			return
+		}
+		customer, err := h.signInCustomer(session, email)
+		if err != nil {
+			slog.Error("Customer sign-in failed", "error", err)
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Error signing you in. Please try again.")})
+			saveAndRedirect(w, r, session, "/status-request")
+			return
+		}
+		slog.Info("Customer signed in", "customer_id", customer.ID)
+		saveAndRedirect(w, r, session, "/my-orders")
 		return
 	}
 
-	// Validate token and get email
-	email, err := h.Store.GetEmailByLoginToken(token)
-	if err != nil || email == "" {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid or Expired Link. Please request a new one."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+	customer := h.requireCustomer(w, r, session)
+	if customer == nil {
 		return
 	}
 
-	// Fetch all orders for this verified email
-	orders, err := h.Store.GetOrdersByEmail(email)
+	orders, err := h.Store.GetOrdersByCustomer(customer.ID)
 	if err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Error fetching your orders."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Error fetching your orders.")})
+		saveAndRedirect(w, r, session, "/status-request")
 		return
 	}
 
-	tmpl := h.Templates.Get("my_orders.html")
+	tmpl := h.Templates.GetLang("my_orders.html", tr.Lang)
 	if tmpl == nil {
 		http.Error(w, "Template not found", http.StatusInternalServerError)
 		return
 	}
-	tmpl.Execute(w, map[string]interface{}{
-		"Orders":  orders,
-		"Email":   email,
-		"Flashes": GetFlash(session),
-	})
+	data := map[string]interface{}{
+		"Lang":     tr.Lang,
+		"Orders":   orders,
+		"Email":    customer.Email,
+		"Customer": customer,
+		"Flashes":  GetFlash(session),
+	}
+	session.Save(r, w) // Save after getting flashes to clear them
+	tmpl.Execute(w, data)
 }
 
-func (h *OrderHandler) ViewOrderStatus(w http.ResponseWriter, r *http.Request) {
+// OpenOrderLink handles the link emailed with an order. A valid link lets
+// this browser see the order, then redirects to the order page so the token
+// isn't left in the address bar.
+func (h *OrderHandler) OpenOrderLink(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
 	session, _ := h.SessionStore.Get(r, "order-session")
-	defer session.Save(r, w)
 
-	// Extract token from path manually since we use ServeMux
-	// Path is /order/status/{token}
-	path := r.URL.Path
-	parts := strings.Split(path, "/")
-	if len(parts) < 4 {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid order link."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
-		return
-	}
-	token := parts[3]
-
-	order, err := h.Store.GetOrderByToken(token)
+	order, err := h.Store.GetOrderByToken(r.PathValue("token"))
 	if err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Order not found or link is invalid."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Order not found or link is invalid.")})
+		saveAndRedirect(w, r, session, "/status-request")
 		return
 	}
 
 	// Check expiry
 	if time.Now().After(order.MagicTokenExpiry) {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Link Expired. Please request a new one."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Link Expired. Please request a new one.")})
+		saveAndRedirect(w, r, session, "/status-request")
 		return
 	}
 
-	tmpl := h.Templates.Get("order_status.html")
+	grantOrderAccess(session, order)
+	saveAndRedirect(w, r, session, "/orders/"+order.OrderRef)
+}
+
+func (h *OrderHandler) ViewOrderStatus(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+
+	order := h.orderForSession(session, r.PathValue("ref"))
+	if order == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Order not found or link is invalid.")})
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+
+	shipments, err := h.Store.ListShipments(order.ID)
+	if err != nil {
+		slog.Error("Failed to load shipments", "order_id", order.ID, "error", err)
+	}
+	order.Shipments = shipments
+	if err := h.Store.LoadPayments(order); err != nil {
+		slog.Error("Failed to load payments", "order_id", order.ID, "error", err)
+	}
+	if order.Status == "Cancelled" {
+		if order.Cancellation, err = h.Store.GetCancellation(order.ID); err != nil {
+			slog.Error("Failed to load cancellation", "order_id", order.ID, "error", err)
+		}
+	}
+
+	tmpl := h.Templates.GetLang("order_status.html", tr.Lang)
 	if tmpl == nil {
 		http.Error(w, "Template not found", http.StatusInternalServerError)
 		return
 	}
 	data := map[string]interface{}{
-		"Order":   order,
-		"Flashes": GetFlash(session),
+		"Lang":            tr.Lang,
+		"Order":           order,
+		"CsrfField":       csrf.TemplateField(r),
+		"Flashes":         GetFlash(session),
+		"CanPay":          h.canPayOnline(order),
+		"PaymentReturned": paymentReturned(r, order),
+		"CancelReasons":   models.CustomerCancelReasons(),
 	}
 	session.Save(r, w) // Save after getting flashes to clear them
 	tmpl.Execute(w, data)
-}
\ No newline at end of file
+}
@@ -4,9 +4,10 @@ import (
 	"encoding/gob"
 	"log/slog"
 	"net/http"
-	"sync"
+	"slices"
 	"time"
 
+	"github.com/gorilla/csrf"
 	"github.com/gorilla/sessions"
 )
 
@@ -27,7 +28,7 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			"path", r.URL.Path, // Use r.URL.Path instead of r.PathValue("") which is for specific route matches
 			"status", ww.statusCode,
 			"duration", time.Since(start),
-			"ip", r.RemoteAddr,
+			"ip", ClientIP(r),
 		)
 	})
 }
@@ -56,57 +57,16 @@ func SecurityHeadersMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// RateLimiter struct to hold state
-type RateLimiter struct {
-	visitors sync.Map
-	window   time.Duration
-}
-
-// NewRateLimiter creates a new rate limiter with a cleanup goroutine
-func NewRateLimiter(window time.Duration) *RateLimiter {
-	rl := &RateLimiter{
-		window: window,
-	}
-	// Background cleanup
-	go rl.cleanup()
-	return rl
-}
-
-// cleanup removes old entries to prevent memory leaks
-func (rl *RateLimiter) cleanup() {
-	for {
-		time.Sleep(time.Minute)
-		now := time.Now()
-		rl.visitors.Range(func(key, value interface{}) bool {
-			lastSeen := value.(time.Time)
-			if now.Sub(lastSeen) > rl.window {
-				rl.visitors.Delete(key)
-			}
-			return true
-		})
-	}
-}
-
-// Middleware enforces the rate limit
-func (rl *RateLimiter) Middleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Only rate limit POST requests or specific actions if needed, 
-		// but for this general middleware, we assume it's applied to specific routes.
-		ip := r.RemoteAddr 
-
-		if lastSeen, ok := rl.visitors.Load(ip); ok {
-			if time.Since(lastSeen.(time.Time)) < rl.window {
-				slog.Warn("Rate limit exceeded", "ip", ip)
-				// Optionally add a Flash message if sessions are available/wanted here, 
-				// but a simple error is standard for 429.
-				http.Error(w, "Too Many Requests. Please try again later.", http.StatusTooManyRequests)
-				return
-			}
+// SkipCSRF lets requests to the given paths through next's CSRF check. Only
+// use it for endpoints that authenticate requests another way, such as
+// signed webhooks.
+func SkipCSRF(paths []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(paths, r.URL.Path) {
+			r = csrf.UnsafeSkipCheck(r)
 		}
-
-		rl.visitors.Store(ip, time.Now())
-		next(w, r)
-	}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // FlashMessage structure
@@ -115,6 +75,16 @@ type FlashMessage struct {
 	Message string
 }
 
+// saveAndRedirect persists the session (and any flashes) and then redirects.
+// The session must be saved first: once Redirect writes the headers, the
+// Set-Cookie header from a deferred Save is silently dropped.
+func saveAndRedirect(w http.ResponseWriter, r *http.Request, session *sessions.Session, url string) {
+	if err := session.Save(r, w); err != nil {
+		slog.Error("Failed to save session", "error", err)
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
 // GetFlash retrieves flash messages from the session
 func GetFlash(session *sessions.Session) []FlashMessage {
 	flashes := session.Flashes()
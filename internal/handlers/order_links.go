@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/store"
+	"github.com/gorilla/sessions"
+)
+
+// orderLinkValidFor is how long an emailed order link keeps working.
+const orderLinkValidFor = 30 * 24 * time.Hour
+
+// orderAccessKey lists, in the order-session, the link hashes of orders this
+// browser has opened with their emailed link. Storing the hash rather than
+// the order ID means revoking or reissuing a link also cuts off browsers
+// that used the old one.
+const orderAccessKey = "order_links"
+
+// maxOrderAccess bounds how many orders one session remembers.
+const maxOrderAccess = 20
+
+func grantOrderAccess(session *sessions.Session, order *models.Order) {
+	hashes, _ := session.Values[orderAccessKey].([]string)
+	if slices.Contains(hashes, order.MagicTokenHash) {
+		return
+	}
+	hashes = append(hashes, order.MagicTokenHash)
+	if len(hashes) > maxOrderAccess {
+		hashes = hashes[len(hashes)-maxOrderAccess:]
+	}
+	session.Values[orderAccessKey] = hashes
+}
+
+// orderForSession loads the order with the given reference if this session
+// may see it: either the signed-in customer owns it, or the browser opened
+// its current, unexpired link. Otherwise it returns nil.
+func (h *OrderHandler) orderForSession(session *sessions.Session, ref string) *models.Order {
+	order, err := h.Store.GetOrderByRef(ref)
+	if err != nil {
+		return nil
+	}
+	if customer, _ := h.currentCustomer(session); customer != nil && order.CustomerID == customer.ID {
+		return order
+	}
+	hashes, _ := session.Values[orderAccessKey].([]string)
+	if order.MagicTokenHash != "" && time.Now().Before(order.MagicTokenExpiry) && slices.Contains(hashes, order.MagicTokenHash) {
+		return order
+	}
+	return nil
+}
+
+// issueOrderLink replaces the order's link with a new one and emails it;
+// baseURL is the site's public address.
+func issueOrderLink(s *store.Store, baseURL string, order *models.Order) error {
+	token := generateToken()
+	if err := s.SetOrderToken(order.ID, token, orderLinkValidFor); err != nil {
+		return err
+	}
+	order.MagicToken = token
+	order.MagicTokenHash = store.HashToken(token)
+	order.MagicTokenExpiry = time.Now().Add(orderLinkValidFor)
+
+	// MOCK EMAIL
+	slog.Info("==========================================")
+	slog.Info("📧 EMAIL SENT TO: " + order.CustomerEmail)
+	slog.Info("Subject: Your new order link - Crochet by Juliette")
+	slog.Info("Order Reference: " + order.OrderRef)
+	slog.Info("Your Magic Link: " + baseURL + "/order/status/" + token)
+	slog.Info("==========================================")
+	return nil
+}
+
+// ReissueOrderLink lets a customer replace their order link, e.g. if they
+// forwarded the email by mistake. The old link stops working.
+func (h *OrderHandler) ReissueOrderLink(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+	ref := r.FormValue("ref")
+	order := h.orderForSession(session, ref)
+	if order == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Order not found.")})
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+
+	if err := issueOrderLink(h.Store, h.BaseURL, order); err != nil {
+		slog.Error("Failed to reissue order link", "order_id", order.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Error generating a new link. Please try again.")})
+		saveAndRedirect(w, r, session, "/orders/"+order.OrderRef)
+		return
+	}
+
+	// Keep this browser's access; everyone holding the old link loses it.
+	grantOrderAccess(session, order)
+	slog.Info("Order link reissued by customer", "order_id", order.ID)
+	session.AddFlash(FlashMessage{Type: "success", Message: tr.T("A new link has been emailed to you. The old link no longer works.")})
+	saveAndRedirect(w, r, session, "/orders/"+order.OrderRef)
+}
+
+// RevokeOrderLink disables an order's link without sending a new one.
+// Signed-in customers can still see the order from My Orders.
+func (h *OrderHandler) RevokeOrderLink(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+	ref := r.FormValue("ref")
+	order := h.orderForSession(session, ref)
+	if order == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Order not found.")})
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+
+	if err := h.Store.RevokeOrderToken(order.ID); err != nil {
+		slog.Error("Failed to revoke order link", "order_id", order.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Error disabling the link.")})
+		saveAndRedirect(w, r, session, "/orders/"+order.OrderRef)
+		return
+	}
+
+	slog.Info("Order link revoked by customer", "order_id", order.ID)
+	session.AddFlash(FlashMessage{Type: "success", Message: tr.T("The link for this order has been disabled. Sign in to see your orders, or ask for a new link.")})
+	if customer, _ := h.currentCustomer(session); customer != nil && order.CustomerID == customer.ID {
+		saveAndRedirect(w, r, session, "/orders/"+order.OrderRef)
+		return
+	}
+	saveAndRedirect(w, r, session, "/status-request")
+}
+
+// AdminReissueOrderLink emails the customer a new link, revoking the old one.
+func (h *AdminHandler) AdminReissueOrderLink(w http.ResponseWriter, r *http.Request) {
+	h.adminOrderLinkAction(w, r, func(order *models.Order) (string, error) {
+		if err := issueOrderLink(h.Store, h.BaseURL, order); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("New link sent to %s for order %s.", order.CustomerEmail, order.OrderRef), nil
+	})
+}
+
+// AdminRevokeOrderLink disables an order's link, e.g. if it was shared.
+func (h *AdminHandler) AdminRevokeOrderLink(w http.ResponseWriter, r *http.Request) {
+	h.adminOrderLinkAction(w, r, func(order *models.Order) (string, error) {
+		if err := h.Store.RevokeOrderToken(order.ID); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Link for order %s disabled.", order.OrderRef), nil
+	})
+}
+
+func (h *AdminHandler) adminOrderLinkAction(w http.ResponseWriter, r *http.Request, action func(*models.Order) (string, error)) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid ID."})
+		saveAndRedirect(w, r, session, "/admin/orders")
+		return
+	}
+	order, err := h.Store.GetOrderByID(id)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Order not found."})
+		saveAndRedirect(w, r, session, "/admin/orders")
+		return
+	}
+
+	msg, err := action(order)
+	if err != nil {
+		slog.Error("Order link action failed", "order_id", order.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error updating the order link."})
+		saveAndRedirect(w, r, session, "/admin/orders")
+		return
+	}
+
+	slog.Info("Order link changed by admin", "user_id", CurrentUser(r).ID, "order_id", order.ID, "path", r.URL.Path)
+	session.AddFlash(FlashMessage{Type: "success", Message: msg})
+	saveAndRedirect(w, r, session, "/admin/orders")
+}
@@ -4,14 +4,24 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"log/slog"
+	"math"
 	"net/http"
-	"regexp"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+	"github.com/alextreichler/crochetbyjuliette/internal/antispam"
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+	"github.com/alextreichler/crochetbyjuliette/internal/discount"
+	"github.com/alextreichler/crochetbyjuliette/internal/emailaddr"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
 	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/payments"
 	"github.com/alextreichler/crochetbyjuliette/internal/store"
+	"github.com/alextreichler/crochetbyjuliette/internal/tax"
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/sessions"
 )
@@ -19,7 +29,33 @@ import (
 type OrderHandler struct {
 	Store        *store.Store
 	Templates    *TemplateCache
-	SessionStore *sessions.CookieStore
+	SessionStore *store.SessionStore
+
+	// Spam checks the public forms. OrdersPerEmail (per day) and
+	// StatusLinksPerEmail (per hour) cap submissions for one address.
+	Spam                *antispam.Guard
+	OrdersPerEmail      int
+	StatusLinksPerEmail int
+
+	// Payments takes online payments; nil means payment is always arranged
+	// in person. Currency is what it charges in.
+	Payments payments.Provider
+	Currency string
+
+	// BaseURL is the site's public address, for emailed links and where the
+	// payment provider sends customers back to.
+	BaseURL string
+
+	// Tax is how tax is charged on orders.
+	Tax tax.Settings
+
+	// Money writes amounts in the shop's currency.
+	Money currency.Formatter
+
+	// Messages translates the customer pages.
+	Messages *i18n.Bundle
+
+	Invoicing Invoicing
 }
 
 func (h *OrderHandler) OrderForm(w http.ResponseWriter, r *http.Request) {
@@ -31,27 +67,132 @@ func (h *OrderHandler) OrderForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	item, err := h.Store.GetItemByID(id)
+	item, err := h.Store.GetItemByID(id, h.printer(w, r).Lang)
 	if err != nil {
 		http.Error(w, "Item not found", http.StatusNotFound)
 		return
 	}
 
-	tmpl := h.Templates.Get("order.html")
+	session, _ := h.SessionStore.Get(r, "order-session")
+	h.renderOrderForm(w, r, session, item, nil, nil)
+}
+
+// renderOrderForm renders order.html, re-populating it with previously submitted
+// values and showing per-field validation errors next to each input.
+func (h *OrderHandler) renderOrderForm(w http.ResponseWriter, r *http.Request, session *sessions.Session, item *models.Item, values url.Values, errors map[string]string) {
+	tr := h.printer(w, r)
+	tmpl := h.Templates.GetLang("order.html", tr.Lang)
 	if tmpl == nil {
 		http.Error(w, "Template not found", http.StatusInternalServerError)
 		return
 	}
-	session, _ := h.SessionStore.Get(r, "order-session")
 	data := map[string]interface{}{
-		"Item":      item,
-		"CsrfField": csrf.TemplateField(r),
-		"Flashes":   GetFlash(session),
+		"Item":       item,
+		"Lang":       tr.Lang,
+		"CsrfField":  csrf.TemplateField(r),
+		"Flashes":    GetFlash(session),
+		"Values":     values,
+		"Errors":     errors,
+		"SpamFields": h.Spam.Fields(),
+		"Countries":  address.Countries,
+		"Country":    address.DefaultCountry,
+		"PaymentMethods": h.paymentMethods(),
+	}
+
+	// Signed-in customers can pick a saved address, and a fresh form starts
+	// with their details and default address filled in.
+	customer, err := h.currentCustomer(session)
+	if err != nil {
+		slog.Error("Failed to load customer", "error", err)
+	}
+	if customer != nil {
+		addresses, err := h.Store.ListCustomerAddresses(customer.ID)
+		if err != nil {
+			slog.Error("Failed to load addresses", "customer_id", customer.ID, "error", err)
+		}
+		data["Addresses"] = addresses
+		if values == nil {
+			values = url.Values{}
+			values.Set("name", customer.Name)
+			values.Set("email", customer.Email)
+			if len(addresses) > 0 {
+				setAddressValues(values, addresses[0].Address)
+			}
+			data["Values"] = values
+		}
+	}
+
+	// Delivery options depend on the quantity and destination, so quote
+	// them for whatever the form holds; the page re-quotes as they change.
+	quantity, err := strconv.Atoi(values.Get("quantity"))
+	if err != nil || quantity < 1 {
+		quantity = 1
+	}
+	country := values.Get("ship_country")
+	if country == "" {
+		country = address.DefaultCountry
 	}
+	table, err := h.Store.ShippingTable()
+	if err != nil {
+		slog.Error("Failed to load shipping methods", "error", err)
+	}
+	options := quoteOrder(table, item, quantity, country)
+	selected, _ := strconv.Atoi(values.Get("shipping_method"))
+	option, ok := findOption(options, selected)
+	if !ok && len(options) > 0 {
+		option = options[0]
+	}
+	data["ShippingOptions"] = options
+	data["ShippingMethod"] = option.Method.ID
+	data["Pickup"] = option.Method.IsPickup()
+	taxes, err := h.Store.TaxTable(h.Tax)
+	if err != nil {
+		slog.Error("Failed to load tax rates", "error", err)
+	}
+	subtotal := item.Price * float64(quantity)
+	amountOff := 0.0
+	if entered := values.Get("discount_code"); strings.TrimSpace(entered) != "" && errors["discount_code"] == "" {
+		code, _, err := h.checkDiscount(tr, entered, item.ID, subtotal, "")
+		if err != nil {
+			slog.Error("Failed to check discount code", "error", err)
+		} else if code != nil {
+			amountOff = code.Amount(subtotal)
+		}
+	}
+	dest := address.Address{Country: country, Region: values.Get("ship_region")}.Normalize()
+	optionTaxes := make(map[int]float64)
+	for _, o := range options {
+		optionTaxes[o.Method.ID] = quoteTax(taxes, item, quantity, amountOff, o, dest)
+	}
+	data["OptionTaxes"] = optionTaxes
+	data["Subtotal"] = subtotal
+	data["Discount"] = amountOff
+	data["ShippingFee"] = option.Fee
+	data["Tax"] = optionTaxes[option.Method.ID]
+	data["TaxInclusive"] = h.Tax.Inclusive
+	data["Total"] = subtotal - amountOff + option.Fee
+	if !h.Tax.Inclusive {
+		data["Total"] = subtotal - amountOff + option.Fee + optionTaxes[option.Method.ID]
+	}
+	data["Deposit"] = item.Deposit(item.Price, quantity)
+	data["Locale"] = h.Money.Locale.String()
+	data["Display"] = displayRate(h.Store, h.SessionStore, h.Money.Base, w, r)
+
 	session.Save(r, w)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
 	tmpl.Execute(w, data)
 }
 
+// stockMessage tells the customer how many of an item are left.
+func stockMessage(tr i18n.Printer, stock int) string {
+	if stock <= 0 {
+		return tr.T("Sorry, this item is out of stock.")
+	}
+	return tr.T("Sorry, only %d left in stock.", stock)
+}
+
 func generateToken() string {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
@@ -74,26 +215,46 @@ func generateOrderRef() string {
 }
 
 func (h *OrderHandler) SubmitOrder(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
 	session, _ := h.SessionStore.Get(r, "order-session") // Using a different session store for public orders
-	defer session.Save(r, w)
 
 	if err := r.ParseForm(); err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid form data."})
-		http.Redirect(w, r, r.Referer(), http.StatusSeeOther) // Redirect back to form
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Invalid form data.")})
+		saveAndRedirect(w, r, session, "/")
 		return
 	}
 
 	itemID, err := strconv.Atoi(r.FormValue("item_id"))
 	if err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid item ID."})
-		http.Redirect(w, r, "/", http.StatusSeeOther) // Redirect to home
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Invalid item ID.")})
+		saveAndRedirect(w, r, session, "/") // Redirect to home
+		return
+	}
+
+	item, err := h.Store.GetItemByID(itemID, tr.Lang)
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Item not found.")})
+		saveAndRedirect(w, r, session, "/")
+		return
+	}
+
+	if err := h.Spam.Check(r); err != nil {
+		slog.Warn("Order form rejected", "reason", err, "ip", ClientIP(r))
+		if err == antispam.ErrHoneypot {
+			// Look like a success so the bot has nothing to learn from
+			session.AddFlash(FlashMessage{Type: "success", Message: tr.T("Order placed successfully! Check your email for details.")})
+			saveAndRedirect(w, r, session, "/")
+			return
+		}
+		session.AddFlash(FlashMessage{Type: "error", Message: spamMessage(tr, err)})
+		h.renderOrderForm(w, r, session, item, r.PostForm, nil)
 		return
 	}
 
 	name := r.FormValue("name")
 	email := r.FormValue("email")
-	address := r.FormValue("address")
-	deliveryMethod := r.FormValue("delivery_method")
+	shippingAddress := addressFromForm(r)
+	methodID, _ := strconv.Atoi(r.FormValue("shipping_method"))
 	paymentMethod := r.FormValue("payment_method")
 	notes := r.FormValue("notes")
 	qtyStr := r.FormValue("quantity")
@@ -107,29 +268,71 @@ func (h *OrderHandler) SubmitOrder(w http.ResponseWriter, r *http.Request) {
 	// Validation
 	errors := make(map[string]string)
 	if name == "" {
-		errors["name"] = "Your name is required."
+		errors["name"] = tr.T("Your name is required.")
 	}
 	if email == "" {
-		errors["email"] = "Email address is required."
-	} else if !isValidEmail(email) {
-		errors["email"] = "Please enter a valid email address."
+		errors["email"] = tr.T("Email address is required.")
+	} else if email, err = emailaddr.Normalize(email); err != nil {
+		errors["email"] = tr.T("Please enter a valid email address.")
+	} else if n, err := h.Store.CountFormSubmissions(spamFormOrder, email, 24*time.Hour); err != nil {
+		slog.Error("Failed to count orders for email", "error", err)
+	} else if n >= h.OrdersPerEmail {
+		slog.Warn("Order cap reached for email", "ip", ClientIP(r))
+		errors["email"] = tr.T("We've received several orders from this address today. Please email us to place more.")
+	}
+
+	table, err := h.Store.ShippingTable()
+	if err != nil {
+		slog.Error("Failed to load shipping methods", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Failed to place order. Please try again.")})
+		h.renderOrderForm(w, r, session, item, r.PostForm, nil)
+		return
+	}
+	method, ok := table.Method(methodID)
+	deliveryMethod := "shipping"
+	if !ok || !method.Active {
+		errors["shipping_method"] = tr.T("Please choose a delivery option.")
+	} else if method.IsPickup() {
+		deliveryMethod = "hand_delivered"
+	}
+	if deliveryMethod == "shipping" {
+		if shippingAddress.Name == "" {
+			shippingAddress.Name = name
+		}
+		addAddressErrors(shippingAddress, errors)
+	} else {
+		shippingAddress = address.Address{}
 	}
-	if deliveryMethod == "shipping" && address == "" {
-		errors["address"] = "Shipping address is required for shipping."
+	// The fee is always worked out here; the one shown on the form is only a preview
+	option, ok := findOption(quoteOrder(table, item, quantity, shippingAddress.Country), methodID)
+	if !ok && errors["shipping_method"] == "" && errors["ship_country"] == "" {
+		errors["shipping_method"] = tr.T("This delivery option isn't available for your address or order size. Please choose another.")
 	}
-	if deliveryMethod == "" {
-		deliveryMethod = "shipping" // Default
+	if item.TrackStock && quantity > item.Stock {
+		errors["quantity"] = stockMessage(tr, item.Stock)
 	}
 	if paymentMethod == "" {
 		paymentMethod = "in_person" // Default
+	} else if _, ok := payments.LookupMethod(paymentMethod); !ok || (paymentMethod == payments.MethodOnline && !h.onlinePayment()) {
+		errors["payment_method"] = tr.T("Please choose how you'd like to pay.")
+	}
+	var code *discount.Code
+	if entered := r.FormValue("discount_code"); strings.TrimSpace(entered) != "" {
+		var msg string
+		code, msg, err = h.checkDiscount(tr, entered, item.ID, item.Price*float64(quantity), email)
+		if err != nil {
+			slog.Error("Failed to check discount code", "error", err)
+			errors["discount_code"] = tr.T("We couldn't check this code. Please try again.")
+		} else if msg != "" {
+			errors["discount_code"] = msg
+		}
 	}
 
 	if len(errors) > 0 {
-		for _, msg := range errors {
-			session.AddFlash(FlashMessage{Type: "error", Message: msg})
-		}
-		// Redirect back to form, preserving values if possible (not implemented here yet)
-		http.Redirect(w, r, r.Referer(), http.StatusSeeOther) // Redirect back to form
+		// Re-render the form with the submitted values instead of redirecting,
+		// so nothing has to be retyped and we don't rely on the Referer header.
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Please correct the highlighted fields.")})
+		h.renderOrderForm(w, r, session, item, r.PostForm, errors)
 		return
 	}
 
@@ -142,108 +345,193 @@ func (h *OrderHandler) SubmitOrder(w http.ResponseWriter, r *http.Request) {
 		Quantity:        quantity,
 		CustomerName:    name,
 		CustomerEmail:   email,
-		CustomerAddress: address,
+		ShippingAddress: shippingAddress,
 		DeliveryMethod:  deliveryMethod,
+		ShippingMethodID: option.Method.ID,
+		ShippingMethod:  option.Method.Name,
+		ShippingFee:     option.Fee,
+		UnitPrice:       item.Price,
+		Deposit:         item.Deposit(item.Price, quantity),
 		PaymentMethod:   paymentMethod,
 		Status:          "Ordered",
 		Notes:           notes,
 		MagicToken:      token,
-		MagicTokenExpiry: time.Now().Add(30 * 24 * time.Hour),
+		MagicTokenExpiry: time.Now().Add(orderLinkValidFor),
+	}
+	if code != nil {
+		order.DiscountCodeID = code.ID
+		order.DiscountCode = code.Code
+		order.Discount = code.Amount(order.Subtotal())
+	}
+
+	// Link the order to the signed-in customer, or to an existing account
+	// with the same email so it shows up there without another sign-in.
+	customer, err := h.currentCustomer(session)
+	if err == nil && customer == nil {
+		customer, err = h.Store.GetCustomerByEmail(email)
+	}
+	if err != nil {
+		slog.Error("Failed to look up customer for order", "error", err)
+	} else if customer != nil {
+		order.CustomerID = customer.ID
+	}
+
+	taxes, err := h.Store.TaxTable(h.Tax)
+	if err != nil {
+		slog.Error("Failed to load tax rates", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Failed to place order. Please try again.")})
+		h.renderOrderForm(w, r, session, item, r.PostForm, nil)
+		return
+	}
+	taxOrder(taxes, item.TaxClass, order)
+	// A discount can bring the total below the deposit
+	order.Deposit = math.Min(order.Deposit, order.Total())
+
+	if item.TrackStock {
+		// Someone else may have bought the last ones since the check above
+		taken, err := h.Store.TakeStock(item.ID, quantity)
+		if err != nil || !taken {
+			if err != nil {
+				slog.Error("Failed to take stock", "item_id", item.ID, "error", err)
+			}
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Sorry, we don't have enough of this item left. Please try a smaller quantity.")})
+			h.renderOrderForm(w, r, session, item, r.PostForm, nil)
+			return
+		}
+		order.StockReserved = quantity
 	}
 
 	if err := h.Store.CreateOrder(order); err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Failed to place order. Please try again."})
-		http.Redirect(w, r, r.Referer(), http.StatusSeeOther) // Redirect back to form
+		if order.StockReserved > 0 {
+			if err := h.Store.ReturnStock(item.ID, order.StockReserved); err != nil {
+				slog.Error("Failed to return stock", "item_id", item.ID, "error", err)
+			}
+		}
+		if usedUp(err) {
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Please correct the highlighted fields.")})
+			h.renderOrderForm(w, r, session, item, r.PostForm, map[string]string{"discount_code": discountMessage(tr, err, code, h.Money)})
+			return
+		}
+		slog.Error("Failed to create order", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Failed to place order. Please try again.")})
+		h.renderOrderForm(w, r, session, item, r.PostForm, nil)
 		return
 	}
 
+	if err := h.Store.RecordFormSubmission(spamFormOrder, email, ClientIP(r)); err != nil {
+		slog.Error("Failed to record order submission", "error", err)
+	}
+
 	// MOCK EMAIL SENDING
 	slog.Info("==========================================")
 	slog.Info("📧 EMAIL SENT TO: " + email)
 	slog.Info("Subject: Order Confirmation - Crochet by Juliette")
 	slog.Info("Order Reference: " + orderRef)
-	slog.Info("Your Magic Link: http://localhost:8585/order/status/" + token)
+	slog.Info("Delivery: " + order.ShippingMethod + " (" + h.Money.Format(order.ShippingFee) + ")")
+	if order.Discount > 0 {
+		slog.Info("Discount: " + order.DiscountCode + " (-" + h.Money.Format(order.Discount) + ")")
+	}
+	slog.Info("Your Magic Link: " + h.BaseURL + "/order/status/" + token)
+	h.attachInvoice(order.ID)
 	slog.Info("==========================================")
 
-	session.AddFlash(FlashMessage{Type: "success", Message: "Order placed successfully! Check your email for details."})
-	// Redirect directly to the Order Status page (Magic Link)
-	http.Redirect(w, r, "/order/status/"+token, http.StatusSeeOther)
-}
+	// Let this browser see the order straight away, without the emailed link
+	order.MagicTokenHash = store.HashToken(token)
+	grantOrderAccess(session, order)
+
+	if paymentMethod == payments.MethodOnline {
+		// Made-to-order items only take the deposit up front
+		amount := order.Balance()
+		if order.Deposit > 0 {
+			amount = order.Deposit
+		}
+		checkoutURL, err := h.startCheckout(r.Context(), order, amount)
+		if err == nil {
+			saveAndRedirect(w, r, session, checkoutURL)
+			return
+		}
+		slog.Error("Failed to start checkout", "order_id", order.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Your order was placed, but we couldn't start the payment. You can pay from this page later.")})
+		saveAndRedirect(w, r, session, "/orders/"+orderRef)
+		return
+	}
 
-// Basic email validation regex
-var emailRegex = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
-func isValidEmail(email string) bool {
-	return emailRegex.MatchString(email)
+	session.AddFlash(FlashMessage{Type: "success", Message: tr.T("Order placed successfully! Check your email for details.")})
+	saveAndRedirect(w, r, session, "/orders/"+orderRef)
 }
 
 func (h *OrderHandler) EditOrderForm(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
 	session, _ := h.SessionStore.Get(r, "order-session")
-	defer session.Save(r, w)
 
-	path := r.URL.Path
-	parts := strings.Split(path, "/")
-	if len(parts) < 4 {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid link."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
-		return
-	}
-	token := parts[3]
-
-	order, err := h.Store.GetOrderByToken(token)
-	if err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Order not found."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+	order := h.orderForSession(session, r.PathValue("ref"))
+	if order == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Order not found.")})
+		saveAndRedirect(w, r, session, "/status-request")
 		return
 	}
 
 	if order.Status != "Ordered" {
-		session.AddFlash(FlashMessage{Type: "error", Message: "This order cannot be edited anymore."})
-		http.Redirect(w, r, "/order/status/"+token, http.StatusSeeOther)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("This order cannot be edited anymore.")})
+		saveAndRedirect(w, r, session, "/orders/"+order.OrderRef)
 		return
 	}
 
-	tmpl := h.Templates.Get("edit_order.html")
+	h.renderEditOrderForm(w, r, session, order, nil)
+}
+
+// renderEditOrderForm renders edit_order.html for the given order. On a failed
+// update the order carries the submitted values, so the form stays filled in.
+func (h *OrderHandler) renderEditOrderForm(w http.ResponseWriter, r *http.Request, session *sessions.Session, order *models.Order, errors map[string]string) {
+	tr := h.printer(w, r)
+	tmpl := h.Templates.GetLang("edit_order.html", tr.Lang)
 	if tmpl == nil {
 		http.Error(w, "Template not found", http.StatusInternalServerError)
 		return
 	}
-	
+
 	data := map[string]interface{}{
+		"Lang":      tr.Lang,
 		"Order":     order,
 		"CsrfField": csrf.TemplateField(r),
 		"Flashes":   GetFlash(session),
+		"Errors":    errors,
+		"Countries": address.Countries,
+	}
+	session.Save(r, w)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
 	}
 	tmpl.Execute(w, data)
 }
 
 func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
 	session, _ := h.SessionStore.Get(r, "order-session")
-	defer session.Save(r, w)
 
 	if err := r.ParseForm(); err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid form data."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Invalid form data.")})
+		saveAndRedirect(w, r, session, "/status-request")
 		return
 	}
 
-	token := r.FormValue("token")
-	order, err := h.Store.GetOrderByToken(token)
-	if err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Order not found."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+	order := h.orderForSession(session, r.FormValue("ref"))
+	if order == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Order not found.")})
+		saveAndRedirect(w, r, session, "/status-request")
 		return
 	}
+	orderURL := "/orders/" + order.OrderRef
 
 	if order.Status != "Ordered" {
-		session.AddFlash(FlashMessage{Type: "error", Message: "This order cannot be edited."})
-		http.Redirect(w, r, "/order/status/"+token, http.StatusSeeOther)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("This order cannot be edited.")})
+		saveAndRedirect(w, r, session, orderURL)
 		return
 	}
 
 	// Update fields
 	name := r.FormValue("name")
 	email := r.FormValue("email")
-	address := r.FormValue("address")
 	notes := r.FormValue("notes")
 	qtyStr := r.FormValue("quantity")
 	quantity := order.Quantity
@@ -253,53 +541,253 @@ func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Basic Validation
-	if name == "" || email == "" || address == "" {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Name, Email, and Address are required."})
-		http.Redirect(w, r, "/order/edit/"+token, http.StatusSeeOther)
-		return
-	}
-
 	order.CustomerName = name
 	order.CustomerEmail = email
-	order.CustomerAddress = address
+	if order.DeliveryMethod == "shipping" {
+		order.ShippingAddress = addressFromForm(r)
+		if order.ShippingAddress.Name == "" {
+			order.ShippingAddress.Name = name
+		}
+	}
 	order.Notes = notes
+	// The deposit was agreed per item when ordering, so it scales with the
+	// quantity rather than following later changes to the item.
+	order.Deposit = math.Round(order.Deposit/float64(order.Quantity)*float64(quantity)*100) / 100
+	oldQuantity := order.Quantity
 	order.Quantity = quantity
 
-	if err := h.Store.UpdateOrderDetails(order); err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Failed to update order."})
-		http.Redirect(w, r, "/order/edit/"+token, http.StatusSeeOther)
+	// Basic Validation
+	errors := make(map[string]string)
+	if name == "" {
+		errors["name"] = tr.T("Your name is required.")
+	}
+	if email == "" {
+		errors["email"] = tr.T("Email address is required.")
+	} else if normalized, err := emailaddr.Normalize(email); err != nil {
+		errors["email"] = tr.T("Please enter a valid email address.")
+	} else {
+		order.CustomerEmail = normalized
+	}
+	if order.DeliveryMethod == "shipping" {
+		addAddressErrors(order.ShippingAddress, errors)
+	}
+	if len(errors) == 0 && order.ShippingMethodID != 0 {
+		if errMsg, err := h.requoteShipping(tr, order); err != nil {
+			slog.Error("Failed to requote shipping", "order_id", order.ID, "error", err)
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Failed to update order.")})
+			h.renderEditOrderForm(w, r, session, order, nil)
+			return
+		} else if errMsg != "" {
+			errors["shipping_method"] = errMsg
+		}
+	}
+	if len(errors) == 0 {
+		if err := h.rediscountOrder(order, oldQuantity); err != nil {
+			slog.Error("Failed to update discount", "order_id", order.ID, "error", err)
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Failed to update order.")})
+			h.renderEditOrderForm(w, r, session, order, nil)
+			return
+		}
+		if err := h.retaxOrder(order); err != nil {
+			slog.Error("Failed to work out tax", "order_id", order.ID, "error", err)
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Failed to update order.")})
+			h.renderEditOrderForm(w, r, session, order, nil)
+			return
+		}
+		order.Deposit = math.Min(order.Deposit, order.Total())
+	}
+
+	// Orders that took stock take or give back the difference
+	reserved := order.StockReserved
+	if len(errors) == 0 && reserved > 0 && quantity != reserved {
+		taken := true
+		var err error
+		if quantity > reserved {
+			taken, err = h.Store.TakeStock(order.ItemID, quantity-reserved)
+		} else {
+			err = h.Store.ReturnStock(order.ItemID, reserved-quantity)
+		}
+		if err != nil {
+			slog.Error("Failed to update stock", "order_id", order.ID, "error", err)
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Failed to update order.")})
+			h.renderEditOrderForm(w, r, session, order, nil)
+			return
+		}
+		if taken {
+			order.StockReserved = quantity
+		} else {
+			errors["quantity"] = tr.T("Sorry, we don't have enough of this item left for that many.")
+		}
+	}
+
+	if len(errors) > 0 {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Please correct the highlighted fields.")})
+		h.renderEditOrderForm(w, r, session, order, errors)
+		return
+	}
+
+	updated, err := h.Store.UpdateOrderDetails(order)
+	if err != nil || !updated {
+		// Undo the stock change. If the order was cancelled meanwhile, the
+		// cancellation returned what it had reserved before this change.
+		var stockErr error
+		if order.StockReserved > reserved {
+			stockErr = h.Store.ReturnStock(order.ItemID, order.StockReserved-reserved)
+		} else if order.StockReserved < reserved {
+			_, stockErr = h.Store.TakeStock(order.ItemID, reserved-order.StockReserved)
+		}
+		if stockErr != nil {
+			slog.Error("Failed to restore stock", "order_id", order.ID, "error", stockErr)
+		}
+		if !updated && err == nil {
+			session.AddFlash(FlashMessage{Type: "error", Message: tr.T("This order cannot be edited.")})
+			saveAndRedirect(w, r, session, orderURL)
+			return
+		}
+		slog.Error("Failed to update order", "order_id", order.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Failed to update order.")})
+		h.renderEditOrderForm(w, r, session, order, nil)
 		return
 	}
 
-	session.AddFlash(FlashMessage{Type: "success", Message: "Order updated successfully!"})
-	http.Redirect(w, r, "/order/status/"+token, http.StatusSeeOther)
+	session.AddFlash(FlashMessage{Type: "success", Message: tr.T("Order updated successfully!")})
+	saveAndRedirect(w, r, session, orderURL)
+}
+
+// requoteShipping updates the shipping fee after the quantity or address of
+// an order changed. It returns a message for the customer if the order's
+// delivery option no longer applies. Orders whose method has since been
+// deleted keep the fee they were placed with.
+func (h *OrderHandler) requoteShipping(tr i18n.Printer, order *models.Order) (string, error) {
+	table, err := h.Store.ShippingTable()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := table.Method(order.ShippingMethodID); !ok {
+		return "", nil
+	}
+	item, err := h.Store.GetItemByID(order.ItemID, "")
+	if err != nil {
+		return "", err
+	}
+	option, ok := findOption(quoteOrder(table, item, order.Quantity, order.ShippingAddress.Country), order.ShippingMethodID)
+	if !ok {
+		return tr.T("%s isn't available for this address or quantity. Please contact us to change how your order is delivered.", order.ShippingMethod), nil
+	}
+	order.ShippingFee = option.Fee
+	return "", nil
+}
+
+// retaxOrder works out the tax again after the quantity, address or
+// shipping fee of an order changed, at today's rates. Prices keep including
+// tax, or not, as they did when the order was placed.
+func (h *OrderHandler) retaxOrder(order *models.Order) error {
+	item, err := h.Store.GetItemByID(order.ItemID, "")
+	if err != nil {
+		return err
+	}
+	table, err := h.Store.TaxTable(h.Tax)
+	if err != nil {
+		return err
+	}
+	table.Inclusive = order.TaxInclusive
+	taxOrder(table, item.TaxClass, order)
+	return nil
 }
 
 func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
 	session, _ := h.SessionStore.Get(r, "order-session")
-	defer session.Save(r, w)
 
-	token := r.FormValue("token")
-	order, err := h.Store.GetOrderByToken(token)
-	if err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Order not found."})
-		http.Redirect(w, r, "/status-request", http.StatusSeeOther)
+	order := h.orderForSession(session, r.FormValue("ref"))
+	if order == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Order not found.")})
+		saveAndRedirect(w, r, session, "/status-request")
 		return
 	}
+	orderURL := "/orders/" + order.OrderRef
 
-	if order.Status != "Ordered" {
-		session.AddFlash(FlashMessage{Type: "error", Message: "This order cannot be cancelled."})
-		http.Redirect(w, r, "/order/status/"+token, http.StatusSeeOther)
+	if !slices.Contains(models.CancellableStatuses(models.CancelledByCustomer), order.Status) {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("This order cannot be cancelled.")})
+		saveAndRedirect(w, r, session, orderURL)
 		return
 	}
 
-	if err := h.Store.CancelOrder(order.ID); err != nil {
-		session.AddFlash(FlashMessage{Type: "error", Message: "Failed to cancel order."})
-		http.Redirect(w, r, "/order/status/"+token, http.StatusSeeOther)
+	cancellation, errMsg := cancellationFromForm(tr, r, order.ID, models.CancelledByCustomer)
+	if reason, ok := models.LookupCancelReason(cancellation.Reason); errMsg == "" && (!ok || !reason.Customer) {
+		errMsg = tr.T("Please choose a reason for cancelling.")
+	}
+	if errMsg != "" {
+		session.AddFlash(FlashMessage{Type: "error", Message: errMsg})
+		saveAndRedirect(w, r, session, orderURL)
 		return
 	}
 
-	session.AddFlash(FlashMessage{Type: "success", Message: "Order cancelled successfully."})
-	http.Redirect(w, r, "/order/status/"+token, http.StatusSeeOther)
-}
\ No newline at end of file
+	cancelled, err := h.Store.CancelOrder(cancellation)
+	if err != nil {
+		slog.Error("Failed to cancel order", "order_id", order.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Failed to cancel order.")})
+		saveAndRedirect(w, r, session, orderURL)
+		return
+	}
+	// Work may have started on it since the page was loaded
+	if !cancelled {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("This order cannot be cancelled.")})
+		saveAndRedirect(w, r, session, orderURL)
+		return
+	}
+	slog.Info("Order cancelled", "order_id", order.ID, "by", cancellation.CancelledBy, "reason", cancellation.Reason)
+
+	message := tr.T("Order cancelled successfully.")
+	order.Status = "Cancelled"
+	if err := h.Store.LoadPayments(order); err != nil {
+		slog.Error("Failed to load payments", "order_id", order.ID, "error", err)
+	} else if refund := order.RefundDue(); refund > 0 {
+		message = tr.T("Order cancelled successfully. We'll refund the %s you paid.", h.Money.Format(refund))
+	}
+	sendCancelledEmail(order, cancellation, h.Money)
+
+	session.AddFlash(FlashMessage{Type: "success", Message: message})
+	saveAndRedirect(w, r, session, orderURL)
+}
+
+// maxCancelNoteLength caps the free-text note on a cancellation.
+const maxCancelNoteLength = 1000
+
+// cancellationFromForm reads the cancellation reason and note, returning a
+// message for the user, in tr's language, if they need correcting.
+func cancellationFromForm(tr i18n.Printer, r *http.Request, orderID int, by string) (*models.Cancellation, string) {
+	c := &models.Cancellation{
+		OrderID:     orderID,
+		Reason:      r.FormValue("cancel_reason"),
+		Note:        strings.TrimSpace(r.FormValue("cancel_note")),
+		CancelledBy: by,
+	}
+	switch _, ok := models.LookupCancelReason(c.Reason); {
+	case !ok:
+		return c, tr.T("Please choose a reason for cancelling.")
+	case c.Reason == "other" && c.Note == "":
+		return c, tr.T("Please add a note explaining why the order is cancelled.")
+	case len(c.Note) > maxCancelNoteLength:
+		return c, tr.T("The cancellation note is too long.")
+	}
+	return c, ""
+}
+
+// sendCancelledEmail tells the customer their order was cancelled.
+// Payments must be loaded.
+func sendCancelledEmail(order *models.Order, c *models.Cancellation, money currency.Formatter) {
+	// MOCK EMAIL
+	slog.Info("==========================================")
+	slog.Info("📧 EMAIL SENT TO: " + order.CustomerEmail)
+	slog.Info("Subject: Order cancelled - Crochet by Juliette")
+	slog.Info("Order Reference: " + order.OrderRef)
+	slog.Info("Reason: " + c.ReasonLabel())
+	if c.Note != "" {
+		slog.Info("Note: " + c.Note)
+	}
+	if refund := order.RefundDue(); refund > 0 {
+		slog.Info("Refund due: " + money.Format(refund))
+	}
+	slog.Info("==========================================")
+}
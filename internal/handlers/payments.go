@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/payments"
+	"github.com/gorilla/csrf"
+)
+
+// maxWebhookSize caps webhook bodies; provider events are a few KB.
+const maxWebhookSize = 1 << 20
+
+// onlinePayment reports whether customers can pay online.
+func (h *OrderHandler) onlinePayment() bool {
+	return h.Payments != nil
+}
+
+// paymentMethods lists the payment methods customers can choose from.
+func (h *OrderHandler) paymentMethods() []payments.Method {
+	if h.onlinePayment() {
+		return payments.Methods
+	}
+	return payments.ManualMethods
+}
+
+// canPayOnline reports whether the customer should be offered to pay for
+// the order online. Payments must be loaded.
+func (h *OrderHandler) canPayOnline(order *models.Order) bool {
+	if !h.onlinePayment() || order.PaymentMethod != payments.MethodOnline || order.Status == "Cancelled" {
+		return false
+	}
+	// Pending payments may be checkouts the customer abandoned; the provider
+	// expires those, but the customer shouldn't have to wait for that.
+	status := order.PaymentStatus()
+	return status != payments.StatusPaid && status != payments.StatusRefunded
+}
+
+// startCheckout records a pending payment of amount towards the order and
+// starts a checkout with the provider, returning the URL to send the
+// customer to. The order's payments must be loaded.
+func (h *OrderHandler) startCheckout(ctx context.Context, order *models.Order, amount float64) (string, error) {
+	item, err := h.Store.GetItemByID(order.ItemID, "")
+	if err != nil {
+		return "", err
+	}
+	if amount <= 0 || amount > order.Balance() {
+		return "", fmt.Errorf("order %d: can't pay %.2f of a %.2f balance", order.ID, amount, order.Balance())
+	}
+	payment := &models.Payment{
+		OrderID:  order.ID,
+		Provider: h.Payments.Name(),
+		Method:   payments.MethodOnline,
+		Amount:   amount,
+		Currency: h.Currency,
+		Status:   payments.StatusPending,
+	}
+	if err := h.Store.CreatePayment(payment); err != nil {
+		return "", err
+	}
+
+	orderURL := h.BaseURL + "/orders/" + url.PathEscape(order.OrderRef)
+	checkout, err := h.Payments.CreateCheckout(ctx, payments.CheckoutRequest{
+		PaymentID:   payment.ID,
+		OrderRef:    order.OrderRef,
+		Description: "Order " + order.OrderRef + " - " + item.Title,
+		Amount:      payments.MinorUnits(payment.Amount, payment.Currency),
+		Currency:    payment.Currency,
+		Email:       order.CustomerEmail,
+		SuccessURL:  orderURL + "?payment=done",
+		CancelURL:   orderURL,
+	})
+	if err != nil {
+		if err := h.Store.UpdatePaymentStatus(payment.ID, payments.StatusFailed, ""); err != nil {
+			slog.Error("Failed to mark payment failed", "payment_id", payment.ID, "error", err)
+		}
+		return "", err
+	}
+	if err := h.Store.SetPaymentCheckout(payment.ID, checkout.ID); err != nil {
+		return "", err
+	}
+	slog.Info("Checkout started", "order_id", order.ID, "payment_id", payment.ID, "provider", payment.Provider)
+	return checkout.URL, nil
+}
+
+// PayOrder sends the customer to pay for an order online, e.g. after an
+// earlier attempt failed or was abandoned. With part=deposit only what is
+// left of the deposit is charged, otherwise the whole balance.
+func (h *OrderHandler) PayOrder(w http.ResponseWriter, r *http.Request) {
+	tr := h.printer(w, r)
+	session, _ := h.SessionStore.Get(r, "order-session")
+	order := h.orderForSession(session, r.FormValue("ref"))
+	if order == nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("Order not found.")})
+		saveAndRedirect(w, r, session, "/status-request")
+		return
+	}
+
+	err := h.Store.LoadPayments(order)
+	if err != nil {
+		slog.Error("Failed to load payments", "order_id", order.ID, "error", err)
+	}
+	if err != nil || !h.canPayOnline(order) {
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("This order can't be paid online.")})
+		saveAndRedirect(w, r, session, "/orders/"+order.OrderRef)
+		return
+	}
+
+	amount := order.Balance()
+	if r.FormValue("part") == "deposit" && order.DepositDue() > 0 {
+		amount = order.DepositDue()
+	}
+	checkoutURL, err := h.startCheckout(r.Context(), order, amount)
+	if err != nil {
+		slog.Error("Failed to start checkout", "order_id", order.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: tr.T("We couldn't start the payment. Please try again later.")})
+		saveAndRedirect(w, r, session, "/orders/"+order.OrderRef)
+		return
+	}
+	saveAndRedirect(w, r, session, checkoutURL)
+}
+
+// PaymentWebhook receives payment events from the provider. It is exempt
+// from CSRF checks; the provider's signature authenticates it instead.
+func (h *OrderHandler) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if !h.onlinePayment() {
+		http.NotFound(w, r)
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	event, err := h.Payments.ParseWebhook(payload, r.Header)
+	if err != nil {
+		slog.Warn("Rejected payment webhook", "error", err, "ip", ClientIP(r))
+		http.Error(w, "Invalid webhook", http.StatusBadRequest)
+		return
+	}
+	if event != nil {
+		if err := h.applyPaymentEvent(event); err != nil {
+			// A 5xx makes the provider retry later
+			slog.Error("Failed to apply payment event", "event_id", event.ID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// applyPaymentEvent updates the payment an event is about. Providers resend
+// events and don't guarantee their order, so repeats are ignored and a paid
+// payment only changes to refunded.
+func (h *OrderHandler) applyPaymentEvent(event *payments.Event) error {
+	provider := h.Payments.Name()
+	var payment *models.Payment
+	var err error
+	if event.CheckoutID != "" {
+		payment, err = h.Store.GetPaymentByCheckout(provider, event.CheckoutID)
+	} else {
+		payment, err = h.Store.GetPaymentByReference(provider, event.Reference)
+	}
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		slog.Warn("Payment event for unknown payment", "event_id", event.ID, "checkout_id", event.CheckoutID, "reference", event.Reference)
+		return nil
+	}
+
+	switch {
+	case event.Status == payment.Status:
+		return nil
+	case event.Status == payments.StatusRefunded && payment.Status != payments.StatusPaid:
+		return nil
+	case event.Status != payments.StatusRefunded && payment.Status != payments.StatusPending && payment.Status != payments.StatusFailed:
+		return nil
+	}
+	// Record what was actually paid, so the order's balance shows anything
+	// still owed (or overpaid) instead of the payment counting in full
+	if event.Status == payments.StatusPaid && event.Amount != 0 && event.Amount != payments.MinorUnits(payment.Amount, payment.Currency) {
+		slog.Warn("Paid amount differs from payment", "payment_id", payment.ID, "expected", payments.MinorUnits(payment.Amount, payment.Currency), "paid", event.Amount)
+		payment.Amount = payments.FromMinorUnits(event.Amount, payment.Currency)
+		if err := h.Store.SetPaymentAmount(payment.ID, payment.Amount); err != nil {
+			return err
+		}
+	}
+
+	var refund *models.Refund
+	if event.Status == payments.StatusRefunded {
+		refund = &models.Refund{
+			OrderID:   payment.OrderID,
+			PaymentID: payment.ID,
+			Method:    payment.Method,
+			Amount:    payment.Amount,
+			Reference: event.Reference,
+		}
+		err = h.Store.RefundPayment(refund)
+	} else {
+		err = h.Store.UpdatePaymentStatus(payment.ID, event.Status, event.Reference)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Payment updated", "payment_id", payment.ID, "order_id", payment.OrderID, "status", event.Status, "event_id", event.ID)
+
+	if refund != nil {
+		order, err := h.Store.GetOrderByID(payment.OrderID)
+		if err != nil {
+			slog.Error("Failed to load order for refund email", "order_id", payment.OrderID, "error", err)
+			return nil
+		}
+		sendRefundEmail(order, refund, h.Money)
+	}
+
+	if event.Status == payments.StatusPaid {
+		order, err := h.Store.GetOrderByID(payment.OrderID)
+		if err != nil {
+			slog.Error("Failed to load order for payment email", "order_id", payment.OrderID, "error", err)
+			return nil
+		}
+		// MOCK EMAIL
+		slog.Info("==========================================")
+		slog.Info("📧 EMAIL SENT TO: " + order.CustomerEmail)
+		slog.Info("Subject: Payment received - Crochet by Juliette")
+		slog.Info("Order Reference: " + order.OrderRef)
+		slog.Info("Amount: " + h.Money.FormatIn(payment.Amount, payment.Currency))
+		slog.Info("==========================================")
+	}
+	return nil
+}
+
+// FakeCheckout is the checkout page of the fake payment provider. It only
+// exists when PAYMENT_PROVIDER=fake.
+func (h *OrderHandler) FakeCheckout(w http.ResponseWriter, r *http.Request) {
+	fake, ok := h.Payments.(*payments.Fake)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	id := r.FormValue("session")
+	req, ok := fake.Checkout(id)
+	if !ok {
+		http.Error(w, "Checkout not found. Fake checkouts are forgotten when the server restarts.", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		status := payments.StatusFailed
+		if r.FormValue("outcome") == "pay" {
+			status = payments.StatusPaid
+		}
+		// Go through the same signed webhook a real provider would send
+		payload, header := fake.Webhook(status, id, req.Amount)
+		event, err := fake.ParseWebhook(payload, header)
+		if err == nil {
+			err = h.applyPaymentEvent(event)
+		}
+		if err != nil {
+			slog.Error("Failed to apply fake payment", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if status == payments.StatusPaid {
+			http.Redirect(w, r, req.SuccessURL, http.StatusSeeOther)
+		} else {
+			http.Redirect(w, r, req.CancelURL, http.StatusSeeOther)
+		}
+		return
+	}
+
+	tmpl := h.Templates.Get("fake_checkout.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, map[string]interface{}{
+		"Session":   id,
+		"Checkout":  req,
+		"Amount":    FormatMoney(float64(req.Amount) / 100),
+		"Currency":  strings.ToUpper(req.Currency),
+		"CsrfField": csrf.TemplateField(r),
+	})
+}
+
+// paymentReturned reports whether the customer just came back from paying
+// and the provider's webhook hasn't arrived yet.
+func paymentReturned(r *http.Request, order *models.Order) bool {
+	return r.URL.Query().Get("payment") == "done" && order.PaymentStatus() == payments.StatusPending
+}
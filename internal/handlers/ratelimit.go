@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter owns a set of rate limit policies and the goroutine that
+// forgets idle clients. Call Stop when the server shuts down.
+type RateLimiter struct {
+	mu       sync.Mutex
+	policies []*RateLimitPolicy
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// RateLimitPolicy is a token bucket per client IP: a client may make Burst
+// requests at once, and regains Burst requests every Per. Each policy keeps
+// its own buckets, so hitting one route's limit doesn't block the others.
+type RateLimitPolicy struct {
+	Name  string
+	Burst int
+	Per   time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter starts a limiter that sweeps idle buckets every
+// cleanupEvery.
+func NewRateLimiter(cleanupEvery time.Duration) *RateLimiter {
+	rl := &RateLimiter{stop: make(chan struct{})}
+	go rl.cleanup(cleanupEvery)
+	return rl
+}
+
+// Policy adds a named policy allowing burst requests per period.
+func (rl *RateLimiter) Policy(name string, burst int, per time.Duration) *RateLimitPolicy {
+	if burst < 1 {
+		burst = 1
+	}
+	p := &RateLimitPolicy{
+		Name:    name,
+		Burst:   burst,
+		Per:     per,
+		buckets: make(map[string]*tokenBucket),
+	}
+	rl.mu.Lock()
+	rl.policies = append(rl.policies, p)
+	rl.mu.Unlock()
+	return p
+}
+
+// Stop ends the cleanup goroutine. Policies keep working afterwards, they
+// just no longer forget idle clients.
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() { close(rl.stop) })
+}
+
+// cleanup removes buckets that have refilled completely, since they are
+// indistinguishable from a client we've never seen.
+func (rl *RateLimiter) cleanup(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rl.stop:
+			return
+		case now := <-ticker.C:
+			rl.mu.Lock()
+			policies := rl.policies
+			rl.mu.Unlock()
+			for _, p := range policies {
+				p.mu.Lock()
+				for key, b := range p.buckets {
+					if p.refill(b, now) >= float64(p.Burst) {
+						delete(p.buckets, key)
+					}
+				}
+				p.mu.Unlock()
+			}
+		}
+	}
+}
+
+// refill tops up b for the time elapsed since it was last used and returns
+// its token count. The caller must hold p.mu.
+func (p *RateLimitPolicy) refill(b *tokenBucket, now time.Time) float64 {
+	rate := float64(p.Burst) / p.Per.Seconds() // tokens per second
+	b.tokens = math.Min(float64(p.Burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	return b.tokens
+}
+
+// take spends a token for key if one is available. It returns the tokens
+// left, and how long until the next token (if refused) or until the bucket
+// is full again (if allowed).
+func (p *RateLimitPolicy) take(key string, now time.Time) (allowed bool, remaining int, wait time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b, ok := p.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(p.Burst), last: now}
+		p.buckets[key] = b
+	}
+	p.refill(b, now)
+
+	perToken := p.Per.Seconds() / float64(p.Burst)
+	if b.tokens < 1 {
+		return false, 0, time.Duration((1 - b.tokens) * perToken * float64(time.Second))
+	}
+	b.tokens--
+	full := (float64(p.Burst) - b.tokens) * perToken
+	return true, int(b.tokens), time.Duration(full * float64(time.Second))
+}
+
+// Middleware enforces the policy, keyed by ClientIP. Responses carry
+// RateLimit-* headers describing the client's quota, and refusals carry
+// Retry-After.
+func (p *RateLimitPolicy) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+		allowed, remaining, wait := p.take(ip, time.Now())
+
+		seconds := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Burst, int(p.Per.Seconds())))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(p.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", seconds)
+
+		if !allowed {
+			slog.Warn("Rate limit exceeded", "ip", ip, "policy", p.Name, "retry_after", seconds)
+			w.Header().Set("Retry-After", seconds)
+			http.Error(w, "Too Many Requests. Please try again later.", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/chart"
+	"github.com/alextreichler/crochetbyjuliette/internal/store"
+)
+
+// maxBuckets caps the bars in a sales chart; longer periods are shown by
+// week or month instead.
+const maxBuckets = 120
+
+// topItemCount is how many items the dashboard ranks by revenue.
+const topItemCount = 10
+
+// salesPeriod reads the dashboard's ?from=, ?to= and ?bucket=, defaulting
+// to the last ?days= days, or 30. Without a bucket, or with one that would
+// give too many bars, the smallest that fits is used.
+func salesPeriod(r *http.Request) (from, to time.Time, bucket string) {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 {
+		days = 30
+	}
+	from, to = parsePeriod(r, today().AddDate(0, 0, 1-days), today())
+	bucket = r.URL.Query().Get("bucket")
+	if !slices.Contains(store.Buckets, bucket) {
+		bucket = store.BucketDay
+	}
+	for _, b := range store.Buckets[slices.Index(store.Buckets, bucket):] {
+		bucket = b
+		if bucketCount(from, to, b) <= maxBuckets {
+			break
+		}
+	}
+	return from, to, bucket
+}
+
+// bucketCount is how many buckets the period from to to spans.
+func bucketCount(from, to time.Time, bucket string) int {
+	switch bucket {
+	case store.BucketWeek:
+		return int(store.BucketStart(to, bucket).Sub(store.BucketStart(from, bucket)).Hours()/(24*7)) + 1
+	case store.BucketMonth:
+		return (to.Year()-from.Year())*12 + int(to.Month()-from.Month()) + 1
+	}
+	return int(to.Sub(from).Hours()/24) + 1
+}
+
+// bucketLabel names the bucket starting at start, for a chart.
+func bucketLabel(start time.Time, bucket string) string {
+	if bucket == store.BucketMonth {
+		return start.Format("Jan 2006")
+	}
+	return start.Format("Jan 2")
+}
+
+// salesCharts lays out the orders and revenue charts of a sales report.
+func salesCharts(report *store.SalesReport, money func(float64) string) (orders, revenue chart.Bars) {
+	var orderPoints, revenuePoints []chart.Point
+	for _, p := range report.Series {
+		label := bucketLabel(p.Start, report.Bucket)
+		orderPoints = append(orderPoints, chart.Point{Label: label, Value: float64(p.Orders)})
+		revenuePoints = append(revenuePoints, chart.Point{Label: label, Value: p.Revenue})
+	}
+	return chart.NewCountBars(orderPoints), chart.NewBars(revenuePoints, money)
+}
+
+// topItem is an item in the dashboard's top items, with its revenue as a
+// percentage of the first's, for its bar.
+type topItem struct {
+	store.ItemRevenue
+	Share float64
+}
+
+// topItems ranks the items in a sales report for the dashboard.
+func topItems(report *store.SalesReport) []topItem {
+	var items []topItem
+	for _, item := range report.TopItems {
+		share := 0.0
+		if best := report.TopItems[0].Revenue; best > 0 {
+			share = max(item.Revenue, 0) / best * 100
+		}
+		items = append(items, topItem{ItemRevenue: item, Share: share})
+	}
+	return items
+}
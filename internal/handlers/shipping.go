@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/shipping"
+)
+
+// FormatMoney formats an amount for display, e.g. "12.50". Templates use it
+// as "money".
+func FormatMoney(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// quoteOrder lists the delivery options for quantity of item sent to country.
+func quoteOrder(table shipping.Table, item *models.Item, quantity int, country string) []shipping.Option {
+	return table.Quote(country, item.Price*float64(quantity), item.Parcel().BillableGrams(quantity))
+}
+
+// findOption returns the option for the method with the given ID.
+func findOption(options []shipping.Option, methodID int) (shipping.Option, bool) {
+	for _, o := range options {
+		if o.Method.ID == methodID {
+			return o, true
+		}
+	}
+	return shipping.Option{}, false
+}
+
+// shippingQuoteOption is one delivery option as returned by ShippingQuote.
+type shippingQuoteOption struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name"`
+	Pickup   bool    `json:"pickup"`
+	Fee      float64 `json:"fee"`
+	FeeLabel string  `json:"fee_label"`
+	Tax      float64 `json:"tax"` // On the whole order, with this option
+}
+
+// ShippingQuote returns the delivery options, discount and tax for an item,
+// quantity, country, region and discount code as JSON, so the order form can
+// update them as the customer types.
+func (h *OrderHandler) ShippingQuote(w http.ResponseWriter, r *http.Request) {
+	itemID, err := strconv.Atoi(r.URL.Query().Get("item_id"))
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	quantity, err := strconv.Atoi(r.URL.Query().Get("quantity"))
+	if err != nil || quantity < 1 {
+		quantity = 1
+	}
+
+	item, err := h.Store.GetItemByID(itemID, "")
+	if err != nil {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	table, err := h.Store.ShippingTable()
+	if err != nil {
+		slog.Error("Failed to load shipping methods", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	taxes, err := h.Store.TaxTable(h.Tax)
+	if err != nil {
+		slog.Error("Failed to load tax rates", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	dest := address.Address{Country: r.URL.Query().Get("country"), Region: r.URL.Query().Get("region")}.Normalize()
+	subtotal := item.Price * float64(quantity)
+	amountOff, discountMessage := 0.0, ""
+	if entered := r.URL.Query().Get("code"); strings.TrimSpace(entered) != "" {
+		code, msg, err := h.checkDiscount(h.printer(w, r), entered, item.ID, subtotal, "")
+		if err != nil {
+			slog.Error("Failed to check discount code", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if code != nil {
+			amountOff = code.Amount(subtotal)
+			discountMessage = code.Label(h.Money.Format)
+		} else {
+			discountMessage = msg
+		}
+	}
+	options := []shippingQuoteOption{}
+	for _, o := range quoteOrder(table, item, quantity, dest.Country) {
+		options = append(options, shippingQuoteOption{
+			ID:       o.Method.ID,
+			Name:     o.Method.Name,
+			Pickup:   o.Method.IsPickup(),
+			Fee:      o.Fee,
+			FeeLabel: h.Money.Format(o.Fee),
+			Tax:      quoteTax(taxes, item, quantity, amountOff, o, dest),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subtotal":         subtotal,
+		"discount":         amountOff,
+		"discount_message": discountMessage, // What the code gives, or why it can't be used
+		"deposit":          item.Deposit(item.Price, quantity),
+		"tax_inclusive":    h.Tax.Inclusive,
+		"options":          options,
+	})
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"github.com/alextreichler/crochetbyjuliette/internal/antispam"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+)
+
+// Form names for per-email submission caps.
+const (
+	spamFormOrder  = "order"
+	spamFormStatus = "status"
+)
+
+// spamMessage tells a (probably human) visitor why their form was refused.
+func spamMessage(tr i18n.Printer, err error) string {
+	switch err {
+	case antispam.ErrTooFast:
+		return tr.T("That was quick! Please check your details and submit the form again.")
+	case antispam.ErrChallengeFail:
+		return tr.T("We couldn't verify your browser. Please make sure JavaScript is enabled and try again.")
+	default:
+		return tr.T("This form has expired. Please submit it again.")
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/alextreichler/crochetbyjuliette/internal/shipping"
+	"github.com/alextreichler/crochetbyjuliette/internal/tax"
+	"github.com/gorilla/csrf"
+)
+
+// taxOrder works out the tax on an order's items and delivery, setting
+// order.Taxes, order.Tax and order.TaxInclusive. Orders that aren't shipped
+// are taxed where the shop is.
+func taxOrder(table tax.Table, class string, order *models.Order) {
+	country, region := "", ""
+	if order.DeliveryMethod == "shipping" {
+		country, region = order.ShippingAddress.Country, order.ShippingAddress.Region
+	}
+	lines := table.Apply(tax.LineItem, class, order.DiscountedSubtotal(), country, region)
+	lines = append(lines, table.Apply(tax.LineShipping, tax.ClassShipping, order.ShippingFee, country, region)...)
+	order.Taxes = lines
+	order.Tax = tax.Total(lines)
+	order.TaxInclusive = table.Inclusive
+}
+
+// quoteTax is the tax on quantity of item, less discount, delivered with
+// option to dest.
+func quoteTax(table tax.Table, item *models.Item, quantity int, discount float64, option shipping.Option, dest address.Address) float64 {
+	order := &models.Order{UnitPrice: item.Price, Quantity: quantity, Discount: discount, ShippingFee: option.Fee, DeliveryMethod: "hand_delivered"}
+	if !option.Method.IsPickup() {
+		order.DeliveryMethod = "shipping"
+		order.ShippingAddress = dest
+	}
+	taxOrder(table, item.TaxClass, order)
+	return order.Tax
+}
+
+// ListTax shows the tax rates and the tax report for the period in ?from=
+// and ?to= (dates, defaulting to this month so far).
+func (h *AdminHandler) ListTax(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.Store.ListTaxRates()
+	if err != nil {
+		slog.Error("Failed to load tax rates", "error", err)
+		http.Error(w, "Error fetching tax rates", http.StatusInternalServerError)
+		return
+	}
+	from, to := reportPeriod(r)
+	report, err := h.Store.TaxReport(from, to)
+	if err != nil {
+		slog.Error("Failed to build tax report", "error", err)
+		http.Error(w, "Error building tax report", http.StatusInternalServerError)
+		return
+	}
+	// Taxable amounts overlap when rates stack, so only the tax is totalled
+	total := 0.0
+	for _, t := range report {
+		total += t.Amount
+	}
+
+	tmpl := h.Templates.Get("admin_tax.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Rates":       rates,
+		"Inclusive":   h.Tax.Inclusive,
+		"Report":      report,
+		"ReportTotal": total,
+		"From":        from.Format("2006-01-02"),
+		"To":          to.Format("2006-01-02"),
+		"CsrfField":   csrf.TemplateField(r),
+		"Flashes":     GetFlash(session),
+		"CurrentUser": CurrentUser(r),
+	}
+	session.Save(r, w)
+	tmpl.Execute(w, data)
+}
+
+// TaxReportCSV downloads the tax report for ?from= to ?to= for bookkeeping.
+func (h *AdminHandler) TaxReportCSV(w http.ResponseWriter, r *http.Request) {
+	from, to := reportPeriod(r)
+	report, err := h.Store.TaxReport(from, to)
+	if err != nil {
+		slog.Error("Failed to build tax report", "error", err)
+		http.Error(w, "Error building tax report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tax-%s-to-%s.csv"`, from.Format("2006-01-02"), to.Format("2006-01-02")))
+	out := csv.NewWriter(w)
+	out.Write([]string{"Tax", "Rate (%)", "Orders", "Taxable amount", "Tax", "Currency"})
+	for _, t := range report {
+		out.Write([]string{
+			t.Name,
+			strconv.FormatFloat(t.Percent, 'f', -1, 64),
+			strconv.Itoa(t.Orders),
+			FormatMoney(t.Taxable),
+			FormatMoney(t.Amount),
+			strings.ToUpper(h.Currency),
+		})
+	}
+	out.Flush()
+}
+
+// reportPeriod reads the ?from= and ?to= dates of a report, defaulting to
+// the start of this month and today.
+func reportPeriod(r *http.Request) (time.Time, time.Time) {
+	now := time.Now().UTC()
+	return parsePeriod(r, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), today())
+}
+
+// today is the start of the current day, in UTC like order dates.
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// parsePeriod reads the ?from= and ?to= dates of a report, defaulting to
+// from and to.
+func parsePeriod(r *http.Request, from, to time.Time) (time.Time, time.Time) {
+	if t, err := time.Parse("2006-01-02", r.URL.Query().Get("from")); err == nil {
+		from = t
+	}
+	if t, err := time.Parse("2006-01-02", r.URL.Query().Get("to")); err == nil {
+		to = t
+	}
+	if to.Before(from) {
+		from, to = to, from
+	}
+	return from, to
+}
+
+// TaxRateForm shows the form for a new rate, or for the rate in ?id=.
+func (h *AdminHandler) TaxRateForm(w http.ResponseWriter, r *http.Request) {
+	rate := &tax.Rate{Country: address.DefaultCountry, Class: tax.ClassStandard}
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		rate, err = h.Store.GetTaxRate(id)
+		if err != nil {
+			http.Error(w, "Error fetching tax rate", http.StatusInternalServerError)
+			return
+		}
+		if rate == nil {
+			http.Error(w, "Tax rate not found", http.StatusNotFound)
+			return
+		}
+	}
+	h.renderTaxRateForm(w, r, rate, nil)
+}
+
+func (h *AdminHandler) renderTaxRateForm(w http.ResponseWriter, r *http.Request, rate *tax.Rate, errors map[string]string) {
+	tmpl := h.Templates.Get("admin_edit_tax_rate.html")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.SessionStore.Get(r, "admin-session")
+	data := map[string]interface{}{
+		"Rate":      rate,
+		"Countries": address.Countries,
+		"Classes":   tax.RateClasses,
+		"Errors":    errors,
+		"CsrfField": csrf.TemplateField(r),
+		"Flashes":   GetFlash(session),
+	}
+	session.Save(r, w)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	tmpl.Execute(w, data)
+}
+
+// rateFromForm reads and validates the tax rate form.
+func rateFromForm(r *http.Request) (*tax.Rate, map[string]string) {
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	rate := &tax.Rate{
+		ID:      id,
+		Name:    strings.TrimSpace(r.FormValue("name")),
+		Country: strings.ToUpper(r.FormValue("country")),
+		Region:  strings.ToUpper(strings.TrimSpace(r.FormValue("region"))),
+		Class:   r.FormValue("class"),
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSpace(r.FormValue("percent")), 64)
+	rate.Percent = percent
+	errors := rate.Validate()
+	if err != nil {
+		errors["percent"] = "Please enter a number."
+	}
+	return rate, errors
+}
+
+func (h *AdminHandler) CreateTaxRate(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	rate, errors := rateFromForm(r)
+	rate.ID = 0
+	if len(errors) > 0 {
+		h.renderTaxRateForm(w, r, rate, errors)
+		return
+	}
+
+	if err := h.Store.CreateTaxRate(rate); err != nil {
+		slog.Error("Failed to create tax rate", "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving tax rate."})
+		saveAndRedirect(w, r, session, "/admin/tax")
+		return
+	}
+
+	slog.Info("Tax rate created", "user_id", CurrentUser(r).ID, "name", rate.Name, "country", rate.Country, "region", rate.Region)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Tax rate added."})
+	saveAndRedirect(w, r, session, "/admin/tax")
+}
+
+func (h *AdminHandler) UpdateTaxRate(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	rate, errors := rateFromForm(r)
+	if len(errors) > 0 {
+		h.renderTaxRateForm(w, r, rate, errors)
+		return
+	}
+
+	if err := h.Store.UpdateTaxRate(rate); err != nil {
+		slog.Error("Failed to update tax rate", "rate_id", rate.ID, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error saving tax rate."})
+		saveAndRedirect(w, r, session, "/admin/tax")
+		return
+	}
+
+	slog.Info("Tax rate updated", "user_id", CurrentUser(r).ID, "rate_id", rate.ID)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Tax rate updated. Orders already placed keep the tax they were charged."})
+	saveAndRedirect(w, r, session, "/admin/tax")
+}
+
+func (h *AdminHandler) DeleteTaxRate(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.SessionStore.Get(r, "admin-session")
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		session.AddFlash(FlashMessage{Type: "error", Message: "Invalid ID."})
+		saveAndRedirect(w, r, session, "/admin/tax")
+		return
+	}
+	if err := h.Store.DeleteTaxRate(id); err != nil {
+		slog.Error("Failed to delete tax rate", "rate_id", id, "error", err)
+		session.AddFlash(FlashMessage{Type: "error", Message: "Error deleting tax rate."})
+		saveAndRedirect(w, r, session, "/admin/tax")
+		return
+	}
+
+	slog.Info("Tax rate deleted", "user_id", CurrentUser(r).ID, "rate_id", id)
+	session.AddFlash(FlashMessage{Type: "success", Message: "Tax rate deleted."})
+	saveAndRedirect(w, r, session, "/admin/tax")
+}
@@ -3,8 +3,11 @@ package handlers
 import (
 	"html/template"
 	"log/slog"
+	"maps"
 	"path/filepath"
 	"sync"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
 )
 
 // TemplateCache holds parsed templates
@@ -12,15 +15,29 @@ type TemplateCache struct {
 	cache map[string]*template.Template
 	mu    sync.RWMutex
 	funcs template.FuncMap
+
+	// Each template is parsed again per language, with T translating into it
+	messages  *i18n.Bundle
+	localized map[string]map[string]*template.Template // By language, then name
 }
 
 func NewTemplateCache() *TemplateCache {
 	return &TemplateCache{
 		cache: make(map[string]*template.Template),
 		funcs: make(template.FuncMap),
+		localized: make(map[string]map[string]*template.Template),
 	}
 }
 
+// Translate has Load parse the templates once for each language in
+// messages, with the T function translating into that language. Without
+// it, T leaves messages in English. Call it before Load.
+func (tc *TemplateCache) Translate(messages *i18n.Bundle) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.messages = messages
+}
+
 func (tc *TemplateCache) AddFunc(name string, fn interface{}) {
 			tc.mu.Lock()
 		defer tc.mu.Unlock()
@@ -39,6 +56,7 @@ func (tc *TemplateCache) AddFunc(name string, fn interface{}) {
 		tc.funcs["nextPage"] = func(currentPage int) int {
 			return currentPage + 1
 		}
+		tc.funcs["T"] = i18n.Printer{Lang: i18n.Source}.T
 	
 		// Find all HTML files
 		files, err := filepath.Glob(filepath.Join(dir, "*.html"))
@@ -55,6 +73,26 @@ func (tc *TemplateCache) AddFunc(name string, fn interface{}) {
 		tc.cache[name] = tmpl
 		slog.Debug("Cached template", "name", name)
 	}
+
+	if tc.messages == nil {
+		return nil
+	}
+	for _, lang := range tc.messages.Languages() {
+		if lang == i18n.Source {
+			continue
+		}
+		funcs := maps.Clone(tc.funcs)
+		funcs["T"] = tc.messages.Printer(lang).T
+		tc.localized[lang] = make(map[string]*template.Template)
+		for _, file := range files {
+			name := filepath.Base(file)
+			tmpl, err := template.New(name).Funcs(funcs).ParseFiles(file)
+			if err != nil {
+				return err
+			}
+			tc.localized[lang][name] = tmpl
+		}
+	}
 	return nil
 }
 
@@ -63,3 +101,14 @@ func (tc *TemplateCache) Get(name string) *template.Template {
 	defer tc.mu.RUnlock()
 	return tc.cache[name]
 }
+
+// GetLang returns the template with its messages translated into lang, or
+// the English one if lang isn't offered.
+func (tc *TemplateCache) GetLang(name, lang string) *template.Template {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	if tmpl, ok := tc.localized[lang][name]; ok {
+		return tmpl
+	}
+	return tc.cache[name]
+}
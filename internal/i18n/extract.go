@@ -0,0 +1,100 @@
+package i18n
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"text/template/parse"
+)
+
+// templateMessages finds the messages passed to T in a template, as in
+// {{T "Place Order"}}.
+func templateMessages(text string) []string {
+	t := parse.New("extract")
+	t.Mode = parse.SkipFuncCheck
+	if _, err := t.Parse(text, "{{", "}}", map[string]*parse.Tree{}); err != nil || t.Root == nil {
+		return nil
+	}
+	var messages []string
+	var walk func(parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) > 1 {
+				ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+				str, isString := n.Args[1].(*parse.StringNode)
+				if isIdent && isString && ident.Ident == "T" {
+					messages = append(messages, str.Text)
+				}
+			}
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		}
+	}
+	walk(t.Root)
+	return messages
+}
+
+// sourceMessages finds the messages passed to T or Mark in a Go file, as in
+// tr.T("Order updated successfully!") or i18n.Mark("Part Paid").
+func sourceMessages(path string) ([]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	var messages []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		var name string
+		switch fun := call.Fun.(type) {
+		case *ast.SelectorExpr:
+			name = fun.Sel.Name
+		case *ast.Ident:
+			name = fun.Name
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if (name != "T" && name != "Mark") || !ok || lit.Kind != token.STRING {
+			return true
+		}
+		if s, err := strconv.Unquote(lit.Value); err == nil {
+			messages = append(messages, s)
+		}
+		return true
+	})
+	return messages, nil
+}
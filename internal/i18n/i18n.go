@@ -0,0 +1,209 @@
+// Package i18n translates the pages customers see. Messages are keyed by
+// their English text, which is shown wherever a language has no
+// translation for one. Each other language has a catalog, a JSON file named
+// after it (e.g. "fr.json") that maps the English text to the translation.
+package i18n
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// Source is the language messages are written in.
+const Source = "en"
+
+// Catalog maps messages to their translations. An empty translation means
+// the message is known but not translated yet.
+type Catalog map[string]string
+
+// Bundle holds the catalogs of every language the shop is offered in.
+type Bundle struct {
+	Default  string // For visitors whose browser asks for none of the languages
+	langs    []string
+	catalogs map[string]Catalog
+	matcher  language.Matcher
+}
+
+// Load reads the catalogs in dir. A missing dir means the shop is only
+// offered in the source language. defaultLang must be Source or have a
+// catalog.
+func Load(dir, defaultLang string) (*Bundle, error) {
+	b := &Bundle{Default: defaultLang, langs: []string{Source}, catalogs: map[string]Catalog{Source: {}}}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		lang := strings.TrimSuffix(filepath.Base(path), ".json")
+		if _, err := language.Parse(lang); err != nil {
+			return nil, fmt.Errorf("i18n: %s isn't named after a language: %w", path, err)
+		}
+		if lang == Source {
+			continue
+		}
+		c, err := ReadCatalog(path)
+		if err != nil {
+			return nil, err
+		}
+		b.langs = append(b.langs, lang)
+		b.catalogs[lang] = c
+	}
+	if !b.Supported(defaultLang) {
+		return nil, fmt.Errorf("i18n: no catalog for the default language %q", defaultLang)
+	}
+
+	tags := make([]language.Tag, len(b.langs))
+	for i, lang := range b.langs {
+		tags[i] = language.Make(lang)
+	}
+	b.matcher = language.NewMatcher(tags)
+	return b, nil
+}
+
+// Languages lists the languages offered, the source language first.
+func (b *Bundle) Languages() []string {
+	return b.langs
+}
+
+// Supported reports whether the shop is offered in lang.
+func (b *Bundle) Supported(lang string) bool {
+	_, ok := b.catalogs[lang]
+	return ok
+}
+
+// Negotiate picks the language offered that best suits an Accept-Language
+// header, or the default if none does.
+func (b *Bundle) Negotiate(acceptLanguage string) string {
+	wanted, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(wanted) == 0 {
+		return b.Default
+	}
+	_, i, confidence := b.matcher.Match(wanted...)
+	if confidence == language.No {
+		return b.Default
+	}
+	return b.langs[i]
+}
+
+// Printer returns a Printer for lang, which must be offered.
+func (b *Bundle) Printer(lang string) Printer {
+	return Printer{Lang: lang, catalog: b.catalogs[lang]}
+}
+
+// Name is what a language calls itself, e.g. "Français" for "fr".
+func Name(lang string) string {
+	name := display.Self.Name(language.Make(lang))
+	if name == "" {
+		return lang
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// Printer translates messages into one language.
+type Printer struct {
+	Lang    string
+	catalog Catalog
+}
+
+// Mark returns message as it is. Wrapping a message kept in Go, such as a
+// label in a table, in Mark lets extract-messages find it, so templates can
+// translate it with T where it's shown.
+func Mark(message string) string {
+	return message
+}
+
+// T translates message. With args, message is a fmt format, e.g.
+// T("Only %d left in stock.", n).
+func (p Printer) T(message string, args ...any) string {
+	if t := p.catalog[message]; t != "" {
+		message = t
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// ReadCatalog reads a catalog file.
+func ReadCatalog(path string) (Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := Catalog{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("i18n: %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// WriteCatalog writes c to path, sorted by message so changes diff well.
+func WriteCatalog(path string, c Catalog) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// ErrNoMessages is returned by Extract when it finds nothing to translate,
+// which usually means it was pointed at the wrong directories.
+var ErrNoMessages = errors.New("i18n: no messages found")
+
+// Extract lists the messages used in the templates in templateDir and the
+// Go files under sourceDirs, sorted.
+func Extract(templateDir string, sourceDirs ...string) ([]string, error) {
+	found := make(map[string]bool)
+	templates, err := filepath.Glob(filepath.Join(templateDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range templates {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range templateMessages(string(data)) {
+			found[m] = true
+		}
+	}
+	for _, dir := range sourceDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+				return err
+			}
+			messages, err := sourceMessages(path)
+			for _, m := range messages {
+				found[m] = true
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(found) == 0 {
+		return nil, ErrNoMessages
+	}
+
+	messages := make([]string, 0, len(found))
+	for m := range found {
+		messages = append(messages, m)
+	}
+	sort.Strings(messages)
+	return messages, nil
+}
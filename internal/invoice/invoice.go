@@ -0,0 +1,210 @@
+// Package invoice renders order invoices as PDF documents.
+package invoice
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+)
+
+// Shop is the seller's details printed at the top of every invoice.
+type Shop struct {
+	Name    string
+	Address []string
+	Email   string
+	TaxID   string // VAT or sales tax registration number; "" if none
+}
+
+// Line is a charge on the invoice.
+type Line struct {
+	Description string
+	Quantity    int
+	UnitPrice   float64
+	Amount      float64
+}
+
+// TaxLine is a tax included in the total.
+type TaxLine struct {
+	Label  string
+	Amount float64
+}
+
+// Charges is who an invoice is made out to and what it charges, which
+// stay as they were when the invoice was issued.
+type Charges struct {
+	BillTo []string // Customer name, email and address
+	Lines  []Line
+	Taxes  []TaxLine
+	Total  float64
+}
+
+// Invoice is everything printed on an invoice.
+type Invoice struct {
+	Number    string
+	Issued    time.Time
+	OrderRef  string
+	OrderDate time.Time
+	Currency  string             // ISO 4217, shown in the totals
+	Money     currency.Formatter // Writes the amounts as the site does
+
+	Shop Shop
+	Charges
+
+	Paid          float64 // Less refunds
+	Refunded      float64
+	BalanceDue    float64
+	RefundDue     float64 // Owed back to the customer
+	PaymentStatus string  // For display, e.g. "Part Paid"
+	PaymentMethod string  // For display
+	Note          string  // Printed under the totals, e.g. a cancellation
+}
+
+// Subtotal adds up the lines.
+func (inv *Invoice) Subtotal() float64 {
+	total := 0.0
+	for _, l := range inv.Lines {
+		total += l.Amount
+	}
+	return currency.Round(total, inv.Currency)
+}
+
+// Filename is a file name for the PDF.
+func (inv *Invoice) Filename() string {
+	return "invoice-" + inv.Number + ".pdf"
+}
+
+// money formats an amount the way the site shows prices.
+func (inv *Invoice) money(amount float64) string {
+	return inv.Money.FormatIn(amount, inv.Currency)
+}
+
+// Column positions for the line items table.
+const (
+	colQty    = 380 // Right edges
+	colPrice  = 470
+	colAmount = pageWidth - margin
+)
+
+// WritePDF renders the invoice as a PDF.
+func (inv *Invoice) WritePDF(w io.Writer) error {
+	var p page
+	right := float64(pageWidth - margin)
+	y := float64(pageHeight - margin - 14)
+
+	// Shop on the left, invoice details on the right
+	p.text(margin, y, bold, 18, inv.Shop.Name)
+	p.textRight(right, y, bold, 18, "INVOICE")
+	y -= 20
+	top := y
+	shopLines := append([]string{}, inv.Shop.Address...)
+	if inv.Shop.Email != "" {
+		shopLines = append(shopLines, inv.Shop.Email)
+	}
+	if inv.Shop.TaxID != "" {
+		shopLines = append(shopLines, "Tax ID: "+inv.Shop.TaxID)
+	}
+	for _, line := range shopLines {
+		p.text(margin, y, regular, 10, line)
+		y -= 13
+	}
+	details := [][2]string{
+		{"Invoice number", inv.Number},
+		{"Invoice date", inv.Issued.Format("January 2, 2006")},
+		{"Order", inv.OrderRef},
+		{"Order date", inv.OrderDate.Format("January 2, 2006")},
+	}
+	dy := top
+	for _, d := range details {
+		p.textRight(right-110, dy, regular, 10, d[0])
+		p.textRight(right, dy, bold, 10, d[1])
+		dy -= 13
+	}
+	y = math.Min(y, dy) - 20
+
+	// Customer
+	p.text(margin, y, bold, 10, "Bill to")
+	y -= 14
+	for _, line := range inv.BillTo {
+		p.text(margin, y, regular, 10, line)
+		y -= 13
+	}
+	y -= 20
+
+	// Line items
+	p.text(margin, y, bold, 10, "Description")
+	p.textRight(colQty, y, bold, 10, "Qty")
+	p.textRight(colPrice, y, bold, 10, "Unit price")
+	p.textRight(colAmount, y, bold, 10, "Amount")
+	y -= 6
+	p.rule(margin, right, y)
+	y -= 15
+	for _, l := range inv.Lines {
+		desc := wrap(l.Description, regular, 10, colQty-margin-50)
+		p.text(margin, y, regular, 10, desc[0])
+		if l.Quantity > 0 {
+			p.textRight(colQty, y, regular, 10, fmt.Sprint(l.Quantity))
+			p.textRight(colPrice, y, regular, 10, inv.money(l.UnitPrice))
+		}
+		p.textRight(colAmount, y, regular, 10, inv.money(l.Amount))
+		for _, more := range desc[1:] {
+			y -= 13
+			p.text(margin, y, regular, 10, more)
+		}
+		y -= 17
+	}
+	y += 9
+	p.rule(margin, right, y)
+	y -= 16
+
+	// Totals
+	total := func(label, amount string, font string) {
+		p.textRight(colPrice, y, font, 10, label)
+		p.textRight(colAmount, y, font, 10, amount)
+		y -= 15
+	}
+	total("Subtotal", inv.money(inv.Subtotal()), regular)
+	for _, t := range inv.Taxes {
+		total(t.Label, inv.money(t.Amount), regular)
+	}
+	total("Total ("+strings.ToUpper(inv.Currency)+")", inv.money(inv.Total), bold)
+	total("Paid", inv.money(inv.Paid), regular)
+	if inv.Refunded > 0 {
+		total("Refunded", inv.money(inv.Refunded), regular)
+	}
+	if inv.RefundDue > 0 {
+		total("To be refunded", inv.money(inv.RefundDue), bold)
+	} else {
+		total("Balance due", inv.money(inv.BalanceDue), bold)
+	}
+	y -= 10
+
+	// Payment
+	status := inv.PaymentStatus
+	if status == "" {
+		status = "Unpaid"
+	}
+	p.text(margin, y, bold, 10, "Payment status: ")
+	p.text(margin+textWidth("Payment status: ", bold, 10), y, regular, 10, status)
+	y -= 13
+	if inv.PaymentMethod != "" {
+		p.text(margin, y, bold, 10, "Payment method: ")
+		p.text(margin+textWidth("Payment method: ", bold, 10), y, regular, 10, inv.PaymentMethod)
+		y -= 13
+	}
+	if inv.Note != "" {
+		y -= 7
+		for _, line := range wrap(inv.Note, regular, 10, right-margin) {
+			p.text(margin, y, regular, 10, line)
+			y -= 13
+		}
+	}
+
+	p.color(0.4, 0.4, 0.4)
+	p.text(margin, margin, regular, 9, "Thank you for your order!")
+
+	return p.write(w, "Invoice "+inv.Number, inv.Issued)
+}
@@ -0,0 +1,171 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// A minimal PDF writer: one page of text and rules in the standard
+// Helvetica fonts, which every PDF reader has, so nothing is embedded.
+
+// Page size (US Letter) and margins, in points.
+const (
+	pageWidth  = 612
+	pageHeight = 792
+	margin     = 50
+)
+
+// Fonts, as named in the page resources.
+const (
+	regular = "F1" // Helvetica
+	bold    = "F2" // Helvetica-Bold
+)
+
+// page collects the content stream of a page.
+type page struct {
+	buf bytes.Buffer
+}
+
+// text draws s with its left edge at x and its baseline at y.
+func (p *page) text(x, y float64, font string, size float64, s string) {
+	fmt.Fprintf(&p.buf, "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(encode(s)))
+}
+
+// textRight draws s with its right edge at x.
+func (p *page) textRight(x, y float64, font string, size float64, s string) {
+	p.text(x-textWidth(s, font, size), y, font, size, s)
+}
+
+// rule draws a horizontal line from x1 to x2.
+func (p *page) rule(x1, x2, y float64) {
+	fmt.Fprintf(&p.buf, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y, x2, y)
+}
+
+// color sets the fill (text) and stroke color, each component 0 to 1.
+func (p *page) color(r, g, b float64) {
+	fmt.Fprintf(&p.buf, "%g %g %g rg %g %g %g RG\n", r, g, b, r, g, b)
+}
+
+// write outputs a PDF document holding the page.
+func (p *page) write(w io.Writer, title string, created time.Time) error {
+	content := p.buf.Bytes()
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /%s 4 0 R /%s 5 0 R >> >> /Contents 6 0 R >>", pageWidth, pageHeight, regular, bold),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		fmt.Sprintf("<< /Title (%s) /CreationDate (D:%s) >>", escape(encode(title)), created.UTC().Format("20060102150405Z")),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// encode converts s to the fonts' WinAnsi (Windows-1252) encoding, replacing
+// characters it lacks with "?".
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r < ' ' {
+			r = ' '
+		}
+		c, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok {
+			c = '?'
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// escape makes encoded text safe inside a PDF string literal.
+func escape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c == '(' || c == ')' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// textWidth is the width of s in points.
+func textWidth(s, font string, size float64) float64 {
+	widths := &helveticaWidths
+	if font == bold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, c := range encode(s) {
+		if c == 0xa0 { // No-break space, as in "20,00 €"
+			c = ' '
+		}
+		if c >= ' ' && int(c-' ') < len(widths) {
+			total += widths[c-' ']
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// wrap splits s into lines no wider than width.
+func wrap(s, font string, size, width float64) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			if line != "" && textWidth(line+" "+word, font, size) > width {
+				lines = append(lines, line)
+				line = word
+			} else if line != "" {
+				line += " " + word
+			} else {
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Glyph widths of the printable ASCII characters, from the fonts' metrics,
+// in thousandths of the font size.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}
+
+var helveticaBoldWidths = [...]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+)
+
+// Who cancelled an order.
+const (
+	CancelledByCustomer = "customer"
+	CancelledByAdmin    = "admin"
+)
+
+// CancellableStatuses lists the statuses an order can be cancelled from by
+// who: customers only until work on it starts, admins at any point.
+func CancellableStatuses(by string) []string {
+	if by == CancelledByCustomer {
+		return []string{"Ordered"}
+	}
+	var statuses []string
+	for _, status := range OrderStatuses {
+		if status != "Cancelled" {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// CancelReason is a reason an order can be cancelled for.
+type CancelReason struct {
+	Code     string
+	Label    string
+	Customer bool // Offered to customers cancelling their own orders
+}
+
+// CancelReasons lists the cancellation reasons in display order. Every
+// list ends with "other", which needs a note.
+var CancelReasons = []CancelReason{
+	{Code: "changed_mind", Label: i18n.Mark("Changed my mind"), Customer: true},
+	{Code: "ordered_by_mistake", Label: i18n.Mark("Ordered by mistake"), Customer: true},
+	{Code: "too_slow", Label: i18n.Mark("Takes too long to arrive"), Customer: true},
+	{Code: "found_elsewhere", Label: i18n.Mark("Found it elsewhere"), Customer: true},
+	{Code: "customer_request", Label: i18n.Mark("Customer asked to cancel")},
+	{Code: "cannot_make", Label: i18n.Mark("Can't make the item")},
+	{Code: "not_paid", Label: i18n.Mark("Payment not received")},
+	{Code: "other", Label: i18n.Mark("Other"), Customer: true},
+}
+
+// CustomerCancelReasons are the reasons customers choose from.
+func CustomerCancelReasons() []CancelReason {
+	var reasons []CancelReason
+	for _, r := range CancelReasons {
+		if r.Customer {
+			reasons = append(reasons, r)
+		}
+	}
+	return reasons
+}
+
+// LookupCancelReason finds a cancellation reason by code.
+func LookupCancelReason(code string) (CancelReason, bool) {
+	for _, r := range CancelReasons {
+		if r.Code == code {
+			return r, true
+		}
+	}
+	return CancelReason{}, false
+}
+
+// CancelReasonLabel names a cancellation reason for display.
+func CancelReasonLabel(code string) string {
+	if r, ok := LookupCancelReason(code); ok {
+		return r.Label
+	}
+	return code
+}
+
+// Cancellation records why an order was cancelled.
+type Cancellation struct {
+	OrderID     int       `json:"order_id"`
+	Reason      string    `json:"reason"` // Code from CancelReasons
+	Note        string    `json:"note"`
+	CancelledBy string    `json:"cancelled_by"` // CancelledByCustomer or CancelledByAdmin
+	UserID      int       `json:"user_id"`      // The admin who cancelled; 0 for customers
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ReasonLabel is the reason for display.
+func (c Cancellation) ReasonLabel() string {
+	return CancelReasonLabel(c.Reason)
+}
@@ -1,7 +1,16 @@
 package models
 
 import (
+	"math"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+	"github.com/alextreichler/crochetbyjuliette/internal/payments"
+	"github.com/alextreichler/crochetbyjuliette/internal/shipping"
+	"github.com/alextreichler/crochetbyjuliette/internal/tax"
 )
 
 type Item struct {
@@ -13,6 +22,73 @@ type Item struct {
 	ImageURL     string    `json:"image_url"`
 	Status       string    `json:"status"` // "available", "out_of_stock", "archived"
 	CreatedAt    time.Time `json:"created_at"`
+
+	// Packed size of one item, for shipping rates
+	WeightGrams int     `json:"weight_grams"`
+	LengthCm    float64 `json:"length_cm"`
+	WidthCm     float64 `json:"width_cm"`
+	HeightCm    float64 `json:"height_cm"`
+
+	// Deposit asked for before work starts: DepositValue percent of the
+	// price, or DepositValue per item, depending on DepositType.
+	DepositType  string  `json:"deposit_type"` // "", DepositPercent or DepositFixed
+	DepositValue float64 `json:"deposit_value"`
+
+	// Items made to order don't track stock; others sell out at zero.
+	TrackStock bool `json:"track_stock"`
+	Stock      int  `json:"stock"`
+
+	TaxClass string `json:"tax_class"` // tax.ClassStandard etc.
+}
+
+// ItemTranslation is an item's title and description in another language.
+// Either may be blank, in which case the item's own is shown.
+type ItemTranslation struct {
+	Lang        string `json:"lang"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// Item deposit types.
+const (
+	DepositPercent = "percent"
+	DepositFixed   = "fixed"
+)
+
+// Deposit is the deposit owed when ordering quantity of the item at the
+// given unit price, never more than the price itself.
+func (i Item) Deposit(unitPrice float64, quantity int) float64 {
+	subtotal := unitPrice * float64(quantity)
+	var deposit float64
+	switch i.DepositType {
+	case DepositPercent:
+		deposit = subtotal * i.DepositValue / 100
+	case DepositFixed:
+		deposit = i.DepositValue * float64(quantity)
+	}
+	return math.Round(math.Min(deposit, subtotal)*100) / 100
+}
+
+// Parcel is the item as packed for shipping.
+func (i Item) Parcel() shipping.Parcel {
+	return shipping.Parcel{WeightGrams: i.WeightGrams, LengthCm: i.LengthCm, WidthCm: i.WidthCm, HeightCm: i.HeightCm}
+}
+
+// OrderStatuses lists the statuses an order can have, in the order it
+// normally goes through them.
+var OrderStatuses = []string{
+	i18n.Mark("Ordered"),
+	i18n.Mark("In Progress"),
+	i18n.Mark("Completed"),
+	i18n.Mark("Needs Shipping"),
+	i18n.Mark("Shipped"),
+	i18n.Mark("Delivered"),
+	i18n.Mark("Cancelled"),
+}
+
+// ValidOrderStatus reports whether status is one of OrderStatuses.
+func ValidOrderStatus(status string) bool {
+	return slices.Contains(OrderStatuses, status)
 }
 
 type Order struct {
@@ -24,19 +100,299 @@ type Order struct {
 	Quantity        int       `json:"quantity"`
 	CustomerName    string    `json:"customer_name"`
 	CustomerEmail   string    `json:"customer_email"`
-	CustomerAddress string    `json:"customer_address"`
+	ShippingAddress address.Address `json:"shipping_address"`
+	LegacyAddress   string    `json:"legacy_address,omitempty"` // Free-text address from before addresses were structured
 	DeliveryMethod  string    `json:"delivery_method"` // "shipping" or "hand_delivered"
-	PaymentMethod   string    `json:"payment_method"`  // "in_person"
+	ShippingMethodID int      `json:"shipping_method_id"` // 0 on orders placed before shipping methods
+	ShippingMethod  string    `json:"shipping_method"` // Method name at checkout
+	ShippingFee     float64   `json:"shipping_fee"`
+	UnitPrice       float64   `json:"unit_price"` // Item price when ordered
+	Deposit         float64   `json:"deposit"`    // Due before work starts; 0 if none
+	StockReserved   int       `json:"stock_reserved"` // Taken from the item's stock; returned on cancellation
+	Tax             float64   `json:"tax"`           // Worked out when ordered
+	TaxInclusive    bool      `json:"tax_inclusive"` // Prices included Tax; otherwise it's added to the total
+	DiscountCodeID  int       `json:"discount_code_id"` // 0 if no code was used, or it was deleted
+	DiscountCode    string    `json:"discount_code"`    // As entered
+	Discount        float64   `json:"discount"`         // Taken off the items
+	PaymentMethod   string    `json:"payment_method"`  // payments.MethodInPerson etc.
 	Status          string    `json:"status"`
 	Notes           string    `json:"notes"`
 	AdminComments   string    `json:"admin_comments"` // Comments from the admin visible to the user
-	MagicToken      string    `json:"magic_token"`
+	MagicToken      string    `json:"-"` // Plaintext link token, only set when a link has just been issued
+	MagicTokenHash  string    `json:"-"` // What the database stores; empty once revoked
 	MagicTokenExpiry time.Time `json:"magic_token_expiry"`
+	CustomerID      int       `json:"customer_id"` // 0 until linked to a customer account
 	CreatedAt       time.Time `json:"created_at"`
+	Shipments       []Shipment `json:"shipments,omitempty"` // Only loaded where shown
+	Payments        []Payment  `json:"payments,omitempty"`  // Only loaded where shown
+	Refunds         []Refund   `json:"refunds,omitempty"`   // Loaded with Payments
+	Cancellation    *Cancellation `json:"cancellation,omitempty"` // Only loaded where shown
+	Taxes           []tax.Line    `json:"taxes,omitempty"`        // Only loaded where shown
+}
+
+// AddressLines is the shipping address for display, falling back to the
+// free-text address on orders placed before addresses were structured.
+func (o Order) AddressLines() []string {
+	if o.ShippingAddress.IsZero() && o.LegacyAddress != "" {
+		return strings.Split(o.LegacyAddress, "\n")
+	}
+	return o.ShippingAddress.Lines()
+}
+
+// DeliveryLabel names how the order is delivered: the method chosen at
+// checkout, or the delivery type for orders placed before methods existed.
+func (o Order) DeliveryLabel() string {
+	if o.ShippingMethod != "" {
+		return o.ShippingMethod
+	}
+	if o.DeliveryMethod == "shipping" {
+		return i18n.Mark("Shipping")
+	}
+	return i18n.Mark("Hand Delivered")
+}
+
+// PaymentLabel names how the customer pays.
+func (o Order) PaymentLabel() string {
+	return payments.MethodLabel(o.PaymentMethod)
+}
+
+// Subtotal is the price of the items, without shipping.
+func (o Order) Subtotal() float64 {
+	return o.UnitPrice * float64(o.Quantity)
+}
+
+// DiscountedSubtotal is the price of the items after any discount.
+func (o Order) DiscountedSubtotal() float64 {
+	return o.Subtotal() - o.Discount
+}
+
+// Total is what the customer owes for the order.
+func (o Order) Total() float64 {
+	return o.DiscountedSubtotal() + o.ShippingFee + o.TaxAdded()
+}
+
+// TaxAdded is the tax added on top of the prices; zero when the prices
+// included it.
+func (o Order) TaxAdded() float64 {
+	if o.TaxInclusive {
+		return 0
+	}
+	return o.Tax
+}
+
+// AmountPaid is what the customer has paid, less what was refunded.
+// Payments must be loaded.
+func (o Order) AmountPaid() float64 {
+	paid := 0.0
+	for _, p := range o.Payments {
+		// Refunded payments were received; their refunds are taken off below
+		if p.Status == payments.StatusPaid || p.Status == payments.StatusRefunded {
+			paid += p.Amount
+		}
+	}
+	return math.Round((paid-o.AmountRefunded())*100) / 100
+}
+
+// AmountRefunded adds up the order's refunds. Payments must be loaded.
+func (o Order) AmountRefunded() float64 {
+	refunded := 0.0
+	for _, r := range o.Refunds {
+		refunded += r.Amount
+	}
+	return math.Round(refunded*100) / 100
+}
+
+// RefundDue is what should be given back to the customer: everything they
+// paid on a cancelled order, otherwise anything paid beyond the total.
+// Payments must be loaded.
+func (o Order) RefundDue() float64 {
+	if o.Status == "Cancelled" {
+		return math.Max(o.AmountPaid(), 0)
+	}
+	return math.Max(-o.Balance(), 0)
+}
+
+// Balance is what is still owed; negative if the customer overpaid.
+// Payments must be loaded.
+func (o Order) Balance() float64 {
+	return math.Round((o.Total()-o.AmountPaid())*100) / 100
+}
+
+// DepositDue is what is still owed of the deposit. Payments must be loaded.
+func (o Order) DepositDue() float64 {
+	return math.Max(math.Round((o.Deposit-o.AmountPaid())*100)/100, 0)
+}
+
+// PaymentStatus summarizes the order's payments: refunded once everything
+// paid has been given back, paid once the total is covered, partial if some
+// of it is, and otherwise the status of the latest
+// online payment, or "" if there is none. Payments must be loaded.
+func (o Order) PaymentStatus() string {
+	switch {
+	case o.AmountRefunded() > 0 && o.AmountPaid() <= 0:
+		return payments.StatusRefunded
+	case o.AmountPaid() > 0 && o.Balance() <= 0:
+		return payments.StatusPaid
+	case o.AmountPaid() > 0:
+		return payments.StatusPartial
+	}
+	status := ""
+	for _, p := range o.Payments {
+		status = p.Status
+	}
+	return status
+}
+
+// Payment is an online payment attempt for an order, or a payment an admin
+// recorded by hand.
+type Payment struct {
+	ID         int       `json:"id"`
+	OrderID    int       `json:"order_id"`
+	Provider   string    `json:"provider"` // payments.ProviderManual if recorded by hand
+	Method     string    `json:"method"`   // payments.MethodOnline etc.
+	CheckoutID string    `json:"checkout_id"`
+	Reference  string    `json:"reference"` // Provider's payment ID, or e.g. a bank transfer reference
+	Amount     float64   `json:"amount"`
+	Currency   string    `json:"currency"`
+	Status     string    `json:"status"` // payments.StatusPending etc.
+	PaidAt     time.Time `json:"paid_at"` // Zero unless paid
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// IsManual reports whether an admin recorded the payment by hand.
+func (p Payment) IsManual() bool {
+	return p.Provider == payments.ProviderManual
+}
+
+// MethodLabel is how the payment was made, for display.
+func (p Payment) MethodLabel() string {
+	return payments.MethodLabel(p.Method)
+}
+
+// StatusLabel is the payment status for display.
+func (p Payment) StatusLabel() string {
+	return payments.StatusLabel(p.Status)
+}
+
+// Refund is money given back to the customer for an order.
+type Refund struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"order_id"`
+	PaymentID int       `json:"payment_id"` // The refunded online payment; 0 if refunded by hand
+	Method    string    `json:"method"`     // payments.MethodOnline etc.
+	Amount    float64   `json:"amount"`
+	Reference string    `json:"reference"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsManual reports whether an admin recorded the refund by hand.
+func (r Refund) IsManual() bool {
+	return r.PaymentID == 0
+}
+
+// MethodLabel is how the money was given back, for display.
+func (r Refund) MethodLabel() string {
+	return payments.MethodLabel(r.Method)
+}
+
+// Invoice records the number given to an order's invoice. Invoices are
+// numbered in sequence when first issued and keep their number, and what
+// they charged, after.
+type Invoice struct {
+	ID       int       `json:"id"`
+	OrderID  int       `json:"order_id"`
+	Number   int       `json:"number"`
+	IssuedAt time.Time `json:"issued_at"`
+	Charges  string    `json:"charges"` // What it charged, as JSON
+}
+
+// Shipment is a parcel sent for an order.
+type Shipment struct {
+	ID             int       `json:"id"`
+	OrderID        int       `json:"order_id"`
+	Carrier        string    `json:"carrier"` // Code from shipping.Carriers
+	TrackingNumber string    `json:"tracking_number"`
+	ShippedAt      time.Time `json:"shipped_at"`
+	LabelFile      string    `json:"-"` // Label PDF in the labels directory; empty if none
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// CarrierName is the carrier's display name.
+func (s Shipment) CarrierName() string {
+	return shipping.CarrierName(s.Carrier)
+}
+
+// TrackingURL links to the carrier's tracking page, or is empty if the
+// carrier has none.
+func (s Shipment) TrackingURL() string {
+	c, ok := shipping.LookupCarrier(s.Carrier)
+	if !ok {
+		return ""
+	}
+	return c.TrackingURL(s.TrackingNumber)
 }
 
 type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
 	Password string `json:"-"` // Store hashed password
+	Email    string `json:"email"`
+	Role     string `json:"role"`   // "owner", "staff" or "read_only"
+	Active   bool   `json:"active"` // Deactivated users cannot log in
+
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	TOTPSecret   string `json:"-"`
+	TOTPLastStep int64  `json:"-"` // Last accepted TOTP time step
+}
+
+type LoginAttempt struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserSession is an active admin login, as listed on the sessions page.
+type UserSession struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"` // The session making the request
+}
+
+// Customer is a shopper who has signed in with an emailed link at least once.
+type Customer struct {
+	ID           int        `json:"id"`
+	Email        string     `json:"email"`
+	Name         string     `json:"name"`
+	Phone        string     `json:"phone"`
+	OrderUpdates bool       `json:"order_updates"` // Email status changes
+	Newsletter   bool       `json:"newsletter"`    // Email about new items
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+}
+
+type CustomerAddress struct {
+	ID         int    `json:"id"`
+	CustomerID int    `json:"customer_id"`
+	Label      string `json:"label"`
+	Address    address.Address `json:"address"`
+	Legacy     string `json:"legacy,omitempty"` // Free-text address from before addresses were structured
+	IsDefault  bool   `json:"is_default"`
+}
+
+// Lines is the address for display; see Order.AddressLines.
+func (a CustomerAddress) Lines() []string {
+	if a.Address.IsZero() && a.Legacy != "" {
+		return strings.Split(a.Legacy, "\n")
+	}
+	return a.Address.Lines()
 }
@@ -0,0 +1,64 @@
+package models
+
+// Admin roles, from most to least privileged.
+const (
+	RoleOwner    = "owner"
+	RoleStaff    = "staff"
+	RoleReadOnly = "read_only"
+)
+
+// Roles lists the assignable roles in display order.
+var Roles = []string{RoleOwner, RoleStaff, RoleReadOnly}
+
+// Permission names an admin action that is checked per route.
+type Permission string
+
+const (
+	PermViewAdmin      Permission = "admin.view"
+	PermUpdateOrders   Permission = "orders.update"
+	PermEditItems      Permission = "items.edit"
+	PermDeleteItems    Permission = "items.delete"
+	PermEditShipping   Permission = "shipping.edit"
+	PermEditTax        Permission = "tax.edit"
+	PermEditDiscounts  Permission = "discounts.edit"
+	PermEditCurrencies Permission = "currencies.edit"
+	PermManageUsers    Permission = "users.manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleOwner:    {PermViewAdmin, PermUpdateOrders, PermEditItems, PermDeleteItems, PermEditShipping, PermEditTax, PermEditDiscounts, PermEditCurrencies, PermManageUsers},
+	RoleStaff:    {PermViewAdmin, PermUpdateOrders, PermEditItems, PermEditShipping, PermEditDiscounts, PermEditCurrencies},
+	RoleReadOnly: {PermViewAdmin},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleLabel returns a human readable name for a role.
+func RoleLabel(role string) string {
+	switch role {
+	case RoleOwner:
+		return "Owner"
+	case RoleStaff:
+		return "Staff"
+	case RoleReadOnly:
+		return "Read-only"
+	}
+	return role
+}
+
+// Can reports whether the user is active and their role grants p.
+func (u *User) Can(p Permission) bool {
+	if u == nil || !u.Active {
+		return false
+	}
+	for _, granted := range rolePermissions[u.Role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
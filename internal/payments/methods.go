@@ -0,0 +1,59 @@
+package payments
+
+import "github.com/alextreichler/crochetbyjuliette/internal/i18n"
+
+// Payment methods: how a customer pays for an order, and how a recorded
+// payment was made.
+const (
+	MethodOnline       = "online" // Through the Provider's checkout
+	MethodInPerson     = "in_person"
+	MethodBankTransfer = "bank_transfer"
+	MethodPayPal       = "paypal"
+)
+
+// ProviderManual is the provider of payments recorded by hand by an admin.
+const ProviderManual = "manual"
+
+// Method is a payment method as offered to customers.
+type Method struct {
+	Code        string
+	Name        string
+	Description string
+}
+
+// Methods lists the payment methods in display order. MethodOnline is only
+// offered when a Provider is configured.
+var Methods = []Method{
+	{MethodOnline, i18n.Mark("Pay Online Now"), i18n.Mark("Pay securely by card after placing your order.")},
+	{MethodInPerson, i18n.Mark("Cash / Pay in Person"), i18n.Mark("Pay when you pick up your order or we meet.")},
+	{MethodBankTransfer, i18n.Mark("Bank Transfer"), i18n.Mark("We'll send our bank details once we confirm your order.")},
+	{MethodPayPal, i18n.Mark("PayPal"), i18n.Mark("We'll send a PayPal payment request once we confirm your order.")},
+}
+
+// ManualMethods are the methods an admin can record a payment as having
+// been made with.
+var ManualMethods = Methods[1:]
+
+// LookupMethod returns the payment method with the given code.
+func LookupMethod(code string) (Method, bool) {
+	for _, m := range Methods {
+		if m.Code == code {
+			return m, true
+		}
+	}
+	return Method{}, false
+}
+
+// MethodLabel returns a short display name for a payment method.
+func MethodLabel(code string) string {
+	switch code {
+	case MethodOnline:
+		return i18n.Mark("Online")
+	case MethodInPerson:
+		return i18n.Mark("Cash / In Person")
+	}
+	if m, ok := LookupMethod(code); ok {
+		return m.Name
+	}
+	return code
+}
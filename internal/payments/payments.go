@@ -0,0 +1,100 @@
+// Package payments takes card payments through a hosted checkout page. A
+// Provider creates the checkout and turns its signed webhooks into Events;
+// the app keeps a payment record per checkout and updates it from them.
+package payments
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+	"github.com/alextreichler/crochetbyjuliette/internal/i18n"
+)
+
+// Payment statuses.
+const (
+	StatusPending  = "pending"
+	StatusPaid     = "paid"
+	StatusRefunded = "refunded"
+	StatusFailed   = "failed"
+
+	// StatusPartial only describes orders: some, but not all, of the order
+	// total has been paid.
+	StatusPartial = "partial"
+)
+
+// StatusLabel names a payment status for display.
+func StatusLabel(status string) string {
+	switch status {
+	case StatusPending:
+		return i18n.Mark("Pending")
+	case StatusPaid:
+		return i18n.Mark("Paid")
+	case StatusRefunded:
+		return i18n.Mark("Refunded")
+	case StatusFailed:
+		return i18n.Mark("Failed")
+	case StatusPartial:
+		return i18n.Mark("Part Paid")
+	}
+	return status
+}
+
+var (
+	ErrInvalidSignature = errors.New("payments: webhook signature missing or invalid")
+	ErrInvalidEvent     = errors.New("payments: malformed webhook event")
+)
+
+// Provider is a payment service with a hosted checkout page, such as Stripe.
+type Provider interface {
+	// Name identifies the provider on payment records, e.g. "stripe".
+	Name() string
+	// CreateCheckout starts a checkout; the customer is sent to its URL.
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error)
+	// ParseWebhook verifies a webhook's signature and decodes it. It returns
+	// nil, nil for events that don't change a payment's status.
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// CheckoutRequest describes what the customer is paying for.
+type CheckoutRequest struct {
+	PaymentID   int // Our payment record; makes retries idempotent
+	OrderRef    string
+	Description string
+	Amount      int64  // In minor units, e.g. cents
+	Currency    string // ISO 4217, lower case
+	Email       string
+	SuccessURL  string // Where the customer returns after paying
+	CancelURL   string // Where the customer returns if they give up
+}
+
+// Checkout is a started checkout.
+type Checkout struct {
+	ID  string // Provider's checkout ID, used to match webhooks
+	URL string // Hosted payment page
+}
+
+// Event is a change to a payment reported by the provider. CheckoutID or
+// Reference (the provider's payment ID) identifies it; refunds only carry
+// the Reference.
+type Event struct {
+	ID         string
+	Status     string // StatusPaid, StatusFailed or StatusRefunded
+	CheckoutID string
+	Reference  string
+	Amount     int64 // Minor units; 0 if not reported
+}
+
+// MinorUnits converts an amount of the currency code such as 12.50 to
+// minor units: 1250 for dollars, but 13 for yen, which have none.
+func MinorUnits(amount float64, code string) int64 {
+	return int64(math.Round(amount * math.Pow10(currency.Scale(code))))
+}
+
+// FromMinorUnits converts an amount of the currency code in minor units
+// back, e.g. 1250 to 12.50 for dollars.
+func FromMinorUnits(amount int64, code string) float64 {
+	return float64(amount) / math.Pow10(currency.Scale(code))
+}
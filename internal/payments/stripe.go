@@ -0,0 +1,130 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stripe takes payments with Stripe Checkout. Webhooks must be sent for the
+// checkout.session.* and charge.refunded events.
+type Stripe struct {
+	secretKey     string
+	webhookSecret string
+
+	APIBase    string // Defaults to https://api.stripe.com
+	HTTPClient *http.Client
+}
+
+// NewStripe returns a Stripe provider using an API secret key and the
+// signing secret of the webhook endpoint.
+func NewStripe(secretKey, webhookSecret string) *Stripe {
+	return &Stripe{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		APIBase:       "https://api.stripe.com",
+		HTTPClient:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (s *Stripe) Name() string { return "stripe" }
+
+func (s *Stripe) CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error) {
+	form := url.Values{
+		"mode":                                          {"payment"},
+		"success_url":                                   {req.SuccessURL},
+		"cancel_url":                                    {req.CancelURL},
+		"client_reference_id":                           {req.OrderRef},
+		"metadata[order_ref]":                           {req.OrderRef},
+		"metadata[payment_id]":                          {strconv.Itoa(req.PaymentID)},
+		"line_items[0][quantity]":                       {"1"},
+		"line_items[0][price_data][currency]":           {req.Currency},
+		"line_items[0][price_data][unit_amount]":        {strconv.FormatInt(req.Amount, 10)},
+		"line_items[0][price_data][product_data][name]": {req.Description},
+	}
+	if req.Email != "" {
+		form.Set("customer_email", req.Email)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.APIBase+"/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.secretKey)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// Retrying the same payment returns the same session instead of a new one
+	httpReq.Header.Set("Idempotency-Key", "checkout-"+strconv.Itoa(req.PaymentID))
+
+	resp, err := s.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("stripe: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		ID    string `json:"id"`
+		URL   string `json:"url"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("stripe: decoding response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stripe: HTTP %d: %s", resp.StatusCode, body.Error.Message)
+	}
+	return &Checkout{ID: body.ID, URL: body.URL}, nil
+}
+
+func (s *Stripe) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := VerifySignature(s.webhookSecret, payload, header.Get("Stripe-Signature"), time.Now()); err != nil {
+		return nil, err
+	}
+
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID            string `json:"id"`
+				PaymentStatus string `json:"payment_status"` // Checkout sessions
+				PaymentIntent string `json:"payment_intent"`
+				AmountTotal   int64  `json:"amount_total"`
+				Refunded      bool   `json:"refunded"` // Charges; true once fully refunded
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil || event.ID == "" {
+		return nil, ErrInvalidEvent
+	}
+	obj := event.Data.Object
+	e := &Event{ID: event.ID, CheckoutID: obj.ID, Reference: obj.PaymentIntent, Amount: obj.AmountTotal}
+
+	switch event.Type {
+	case "checkout.session.completed":
+		// Delayed methods such as bank debits complete unpaid and report
+		// back with async_payment_succeeded or _failed.
+		if obj.PaymentStatus != "paid" {
+			return nil, nil
+		}
+		e.Status = StatusPaid
+	case "checkout.session.async_payment_succeeded":
+		e.Status = StatusPaid
+	case "checkout.session.async_payment_failed", "checkout.session.expired":
+		e.Status = StatusFailed
+	case "charge.refunded":
+		if !obj.Refunded {
+			return nil, nil
+		}
+		e = &Event{ID: event.ID, Status: StatusRefunded, Reference: obj.PaymentIntent}
+	default:
+		return nil, nil
+	}
+	return e, nil
+}
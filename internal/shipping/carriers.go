@@ -0,0 +1,64 @@
+package shipping
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Carrier is a delivery company whose parcels can be tracked online.
+type Carrier struct {
+	Code string
+	Name string
+
+	// trackingURL has a single %s for the tracking number; empty if the
+	// carrier has no public tracking page.
+	trackingURL string
+}
+
+// CarrierOther is for carriers not in Carriers; its shipments have no
+// tracking link.
+const CarrierOther = "other"
+
+// Carriers lists the supported carriers in display order.
+var Carriers = []Carrier{
+	{"usps", "USPS", "https://tools.usps.com/go/TrackConfirmAction?tLabels=%s"},
+	{"ups", "UPS", "https://www.ups.com/track?tracknum=%s"},
+	{"fedex", "FedEx", "https://www.fedex.com/fedextrack/?trknbr=%s"},
+	{"dhl", "DHL", "https://www.dhl.com/global-en/home/tracking/tracking-express.html?tracking-id=%s"},
+	{"canada_post", "Canada Post", "https://www.canadapost-postescanada.ca/track-reperage/en#/search?searchFor=%s"},
+	{"royal_mail", "Royal Mail", "https://www.royalmail.com/track-your-item#/tracking-results/%s"},
+	{"an_post", "An Post", "https://www.anpost.com/Post-Parcels/Track/History?item=%s"},
+	{"australia_post", "Australia Post", "https://auspost.com.au/mypost/track/details/%s"},
+	{"nz_post", "NZ Post", "https://www.nzpost.co.nz/tools/tracking/item/%s"},
+	{"deutsche_post", "Deutsche Post / DHL Paket", "https://www.dhl.de/de/privatkunden/pakete-empfangen/verfolgen.html?piececode=%s"},
+	{"la_poste", "La Poste / Colissimo", "https://www.laposte.fr/outils/suivre-vos-envois?code=%s"},
+	{"postnl", "PostNL", "https://jouw.postnl.nl/track-and-trace/%s"},
+	{CarrierOther, "Other", ""},
+}
+
+// LookupCarrier returns the carrier with the given code.
+func LookupCarrier(code string) (Carrier, bool) {
+	for _, c := range Carriers {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return Carrier{}, false
+}
+
+// CarrierName returns the display name for a carrier code.
+func CarrierName(code string) string {
+	if c, ok := LookupCarrier(code); ok {
+		return c.Name
+	}
+	return code
+}
+
+// TrackingURL links to the carrier's tracking page for a parcel, or returns
+// "" if the carrier has none.
+func (c Carrier) TrackingURL(trackingNumber string) string {
+	if c.trackingURL == "" || trackingNumber == "" {
+		return ""
+	}
+	return strings.Replace(c.trackingURL, "%s", url.QueryEscape(trackingNumber), 1)
+}
@@ -0,0 +1,246 @@
+// Package shipping works out which delivery methods are offered for an
+// order and what each one costs.
+package shipping
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+)
+
+// Method kinds.
+const (
+	KindFlat   = "flat"   // Fixed fee per order
+	KindWeight = "weight" // Base fee plus a rate per started kilogram
+	KindPickup = "pickup" // Collected or hand delivered; no address needed
+)
+
+// Kinds lists the method kinds in display order.
+var Kinds = []string{KindFlat, KindWeight, KindPickup}
+
+// KindLabel returns a human readable name for a method kind.
+func KindLabel(kind string) string {
+	switch kind {
+	case KindFlat:
+		return "Flat rate"
+	case KindWeight:
+		return "By weight"
+	case KindPickup:
+		return "Local pickup / hand delivery"
+	}
+	return kind
+}
+
+// VolumetricDivisor converts a parcel's volume in cubic centimetres to the
+// weight in kilograms couriers charge for it, as most carriers do.
+const VolumetricDivisor = 5000
+
+// Zone is a group of countries that share the same shipping methods. A zone
+// with no countries covers every country not listed in another zone.
+type Zone struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Countries []string `json:"countries"` // ISO 3166-1 alpha-2 codes
+}
+
+// Covers reports whether the zone lists country explicitly.
+func (z Zone) Covers(country string) bool {
+	for _, c := range z.Countries {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRestOfWorld reports whether the zone is the catch-all zone.
+func (z Zone) IsRestOfWorld() bool {
+	return len(z.Countries) == 0
+}
+
+// Validate returns a message per invalid field, keyed by "name" or
+// "countries"; an empty map means the zone is valid.
+func (z Zone) Validate() map[string]string {
+	errors := make(map[string]string)
+	if strings.TrimSpace(z.Name) == "" {
+		errors["name"] = "Zone name is required."
+	}
+	for _, c := range z.Countries {
+		if _, ok := address.Lookup(c); !ok {
+			errors["countries"] = "Unknown country code: " + c + "."
+			break
+		}
+	}
+	return errors
+}
+
+// Method is one way of getting an order to the customer.
+type Method struct {
+	ID     int    `json:"id"`
+	ZoneID int    `json:"zone_id"` // 0 for pickup methods, which are offered everywhere
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Active bool   `json:"active"`
+
+	BaseFee        float64 `json:"base_fee"`         // The whole fee for flat rate methods
+	PerKg          float64 `json:"per_kg"`           // Weight methods: added per started kilogram
+	MaxWeightGrams int     `json:"max_weight_grams"` // Not offered above this; 0 for no limit
+	FreeOver       float64 `json:"free_over"`        // Free when the subtotal reaches this; 0 to never waive
+}
+
+// IsPickup reports whether the method needs no shipping address.
+func (m Method) IsPickup() bool {
+	return m.Kind == KindPickup
+}
+
+// Validate returns a message per invalid field, keyed by "name", "kind",
+// "zone_id", "base_fee", "per_kg", "max_weight_grams" or "free_over".
+func (m Method) Validate() map[string]string {
+	errors := make(map[string]string)
+	if strings.TrimSpace(m.Name) == "" {
+		errors["name"] = "Method name is required."
+	}
+	switch m.Kind {
+	case KindFlat, KindWeight:
+		if m.ZoneID == 0 {
+			errors["zone_id"] = "Choose the zone this method ships to."
+		}
+	case KindPickup:
+	default:
+		errors["kind"] = "Invalid method type."
+	}
+	if m.BaseFee < 0 {
+		errors["base_fee"] = "Fee can't be negative."
+	}
+	if m.PerKg < 0 {
+		errors["per_kg"] = "Rate can't be negative."
+	}
+	if m.MaxWeightGrams < 0 {
+		errors["max_weight_grams"] = "Weight limit can't be negative."
+	}
+	if m.FreeOver < 0 {
+		errors["free_over"] = "Threshold can't be negative."
+	}
+	return errors
+}
+
+// Fee returns what the method costs for an order with the given subtotal
+// and billable weight, and false if the method can't carry it.
+func (m Method) Fee(subtotal float64, grams int) (float64, bool) {
+	if m.IsPickup() {
+		return 0, true
+	}
+	if m.MaxWeightGrams > 0 && grams > m.MaxWeightGrams {
+		return 0, false
+	}
+	if m.FreeOver > 0 && subtotal >= m.FreeOver {
+		return 0, true
+	}
+	fee := m.BaseFee
+	if m.Kind == KindWeight {
+		kg := (grams + 999) / 1000
+		fee += m.PerKg * float64(kg)
+	}
+	return math.Round(fee*100) / 100, true
+}
+
+// Parcel is the packed size of one item.
+type Parcel struct {
+	WeightGrams int
+	LengthCm    float64
+	WidthCm     float64
+	HeightCm    float64
+}
+
+// BillableGrams is what quantity parcels weigh for shipping purposes: their
+// actual weight or their volumetric weight, whichever is greater.
+func (p Parcel) BillableGrams(quantity int) int {
+	actual := p.WeightGrams * quantity
+	volumetric := int(math.Ceil(p.LengthCm*p.WidthCm*p.HeightCm/VolumetricDivisor*1000)) * quantity
+	return max(actual, volumetric)
+}
+
+// Option is a method offered for a particular order, with its fee.
+type Option struct {
+	Method Method  `json:"method"`
+	Fee    float64 `json:"fee"`
+}
+
+// Table is the shop's shipping configuration.
+type Table struct {
+	Zones   []Zone
+	Methods []Method
+}
+
+// ZoneFor returns the zone that ships to country: the zone listing it, or
+// else the catch-all zone.
+func (t Table) ZoneFor(country string) (Zone, bool) {
+	var rest *Zone
+	for i, z := range t.Zones {
+		if z.Covers(country) {
+			return z, true
+		}
+		if z.IsRestOfWorld() && rest == nil {
+			rest = &t.Zones[i]
+		}
+	}
+	if rest != nil {
+		return *rest, true
+	}
+	return Zone{}, false
+}
+
+// Quote lists the active methods available for an order, cheapest first
+// with pickup methods last. An empty country leaves out methods that ship.
+func (t Table) Quote(country string, subtotal float64, grams int) []Option {
+	zone, shipsThere := t.ZoneFor(country)
+	shipsThere = shipsThere && country != ""
+
+	var options []Option
+	for _, m := range t.Methods {
+		if !m.Active {
+			continue
+		}
+		if !m.IsPickup() && (!shipsThere || m.ZoneID != zone.ID) {
+			continue
+		}
+		if fee, ok := m.Fee(subtotal, grams); ok {
+			options = append(options, Option{Method: m, Fee: fee})
+		}
+	}
+	sort.SliceStable(options, func(i, j int) bool {
+		a, b := options[i], options[j]
+		if a.Method.IsPickup() != b.Method.IsPickup() {
+			return !a.Method.IsPickup()
+		}
+		return a.Fee < b.Fee
+	})
+	return options
+}
+
+// Method returns the method with the given ID.
+func (t Table) Method(id int) (Method, bool) {
+	for _, m := range t.Methods {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return Method{}, false
+}
+
+// ParseCountries splits a list of country codes separated by commas or
+// whitespace, upper-casing them and dropping duplicates.
+func ParseCountries(s string) []string {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, c := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\t' || r == '\r' }) {
+		c = strings.ToUpper(c)
+		if !seen[c] {
+			seen[c] = true
+			codes = append(codes, c)
+		}
+	}
+	return codes
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+)
+
+// CancelOrder cancels an order, records why, and returns whatever the order
+// took from stock. It reports false, changing nothing, if the order's
+// status no longer allows whoever is cancelling to (see
+// models.CancellableStatuses), as when it was moved on meanwhile.
+func (s *Store) CancelOrder(c *models.Cancellation) (bool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var itemID, reserved int
+	if err := tx.QueryRow(`SELECT item_id, stock_reserved FROM orders WHERE id = ?`, c.OrderID).Scan(&itemID, &reserved); err != nil {
+		return false, err
+	}
+	statuses := models.CancellableStatuses(c.CancelledBy)
+	args := []any{c.OrderID}
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	query := `UPDATE orders SET status = 'Cancelled', stock_reserved = 0 WHERE id = ? AND status IN (?` + strings.Repeat(", ?", len(statuses)-1) + `)`
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if reserved > 0 {
+		if _, err := tx.Exec(returnStockQuery, reserved, reserved, itemID); err != nil {
+			return false, err
+		}
+	}
+	query = `
+		INSERT INTO order_cancellations (order_id, reason, note, cancelled_by, user_id, created_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, 0), CURRENT_TIMESTAMP)
+	`
+	if _, err := tx.Exec(query, c.OrderID, c.Reason, c.Note, c.CancelledBy, c.UserID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// GetCancellation returns nil, nil for orders cancelled before reasons were
+// recorded, and for orders that aren't cancelled.
+func (s *Store) GetCancellation(orderID int) (*models.Cancellation, error) {
+	var c models.Cancellation
+	query := `SELECT order_id, reason, note, cancelled_by, COALESCE(user_id, 0), created_at FROM order_cancellations WHERE order_id = ?`
+	err := s.DB.QueryRow(query, orderID).Scan(&c.OrderID, &c.Reason, &c.Note, &c.CancelledBy, &c.UserID, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
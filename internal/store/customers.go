@@ -0,0 +1,203 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+	"github.com/alextreichler/crochetbyjuliette/internal/emailaddr"
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+)
+
+const customerColumns = `id, email, COALESCE(name, ''), COALESCE(phone, ''), order_updates, newsletter, created_at, last_login_at`
+
+func scanCustomer(row interface{ Scan(...any) error }) (*models.Customer, error) {
+	var c models.Customer
+	var lastLogin sql.NullTime
+	if err := row.Scan(&c.ID, &c.Email, &c.Name, &c.Phone, &c.OrderUpdates, &c.Newsletter, &c.CreatedAt, &lastLogin); err != nil {
+		return nil, err
+	}
+	if lastLogin.Valid {
+		c.LastLoginAt = &lastLogin.Time
+	}
+	return &c, nil
+}
+
+// GetCustomerByID returns nil, nil when there is no such customer.
+func (s *Store) GetCustomerByID(id int) (*models.Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customers WHERE id = ?`
+	c, err := scanCustomer(s.DB.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+// GetCustomerByEmail matches on the normalized, case-folded address and
+// returns nil, nil when there is no match.
+func (s *Store) GetCustomerByEmail(email string) (*models.Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customers WHERE email_key = ?`
+	c, err := scanCustomer(s.DB.QueryRow(query, emailaddr.Key(email)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+// CreateCustomer adds an account for email, taking the name from their most
+// recent order if there is one.
+func (s *Store) CreateCustomer(email string) (*models.Customer, error) {
+	query := `
+		INSERT INTO customers (email, email_key, name)
+		VALUES (?, ?, COALESCE((SELECT customer_name FROM orders WHERE customer_email_key = ? ORDER BY created_at DESC LIMIT 1), ''))
+	`
+	key := emailaddr.Key(email)
+	res, err := s.DB.Exec(query, email, key, key)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetCustomerByID(int(id))
+}
+
+func (s *Store) UpdateCustomer(c *models.Customer) error {
+	query := `UPDATE customers SET name = ?, phone = ?, order_updates = ?, newsletter = ? WHERE id = ?`
+	_, err := s.DB.Exec(query, c.Name, c.Phone, c.OrderUpdates, c.Newsletter, c.ID)
+	return err
+}
+
+func (s *Store) RecordCustomerLogin(id int) error {
+	_, err := s.DB.Exec(`UPDATE customers SET last_login_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	return err
+}
+
+// LinkOrdersByEmail attaches orders placed with the customer's email that are
+// not yet linked to any account, returning how many were linked.
+func (s *Store) LinkOrdersByEmail(customerID int, email string) (int64, error) {
+	query := `UPDATE orders SET customer_id = ? WHERE customer_id IS NULL AND customer_email_key = ?`
+	res, err := s.DB.Exec(query, customerID, emailaddr.Key(email))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetOrdersByCustomer lists a customer's orders, newest first.
+func (s *Store) GetOrdersByCustomer(customerID int) ([]models.Order, error) {
+	query := `
+		SELECT o.id, COALESCE(o.order_ref, CAST(o.id AS TEXT)) as order_ref, o.item_id, i.title, i.image_url, COALESCE(o.quantity, 1) as quantity, o.status, o.created_at
+		FROM orders o
+		JOIN items i ON o.item_id = i.id
+		WHERE o.customer_id = ?
+		ORDER BY o.created_at DESC
+	`
+	rows, err := s.DB.Query(query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var o models.Order
+		if err := rows.Scan(&o.ID, &o.OrderRef, &o.ItemID, &o.ItemTitle, &o.ItemImageURL, &o.Quantity, &o.Status, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		o.CustomerID = customerID
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// Saved addresses
+
+func (s *Store) ListCustomerAddresses(customerID int) ([]models.CustomerAddress, error) {
+	query := `
+		SELECT id, customer_id, COALESCE(label, ''), COALESCE(address_legacy, ''), COALESCE(name, ''), COALESCE(line1, ''), COALESCE(line2, ''), COALESCE(city, ''), COALESCE(region, ''), COALESCE(postal_code, ''), COALESCE(country, ''), is_default
+		FROM customer_addresses
+		WHERE customer_id = ?
+		ORDER BY is_default DESC, id
+	`
+	rows, err := s.DB.Query(query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addresses []models.CustomerAddress
+	for rows.Next() {
+		var a models.CustomerAddress
+		addr := &a.Address
+		if err := rows.Scan(&a.ID, &a.CustomerID, &a.Label, &a.Legacy, &addr.Name, &addr.Line1, &addr.Line2, &addr.City, &addr.Region, &addr.PostalCode, &addr.Country, &a.IsDefault); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, rows.Err()
+}
+
+// AddCustomerAddress saves an address. The first address becomes the default.
+func (s *Store) AddCustomerAddress(customerID int, label string, a address.Address) error {
+	query := `
+		INSERT INTO customer_addresses (customer_id, label, address_legacy, name, line1, line2, city, region, postal_code, country, is_default)
+		VALUES (?, ?, '', ?, ?, ?, ?, ?, ?, ?, NOT EXISTS (SELECT 1 FROM customer_addresses WHERE customer_id = ?))
+	`
+	_, err := s.DB.Exec(query, customerID, label, a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, customerID)
+	return err
+}
+
+// DeleteCustomerAddress only deletes addresses belonging to customerID.
+func (s *Store) DeleteCustomerAddress(customerID, id int) error {
+	_, err := s.DB.Exec(`DELETE FROM customer_addresses WHERE id = ? AND customer_id = ?`, id, customerID)
+	return err
+}
+
+// SetDefaultCustomerAddress does nothing if the address isn't the customer's.
+func (s *Store) SetDefaultCustomerAddress(customerID, id int) error {
+	query := `
+		UPDATE customer_addresses SET is_default = (id = ?)
+		WHERE customer_id = ? AND EXISTS (SELECT 1 FROM customer_addresses WHERE id = ? AND customer_id = ?)
+	`
+	_, err := s.DB.Exec(query, id, customerID, id, customerID)
+	return err
+}
+
+// BackfillEmailKeys fills in the lookup keys of orders and customers saved
+// before email addresses were normalized, returning how many rows changed.
+// The keys can't be computed in SQL, and it is safe to run on every start.
+func (s *Store) BackfillEmailKeys() (int, error) {
+	total := 0
+	for _, table := range []struct{ name, email, key string }{
+		{"orders", "customer_email", "customer_email_key"},
+		{"customers", "email", "email_key"},
+	} {
+		rows, err := s.DB.Query(`SELECT id, ` + table.email + ` FROM ` + table.name + ` WHERE ` + table.key + ` IS NULL`)
+		if err != nil {
+			return total, err
+		}
+		keys := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var email string
+			if err := rows.Scan(&id, &email); err != nil {
+				rows.Close()
+				return total, err
+			}
+			keys[id] = emailaddr.Key(email)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, err
+		}
+
+		for id, key := range keys {
+			if _, err := s.DB.Exec(`UPDATE `+table.name+` SET `+table.key+` = ? WHERE id = ?`, key, id); err != nil {
+				return total, err
+			}
+		}
+		total += len(keys)
+	}
+	return total, nil
+}
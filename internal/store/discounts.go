@@ -0,0 +1,141 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/discount"
+	"github.com/alextreichler/crochetbyjuliette/internal/emailaddr"
+)
+
+// redemptionCount counts the orders placed with discount codes d, leaving out
+// cancelled ones so their uses can be had again.
+const redemptionCount = `(SELECT COUNT(*) FROM orders o WHERE o.discount_code_id = d.id AND o.status != 'Cancelled')`
+
+const discountCodeColumns = `d.id, d.code, d.kind, d.value, d.min_order, d.expires_at, d.max_uses, d.max_uses_per_email, d.item_ids, d.active, d.created_at, ` + redemptionCount
+
+func scanDiscountCode(row interface{ Scan(...any) error }) (discount.Code, error) {
+	var c discount.Code
+	var expiresAt sql.NullTime
+	var itemIDs string
+	err := row.Scan(&c.ID, &c.Code, &c.Kind, &c.Value, &c.MinOrder, &expiresAt, &c.MaxUses, &c.MaxUsesPerEmail, &itemIDs, &c.Active, &c.CreatedAt, &c.Redemptions)
+	c.ExpiresAt = expiresAt.Time
+	c.ItemIDs = discount.ParseItemIDs(itemIDs)
+	return c, err
+}
+
+func (s *Store) ListDiscountCodes() ([]discount.Code, error) {
+	rows, err := s.DB.Query(`SELECT ` + discountCodeColumns + ` FROM discount_codes d ORDER BY d.created_at DESC, d.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []discount.Code
+	for rows.Next() {
+		c, err := scanDiscountCode(rows)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+// GetDiscountCode returns nil if there is no such code.
+func (s *Store) GetDiscountCode(id int) (*discount.Code, error) {
+	return s.getDiscountCode(`d.id = ?`, id)
+}
+
+// GetDiscountCodeByCode looks up a code as a customer typed it. It returns
+// nil if there is no such code.
+func (s *Store) GetDiscountCodeByCode(code string) (*discount.Code, error) {
+	return s.getDiscountCode(`d.code = ?`, discount.Normalize(code))
+}
+
+func (s *Store) getDiscountCode(where string, arg any) (*discount.Code, error) {
+	c, err := scanDiscountCode(s.DB.QueryRow(`SELECT `+discountCodeColumns+` FROM discount_codes d WHERE `+where, arg))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func discountExpiry(c discount.Code) sql.NullTime {
+	return sql.NullTime{Time: c.ExpiresAt, Valid: !c.ExpiresAt.IsZero()}
+}
+
+func (s *Store) CreateDiscountCode(c *discount.Code) error {
+	query := `
+		INSERT INTO discount_codes (code, kind, value, min_order, expires_at, max_uses, max_uses_per_email, item_ids, active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := s.DB.Exec(query, c.Code, c.Kind, c.Value, c.MinOrder, discountExpiry(*c), c.MaxUses, c.MaxUsesPerEmail, discount.FormatItemIDs(c.ItemIDs), c.Active)
+	return err
+}
+
+// UpdateDiscountCode changes a code. Orders already placed keep the discount
+// they were given.
+func (s *Store) UpdateDiscountCode(c *discount.Code) error {
+	query := `UPDATE discount_codes SET code = ?, kind = ?, value = ?, min_order = ?, expires_at = ?, max_uses = ?, max_uses_per_email = ?, item_ids = ?, active = ? WHERE id = ?`
+	_, err := s.DB.Exec(query, c.Code, c.Kind, c.Value, c.MinOrder, discountExpiry(*c), c.MaxUses, c.MaxUsesPerEmail, discount.FormatItemIDs(c.ItemIDs), c.Active, c.ID)
+	return err
+}
+
+// DeleteDiscountCode deletes a code. Orders placed with it keep the code as
+// it was typed and the discount they were given.
+func (s *Store) DeleteDiscountCode(id int) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE orders SET discount_code_id = NULL WHERE discount_code_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM discount_codes WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CountEmailRedemptions counts the orders from email that used the code,
+// leaving out cancelled ones.
+func (s *Store) CountEmailRedemptions(codeID int, email string) (int, error) {
+	return countEmailRedemptions(s.DB, codeID, email)
+}
+
+func countEmailRedemptions(q interface {
+	QueryRow(string, ...any) *sql.Row
+}, codeID int, email string) (int, error) {
+	var n int
+	err := q.QueryRow(`SELECT COUNT(*) FROM orders WHERE discount_code_id = ? AND customer_email_key = ? AND status != 'Cancelled'`, codeID, emailaddr.Key(email)).Scan(&n)
+	return n, err
+}
+
+// checkDiscountLimits makes sure the order's code hasn't been used up since
+// it was checked, returning discount.ErrUsedUp or discount.ErrUsedByEmail if
+// it has. It runs in the transaction that saves the order.
+func checkDiscountLimits(tx *sql.Tx, codeID int, email string) error {
+	var maxUses, maxPerEmail, uses int
+	err := tx.QueryRow(`SELECT d.max_uses, d.max_uses_per_email, `+redemptionCount+` FROM discount_codes d WHERE d.id = ?`, codeID).Scan(&maxUses, &maxPerEmail, &uses)
+	if err != nil {
+		return err
+	}
+	if maxUses > 0 && uses >= maxUses {
+		return discount.ErrUsedUp
+	}
+	if maxPerEmail > 0 {
+		n, err := countEmailRedemptions(tx, codeID, email)
+		if err != nil {
+			return err
+		}
+		if n >= maxPerEmail {
+			return discount.ErrUsedByEmail
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/currency"
+)
+
+const exchangeRateColumns = `currency, rate, updated_at`
+
+func scanExchangeRate(row interface{ Scan(...any) error }) (currency.Rate, error) {
+	var r currency.Rate
+	err := row.Scan(&r.Currency, &r.Rate, &r.UpdatedAt)
+	return r, err
+}
+
+func (s *Store) ListExchangeRates() ([]currency.Rate, error) {
+	rows, err := s.DB.Query(`SELECT ` + exchangeRateColumns + ` FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []currency.Rate
+	for rows.Next() {
+		r, err := scanExchangeRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// GetExchangeRate returns nil if there is no rate for the currency.
+func (s *Store) GetExchangeRate(code string) (*currency.Rate, error) {
+	r, err := scanExchangeRate(s.DB.QueryRow(`SELECT `+exchangeRateColumns+` FROM exchange_rates WHERE currency = ?`, code))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) CreateExchangeRate(r *currency.Rate) error {
+	_, err := s.DB.Exec(`INSERT INTO exchange_rates (currency, rate, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)`, r.Currency, r.Rate)
+	return err
+}
+
+func (s *Store) UpdateExchangeRate(r *currency.Rate) error {
+	_, err := s.DB.Exec(`UPDATE exchange_rates SET rate = ?, updated_at = CURRENT_TIMESTAMP WHERE currency = ?`, r.Rate, r.Currency)
+	return err
+}
+
+func (s *Store) DeleteExchangeRate(code string) error {
+	_, err := s.DB.Exec(`DELETE FROM exchange_rates WHERE currency = ?`, code)
+	return err
+}
@@ -0,0 +1,23 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/emailaddr"
+)
+
+// RecordFormSubmission notes that a public form was submitted for email.
+func (s *Store) RecordFormSubmission(form, email, ip string) error {
+	query := `INSERT INTO form_submissions (form, email, ip) VALUES (?, ?, ?)`
+	_, err := s.DB.Exec(query, form, emailaddr.Key(email), ip)
+	return err
+}
+
+// CountFormSubmissions counts submissions of form for email within window.
+func (s *Store) CountFormSubmissions(form, email string, window time.Duration) (int, error) {
+	query := `SELECT COUNT(*) FROM form_submissions WHERE form = ? AND email = ? AND created_at > datetime('now', ?)`
+	var count int
+	err := s.DB.QueryRow(query, form, emailaddr.Key(email), fmt.Sprintf("-%d seconds", int(window.Seconds()))).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+)
+
+// IssueInvoice returns the order's invoice, numbering a new one after the
+// last, which charges charges, if the order doesn't have one yet. An invoice
+// issued before charges were saved has them saved now. Cancelled orders
+// keep an invoice issued before they were cancelled but never get a new
+// one, so they don't use up numbers; for those it returns nil, nil.
+func (s *Store) IssueInvoice(orderID int, charges string) (*models.Invoice, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	inv := models.Invoice{OrderID: orderID}
+	query := `SELECT id, number, issued_at, charges FROM invoices WHERE order_id = ?`
+	err = tx.QueryRow(query, orderID).Scan(&inv.ID, &inv.Number, &inv.IssuedAt, &inv.Charges)
+	if err == nil {
+		if inv.Charges != "" {
+			return &inv, nil
+		}
+		inv.Charges = charges
+		if _, err := tx.Exec(`UPDATE invoices SET charges = ? WHERE id = ?`, charges, inv.ID); err != nil {
+			return nil, err
+		}
+		return &inv, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO invoices (order_id, number, issued_at, charges)
+		SELECT id, (SELECT COALESCE(MAX(number), 0) + 1 FROM invoices), CURRENT_TIMESTAMP, ?
+		FROM orders WHERE id = ? AND status != 'Cancelled'
+		RETURNING id, number, issued_at, charges
+	`
+	err = tx.QueryRow(query, charges, orderID).Scan(&inv.ID, &inv.Number, &inv.IssuedAt, &inv.Charges)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, tx.Commit()
+}
@@ -4,19 +4,36 @@ import (
 	"github.com/alextreichler/crochetbyjuliette/internal/models"
 )
 
+// itemColumns are the columns of items selected by every item query, in the
+// order itemDest scans them.
+const itemColumns = `id, title, description, ` + itemDetailColumns
+
+// localizedItemColumns are itemColumns with the title and description in
+// the language given as the query's first two arguments, where the item has
+// been translated into it.
+const localizedItemColumns = `id,
+	COALESCE(NULLIF((SELECT t.title FROM item_translations t WHERE t.item_id = items.id AND t.lang = ?), ''), title) AS title,
+	COALESCE(NULLIF((SELECT t.description FROM item_translations t WHERE t.item_id = items.id AND t.lang = ?), ''), description) AS description, ` + itemDetailColumns
+
+const itemDetailColumns = `price, delivery_time, image_url, COALESCE(status, 'available') as status, created_at, weight_grams, length_cm, width_cm, height_cm, deposit_type, deposit_value, track_stock, stock, tax_class`
+
+func itemDest(i *models.Item) []any {
+	return []any{&i.ID, &i.Title, &i.Description, &i.Price, &i.DeliveryTime, &i.ImageURL, &i.Status, &i.CreatedAt, &i.WeightGrams, &i.LengthCm, &i.WidthCm, &i.HeightCm, &i.DepositType, &i.DepositValue, &i.TrackStock, &i.Stock, &i.TaxClass}
+}
+
 func (s *Store) CreateItem(item *models.Item) error {
 	query := `
-		INSERT INTO items (title, description, price, delivery_time, image_url, status, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		INSERT INTO items (title, description, price, delivery_time, image_url, status, weight_grams, length_cm, width_cm, height_cm, deposit_type, deposit_value, track_stock, stock, tax_class, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`
-	_, err := s.DB.Exec(query, item.Title, item.Description, item.Price, item.DeliveryTime, item.ImageURL, item.Status)
+	_, err := s.DB.Exec(query, item.Title, item.Description, item.Price, item.DeliveryTime, item.ImageURL, item.Status, item.WeightGrams, item.LengthCm, item.WidthCm, item.HeightCm, item.DepositType, item.DepositValue, item.TrackStock, item.Stock, item.TaxClass)
 	return err
 }
 
 func (s *Store) GetAllItems() ([]models.Item, error) {
 	// Ensure we select status. For migration safety, if column doesn't exist this fails.
 	// Ideally we'd use a migration tool.
-	query := `SELECT id, title, description, price, delivery_time, image_url, COALESCE(status, 'available') as status, created_at FROM items ORDER BY created_at DESC`
+	query := `SELECT ` + itemColumns + ` FROM items ORDER BY created_at DESC`
 	rows, err := s.DB.Query(query)
 	if err != nil {
 		return nil, err
@@ -26,7 +43,7 @@ func (s *Store) GetAllItems() ([]models.Item, error) {
 	var items []models.Item
 	for rows.Next() {
 		var i models.Item
-		if err := rows.Scan(&i.ID, &i.Title, &i.Description, &i.Price, &i.DeliveryTime, &i.ImageURL, &i.Status, &i.CreatedAt); err != nil {
+		if err := rows.Scan(itemDest(&i)...); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -35,7 +52,51 @@ func (s *Store) GetAllItems() ([]models.Item, error) {
 }
 
 func (s *Store) DeleteItem(id int) error {
-	query := `DELETE FROM items WHERE id = ?`
-	_, err := s.DB.Exec(query, id)
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM item_translations WHERE item_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM items WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListItemTranslations returns an item's translations, by language.
+func (s *Store) ListItemTranslations(itemID int) (map[string]models.ItemTranslation, error) {
+	rows, err := s.DB.Query(`SELECT lang, title, description FROM item_translations WHERE item_id = ?`, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := make(map[string]models.ItemTranslation)
+	for rows.Next() {
+		var t models.ItemTranslation
+		if err := rows.Scan(&t.Lang, &t.Title, &t.Description); err != nil {
+			return nil, err
+		}
+		translations[t.Lang] = t
+	}
+	return translations, rows.Err()
+}
+
+// SaveItemTranslation adds or replaces an item's translation into t.Lang,
+// removing it if both the title and description are blank.
+func (s *Store) SaveItemTranslation(itemID int, t models.ItemTranslation) error {
+	if t.Title == "" && t.Description == "" {
+		_, err := s.DB.Exec(`DELETE FROM item_translations WHERE item_id = ? AND lang = ?`, itemID, t.Lang)
+		return err
+	}
+	query := `
+		INSERT INTO item_translations (item_id, lang, title, description) VALUES (?, ?, ?, ?)
+		ON CONFLICT (item_id, lang) DO UPDATE SET title = excluded.title, description = excluded.description
+	`
+	_, err := s.DB.Exec(query, itemID, t.Lang, t.Title, t.Description)
 	return err
 }
\ No newline at end of file
@@ -4,13 +4,16 @@ import (
 	"github.com/alextreichler/crochetbyjuliette/internal/models"
 )
 
-func (s *Store) GetPublicItems() ([]models.Item, error) {
+// GetPublicItems returns the items on sale, with their titles and
+// descriptions in lang where they have been translated into it. Pass "" for
+// the default language.
+func (s *Store) GetPublicItems(lang string) ([]models.Item, error) {
 	// Exclude archived items
-	query := `SELECT id, title, description, price, delivery_time, image_url, COALESCE(status, 'available') as status, created_at 
+	query := `SELECT ` + localizedItemColumns + `
 	          FROM items 
 	          WHERE status != 'archived' OR status IS NULL 
 	          ORDER BY created_at DESC`
-	rows, err := s.DB.Query(query)
+	rows, err := s.DB.Query(query, lang, lang)
 	if err != nil {
 		return nil, err
 	}
@@ -19,7 +22,7 @@ func (s *Store) GetPublicItems() ([]models.Item, error) {
 	var items []models.Item
 	for rows.Next() {
 		var i models.Item
-		if err := rows.Scan(&i.ID, &i.Title, &i.Description, &i.Price, &i.DeliveryTime, &i.ImageURL, &i.Status, &i.CreatedAt); err != nil {
+		if err := rows.Scan(itemDest(&i)...); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -27,10 +30,12 @@ func (s *Store) GetPublicItems() ([]models.Item, error) {
 	return items, nil
 }
 
-func (s *Store) GetItemByID(id int) (*models.Item, error) {
-	query := `SELECT id, title, description, price, delivery_time, image_url, COALESCE(status, 'available') as status, created_at FROM items WHERE id = ?`
+// GetItemByID returns an item with its title and description in lang, like
+// GetPublicItems.
+func (s *Store) GetItemByID(id int, lang string) (*models.Item, error) {
+	query := `SELECT ` + localizedItemColumns + ` FROM items WHERE id = ?`
 	var i models.Item
-	err := s.DB.QueryRow(query, id).Scan(&i.ID, &i.Title, &i.Description, &i.Price, &i.DeliveryTime, &i.ImageURL, &i.Status, &i.CreatedAt)
+	err := s.DB.QueryRow(query, lang, lang, id).Scan(itemDest(&i)...)
 	if err != nil {
 		return nil, err
 	}
@@ -40,10 +45,10 @@ func (s *Store) GetItemByID(id int) (*models.Item, error) {
 func (s *Store) UpdateItem(item *models.Item) error {
 	query := `
 		UPDATE items 
-		SET title = ?, description = ?, price = ?, delivery_time = ?, status = ?
+		SET title = ?, description = ?, price = ?, delivery_time = ?, status = ?, weight_grams = ?, length_cm = ?, width_cm = ?, height_cm = ?, deposit_type = ?, deposit_value = ?, track_stock = ?, stock = ?, tax_class = ?
 		WHERE id = ?
 	`
-	_, err := s.DB.Exec(query, item.Title, item.Description, item.Price, item.DeliveryTime, item.Status, item.ID)
+	_, err := s.DB.Exec(query, item.Title, item.Description, item.Price, item.DeliveryTime, item.Status, item.WeightGrams, item.LengthCm, item.WidthCm, item.HeightCm, item.DepositType, item.DepositValue, item.TrackStock, item.Stock, item.TaxClass, item.ID)
 	return err
 }
 
@@ -52,3 +57,35 @@ func (s *Store) UpdateItemImage(id int, imageURL string) error {
 	_, err := s.DB.Exec(query, imageURL, id)
 	return err
 }
+
+// TakeStock takes quantity of an item that tracks stock, marking it out of
+// stock when none are left. It reports false, taking nothing, if there
+// aren't enough.
+func (s *Store) TakeStock(itemID, quantity int) (bool, error) {
+	query := `
+		UPDATE items SET stock = stock - ?,
+			status = CASE WHEN stock - ? <= 0 AND status = 'available' THEN 'out_of_stock' ELSE status END
+		WHERE id = ? AND track_stock = 1 AND stock >= ?
+	`
+	res, err := s.DB.Exec(query, quantity, quantity, itemID, quantity)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// returnStockQuery puts stock back; its arguments are the quantity (twice)
+// and the item ID.
+const returnStockQuery = `
+	UPDATE items SET stock = stock + ?,
+		status = CASE WHEN stock + ? > 0 AND status = 'out_of_stock' THEN 'available' ELSE status END
+	WHERE id = ? AND track_stock = 1
+`
+
+// ReturnStock puts quantity of an item back in stock, making it available
+// again if it had sold out.
+func (s *Store) ReturnStock(itemID, quantity int) error {
+	_, err := s.DB.Exec(returnStockQuery, quantity, quantity, itemID)
+	return err
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+)
+
+func (s *Store) RecordLoginAttempt(username, ip string, success bool, reason string) error {
+	query := `INSERT INTO login_attempts (username, ip, success, reason) VALUES (?, ?, ?, ?)`
+	_, err := s.DB.Exec(query, username, ip, success, reason)
+	return err
+}
+
+// LoginFailures counts failed attempts within window for the given column
+// ("username" or "ip"), ignoring attempts rejected by throttling, and returns
+// the time of the most recent failure. Usernames are compared as given, so
+// they must be case-folded when recorded and here, which lets the indexes be
+// used. A username's failures before its last successful login don't count;
+// an IP's always do, as one person logging in from it says nothing about
+// the other usernames tried. Timestamps only have second precision, so the
+// time is rounded up to err on the side of a longer wait.
+func (s *Store) LoginFailures(column, value string, window time.Duration) (int, time.Time, error) {
+	if column != "username" && column != "ip" {
+		return 0, time.Time{}, fmt.Errorf("invalid login attempt column %q", column)
+	}
+	since := fmt.Sprintf("-%d seconds", int(window.Seconds()))
+	query := `
+		SELECT COUNT(*), COALESCE(CAST(strftime('%s', MAX(created_at)) AS INTEGER), 0)
+		FROM login_attempts
+		WHERE ` + column + ` = ? AND success = 0 AND reason != 'throttled'
+		  AND created_at > datetime('now', ?)
+	`
+	args := []any{value, since}
+	if column == "username" {
+		query += ` AND created_at > COALESCE((SELECT MAX(created_at) FROM login_attempts WHERE username = ? AND success = 1), '')`
+		args = append(args, value)
+	}
+	var count int
+	var last int64
+	if err := s.DB.QueryRow(query, args...).Scan(&count, &last); err != nil {
+		return 0, time.Time{}, err
+	}
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+	return count, time.Unix(last+1, 0), nil
+}
+
+func (s *Store) GetRecentFailedLogins(limit int) ([]models.LoginAttempt, error) {
+	query := `
+		SELECT id, username, ip, success, COALESCE(reason, ''), created_at
+		FROM login_attempts
+		WHERE success = 0
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`
+	rows, err := s.DB.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []models.LoginAttempt
+	for rows.Next() {
+		var a models.LoginAttempt
+		if err := rows.Scan(&a.ID, &a.Username, &a.IP, &a.Success, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
@@ -1,37 +1,77 @@
 package store
 
 import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/emailaddr"
 	"github.com/alextreichler/crochetbyjuliette/internal/models"
 )
 
+const orderDetailColumns = `o.id, COALESCE(o.order_ref, CAST(o.id AS TEXT)) as order_ref, o.item_id, i.title, i.image_url, COALESCE(o.quantity, 1) as quantity, o.customer_name, o.customer_email, COALESCE(o.delivery_method, 'shipping'), COALESCE(o.payment_method, 'in_person'), o.status, o.notes, COALESCE(o.admin_comments, '') as admin_comments, COALESCE(o.magic_token_hash, ''), o.magic_token_expiry, COALESCE(o.customer_id, 0), o.created_at, o.stock_reserved, ` + orderAddressColumns + `, ` + orderShippingColumns + `, ` + orderAmountColumns
+
+func scanOrderDetail(row interface{ Scan(...any) error }) (*models.Order, error) {
+	var o models.Order
+	var expiry sql.NullTime
+	dest := []any{&o.ID, &o.OrderRef, &o.ItemID, &o.ItemTitle, &o.ItemImageURL, &o.Quantity, &o.CustomerName, &o.CustomerEmail, &o.DeliveryMethod, &o.PaymentMethod, &o.Status, &o.Notes, &o.AdminComments, &o.MagicTokenHash, &expiry, &o.CustomerID, &o.CreatedAt, &o.StockReserved}
+	dest = append(dest, orderAddressDest(&o)...)
+	dest = append(dest, orderShippingDest(&o)...)
+	if err := row.Scan(append(dest, orderAmountDest(&o)...)...); err != nil {
+		return nil, err
+	}
+	o.MagicTokenExpiry = expiry.Time
+	return &o, nil
+}
+
+// GetOrderByToken looks an order up by the token from its emailed link.
+// Revoked links match nothing; expiry is left to the caller.
 func (s *Store) GetOrderByToken(token string) (*models.Order, error) {
 	// Join with items table to get item details
 	query := `
-		SELECT o.id, COALESCE(o.order_ref, CAST(o.id AS TEXT)) as order_ref, o.item_id, i.title, i.image_url, COALESCE(o.quantity, 1) as quantity, o.customer_name, o.customer_email, o.customer_address, COALESCE(o.delivery_method, 'shipping'), COALESCE(o.payment_method, 'in_person'), o.status, o.notes, COALESCE(o.admin_comments, '') as admin_comments, o.magic_token, o.magic_token_expiry, o.created_at 
+		SELECT ` + orderDetailColumns + `
 		FROM orders o
 		JOIN items i ON o.item_id = i.id
-		WHERE o.magic_token = ?
+		WHERE o.magic_token_hash = ?
 	`
-	row := s.DB.QueryRow(query, token)
+	return scanOrderDetail(s.DB.QueryRow(query, HashToken(token)))
+}
 
-	var o models.Order
-	if err := row.Scan(&o.ID, &o.OrderRef, &o.ItemID, &o.ItemTitle, &o.ItemImageURL, &o.Quantity, &o.CustomerName, &o.CustomerEmail, &o.CustomerAddress, &o.DeliveryMethod, &o.PaymentMethod, &o.Status, &o.Notes, &o.AdminComments, &o.MagicToken, &o.MagicTokenExpiry, &o.CreatedAt); err != nil {
-		return nil, err
-	}
-	return &o, nil
+// GetOrderByRef looks an order up by its public reference. Callers must check
+// that the visitor is allowed to see it.
+func (s *Store) GetOrderByRef(ref string) (*models.Order, error) {
+	query := `
+		SELECT ` + orderDetailColumns + `
+		FROM orders o
+		JOIN items i ON o.item_id = i.id
+		WHERE COALESCE(o.order_ref, CAST(o.id AS TEXT)) = ?
+	`
+	return scanOrderDetail(s.DB.QueryRow(query, ref))
+}
+
+// GetOrderByID returns the full order, for admin actions.
+func (s *Store) GetOrderByID(id int) (*models.Order, error) {
+	query := `
+		SELECT ` + orderDetailColumns + `
+		FROM orders o
+		JOIN items i ON o.item_id = i.id
+		WHERE o.id = ?
+	`
+	return scanOrderDetail(s.DB.QueryRow(query, id))
 }
 
-// Updated to be case-insensitive
+// GetOrdersByEmail matches on the normalized, case-folded address, so
+// "Jane@Example.com" finds orders placed as "jane@example.com".
 func (s *Store) GetOrdersByEmail(email string) ([]models.Order, error) {
 	// Select basic info needed for the list
 	query := `
-		SELECT o.id, COALESCE(o.order_ref, CAST(o.id AS TEXT)) as order_ref, o.item_id, i.title, i.image_url, COALESCE(o.quantity, 1) as quantity, o.status, o.created_at, o.magic_token 
+		SELECT o.id, COALESCE(o.order_ref, CAST(o.id AS TEXT)) as order_ref, o.item_id, i.title, i.image_url, COALESCE(o.quantity, 1) as quantity, o.status, o.created_at
 		FROM orders o
 		JOIN items i ON o.item_id = i.id
-		WHERE LOWER(o.customer_email) = LOWER(?)
+		WHERE o.customer_email_key = ?
 		ORDER BY o.created_at DESC
 	`
-	rows, err := s.DB.Query(query, email)
+	rows, err := s.DB.Query(query, emailaddr.Key(email))
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +81,7 @@ func (s *Store) GetOrdersByEmail(email string) ([]models.Order, error) {
 	for rows.Next() {
 		var o models.Order
 		// Note: scanning into partial struct (fields not in query will be zero-value)
-		if err := rows.Scan(&o.ID, &o.OrderRef, &o.ItemID, &o.ItemTitle, &o.ItemImageURL, &o.Quantity, &o.Status, &o.CreatedAt, &o.MagicToken); err != nil {
+		if err := rows.Scan(&o.ID, &o.OrderRef, &o.ItemID, &o.ItemTitle, &o.ItemImageURL, &o.Quantity, &o.Status, &o.CreatedAt); err != nil {
 			return nil, err
 		}
 		orders = append(orders, o)
@@ -49,26 +89,69 @@ func (s *Store) GetOrdersByEmail(email string) ([]models.Order, error) {
 	return orders, nil
 }
 
-func (s *Store) UpdateOrderToken(id int, token string) error {
-	query := `UPDATE orders SET magic_token = ?, magic_token_expiry = datetime('now', '+30 days') WHERE id = ?`
-	_, err := s.DB.Exec(query, token, id)
+// SetOrderToken replaces an order's link, so any previous link stops working.
+func (s *Store) SetOrderToken(id int, token string, validFor time.Duration) error {
+	query := `UPDATE orders SET magic_token_hash = ?, magic_token_expiry = datetime('now', ?) WHERE id = ?`
+	_, err := s.DB.Exec(query, HashToken(token), fmt.Sprintf("+%d seconds", int(validFor.Seconds())), id)
+	return err
+}
+
+// RevokeOrderToken disables an order's link without issuing a new one.
+func (s *Store) RevokeOrderToken(id int) error {
+	_, err := s.DB.Exec(`UPDATE orders SET magic_token_hash = NULL WHERE id = ?`, id)
 	return err
 }
 
+// HashLegacyOrderTokens replaces order links stored in plaintext, from before
+// links were hashed, with their hashes. It is safe to run on every start.
+func (s *Store) HashLegacyOrderTokens() (int, error) {
+	rows, err := s.DB.Query(`SELECT id, magic_token FROM orders WHERE magic_token IS NOT NULL AND magic_token != ''`)
+	if err != nil {
+		return 0, err
+	}
+	type legacy struct {
+		id    int
+		token string
+	}
+	var tokens []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.token); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tokens = append(tokens, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, l := range tokens {
+		query := `UPDATE orders SET magic_token_hash = ?, magic_token = NULL WHERE id = ?`
+		if _, err := s.DB.Exec(query, HashToken(l.token), l.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(tokens), nil
+}
+
 // New Login Token Logic
 
 func (s *Store) CreateLoginToken(email, token string) error {
 	// Expires in 1 hour
 	query := `INSERT INTO login_tokens (token, email, expires_at) VALUES (?, ?, datetime('now', '+1 hour'))`
-	_, err := s.DB.Exec(query, token, email)
+	_, err := s.DB.Exec(query, HashToken(token), email)
 	return err
 }
 
-func (s *Store) GetEmailByLoginToken(token string) (string, error) {
+// ConsumeLoginToken returns the email a sign-in token was sent to and deletes
+// the token, so each link works only once.
+func (s *Store) ConsumeLoginToken(token string) (string, error) {
 	var email string
 	// Check if token exists and is not expired
-	query := `SELECT email FROM login_tokens WHERE token = ? AND expires_at > datetime('now')`
-	err := s.DB.QueryRow(query, token).Scan(&email)
+	query := `DELETE FROM login_tokens WHERE token = ? AND expires_at > datetime('now') RETURNING email`
+	err := s.DB.QueryRow(query, HashToken(token)).Scan(&email)
 	if err != nil {
 		return "", err
 	}
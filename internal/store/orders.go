@@ -1,23 +1,98 @@
 package store
 
 import (
+	"github.com/alextreichler/crochetbyjuliette/internal/emailaddr"
 	"github.com/alextreichler/crochetbyjuliette/internal/models"
 )
 
+// orderAddressColumns are the shipping address columns of orders o, in the
+// order orderAddressDest scans them.
+const orderAddressColumns = `COALESCE(o.address_legacy, ''), COALESCE(o.ship_name, ''), COALESCE(o.ship_line1, ''), COALESCE(o.ship_line2, ''), COALESCE(o.ship_city, ''), COALESCE(o.ship_region, ''), COALESCE(o.ship_postal_code, ''), COALESCE(o.ship_country, '')`
+
+func orderAddressDest(o *models.Order) []any {
+	a := &o.ShippingAddress
+	return []any{&o.LegacyAddress, &a.Name, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode, &a.Country}
+}
+
+// orderShippingColumns are the chosen shipping method of orders o, in the
+// order orderShippingDest scans them.
+const orderShippingColumns = `COALESCE(o.shipping_method_id, 0), o.shipping_method, o.shipping_fee`
+
+func orderShippingDest(o *models.Order) []any {
+	return []any{&o.ShippingMethodID, &o.ShippingMethod, &o.ShippingFee}
+}
+
+// orderAmountColumns are the prices of orders o, in the order
+// orderAmountDest scans them.
+const orderAmountColumns = `o.unit_price, o.deposit, o.tax, o.tax_inclusive, COALESCE(o.discount_code_id, 0), o.discount_code, o.discount`
+
+func orderAmountDest(o *models.Order) []any {
+	return []any{&o.UnitPrice, &o.Deposit, &o.Tax, &o.TaxInclusive, &o.DiscountCodeID, &o.DiscountCode, &o.Discount}
+}
+
+// unpaidOrderCondition matches orders o that are still owed money.
+const unpaidOrderCondition = `o.status != 'Cancelled' AND
+	o.unit_price * COALESCE(o.quantity, 1) - o.discount + o.shipping_fee + CASE WHEN o.tax_inclusive THEN 0 ELSE o.tax END - 0.005 >
+	COALESCE((SELECT SUM(p.amount) FROM payments p WHERE p.order_id = o.id AND p.status IN ('paid', 'refunded')), 0) -
+	COALESCE((SELECT SUM(r.amount) FROM refunds r WHERE r.order_id = o.id), 0)`
+
+// OrderFilter narrows down the admin order list.
+type OrderFilter struct {
+	Unpaid bool // Only orders with something left to pay
+}
+
+func (f OrderFilter) where() string {
+	if f.Unpaid {
+		return "WHERE " + unpaidOrderCondition
+	}
+	return ""
+}
+
+// CreateOrder saves a new order with its taxes and sets its ID. It returns
+// discount.ErrUsedUp or discount.ErrUsedByEmail if the order's discount code
+// was used up in the meantime.
 func (s *Store) CreateOrder(order *models.Order) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if order.DiscountCodeID != 0 {
+		if err := checkDiscountLimits(tx, order.DiscountCodeID, order.CustomerEmail); err != nil {
+			return err
+		}
+	}
+
 	query := `
-		INSERT INTO orders (item_id, order_ref, quantity, customer_name, customer_email, customer_address, delivery_method, payment_method, status, notes, magic_token, magic_token_expiry, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		INSERT INTO orders (item_id, order_ref, quantity, customer_name, customer_email, customer_email_key, address_legacy, ship_name, ship_line1, ship_line2, ship_city, ship_region, ship_postal_code, ship_country, delivery_method, shipping_method_id, shipping_method, shipping_fee, unit_price, deposit, tax, tax_inclusive, discount_code_id, discount_code, discount, stock_reserved, payment_method, status, notes, magic_token_hash, magic_token_expiry, customer_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, '', ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), CURRENT_TIMESTAMP)
 	`
-	_, err := s.DB.Exec(query, order.ItemID, order.OrderRef, order.Quantity, order.CustomerName, order.CustomerEmail, order.CustomerAddress, order.DeliveryMethod, order.PaymentMethod, order.Status, order.Notes, order.MagicToken, order.MagicTokenExpiry)
-	return err
+	a := order.ShippingAddress
+	res, err := tx.Exec(query, order.ItemID, order.OrderRef, order.Quantity, order.CustomerName, order.CustomerEmail, emailaddr.Key(order.CustomerEmail), a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, order.DeliveryMethod, order.ShippingMethodID, order.ShippingMethod, order.ShippingFee, order.UnitPrice, order.Deposit, order.Tax, order.TaxInclusive, order.DiscountCodeID, order.DiscountCode, order.Discount, order.StockReserved, order.PaymentMethod, order.Status, order.Notes, HashToken(order.MagicToken), order.MagicTokenExpiry, order.CustomerID)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := insertOrderTaxes(tx, int(id), order.Taxes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	order.ID = int(id)
+	return nil
 }
 
-func (s *Store) GetAllOrders(limit, offset int) ([]models.Order, error) {
+func (s *Store) GetAllOrders(filter OrderFilter, limit, offset int) ([]models.Order, error) {
 	query := `
-		SELECT o.id, COALESCE(o.order_ref, CAST(o.id AS TEXT)) as order_ref, o.item_id, i.title, i.image_url, COALESCE(o.quantity, 1) as quantity, o.customer_name, o.customer_email, o.customer_address, COALESCE(o.delivery_method, 'shipping'), COALESCE(o.payment_method, 'in_person'), o.status, o.notes, COALESCE(o.admin_comments, '') as admin_comments, o.created_at 
+		SELECT o.id, COALESCE(o.order_ref, CAST(o.id AS TEXT)) as order_ref, o.item_id, i.title, i.image_url, COALESCE(o.quantity, 1) as quantity, o.customer_name, o.customer_email, COALESCE(o.delivery_method, 'shipping'), COALESCE(o.payment_method, 'in_person'), o.status, o.notes, COALESCE(o.admin_comments, '') as admin_comments, o.created_at, ` + orderAddressColumns + `, ` + orderShippingColumns + `, ` + orderAmountColumns + `
 		FROM orders o
 		JOIN items i ON o.item_id = i.id
+		` + filter.where() + `
 		ORDER BY o.created_at DESC
 		LIMIT ? OFFSET ?
 	`
@@ -30,7 +105,10 @@ func (s *Store) GetAllOrders(limit, offset int) ([]models.Order, error) {
 	var orders []models.Order
 	for rows.Next() {
 		var o models.Order
-		if err := rows.Scan(&o.ID, &o.OrderRef, &o.ItemID, &o.ItemTitle, &o.ItemImageURL, &o.Quantity, &o.CustomerName, &o.CustomerEmail, &o.CustomerAddress, &o.DeliveryMethod, &o.PaymentMethod, &o.Status, &o.Notes, &o.AdminComments, &o.CreatedAt); err != nil {
+		dest := []any{&o.ID, &o.OrderRef, &o.ItemID, &o.ItemTitle, &o.ItemImageURL, &o.Quantity, &o.CustomerName, &o.CustomerEmail, &o.DeliveryMethod, &o.PaymentMethod, &o.Status, &o.Notes, &o.AdminComments, &o.CreatedAt}
+		dest = append(dest, orderAddressDest(&o)...)
+		dest = append(dest, orderShippingDest(&o)...)
+		if err := rows.Scan(append(dest, orderAmountDest(&o)...)...); err != nil {
 			return nil, err
 		}
 		orders = append(orders, o)
@@ -38,29 +116,52 @@ func (s *Store) GetAllOrders(limit, offset int) ([]models.Order, error) {
 	return orders, nil
 }
 
-func (s *Store) GetTotalOrdersCount() (int, error) {
+func (s *Store) GetTotalOrdersCount(filter OrderFilter) (int, error) {
 	var count int
-	err := s.DB.QueryRow("SELECT COUNT(*) FROM orders").Scan(&count)
+	err := s.DB.QueryRow("SELECT COUNT(*) FROM orders o " + filter.where()).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
+// UpdateOrderStatus sets an order's status and comments, noting when it was
+// first marked Delivered.
 func (s *Store) UpdateOrderStatus(id int, status string, adminComments string) error {
-	query := `UPDATE orders SET status = ?, admin_comments = ? WHERE id = ?`
-	_, err := s.DB.Exec(query, status, adminComments, id)
+	query := `
+		UPDATE orders SET status = ?, admin_comments = ?,
+			delivered_at = CASE WHEN ? = 'Delivered' THEN COALESCE(delivered_at, CURRENT_TIMESTAMP) ELSE NULL END
+		WHERE id = ?
+	`
+	_, err := s.DB.Exec(query, status, adminComments, status, id)
 	return err
 }
 
-func (s *Store) UpdateOrderDetails(order *models.Order) error {
-	query := `UPDATE orders SET quantity = ?, customer_name = ?, customer_email = ?, customer_address = ?, delivery_method = ?, payment_method = ?, notes = ? WHERE id = ?`
-	_, err := s.DB.Exec(query, order.Quantity, order.CustomerName, order.CustomerEmail, order.CustomerAddress, order.DeliveryMethod, order.PaymentMethod, order.Notes, order.ID)
-	return err
-}
+// UpdateOrderDetails saves a customer's changes to an order, replacing its
+// taxes with order.Taxes. It reports false, changing nothing, if the order
+// is no longer Ordered, as when it was cancelled or work started on it
+// meanwhile.
+func (s *Store) UpdateOrderDetails(order *models.Order) (bool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
 
-func (s *Store) CancelOrder(id int) error {
-	query := `UPDATE orders SET status = 'Cancelled' WHERE id = ?`
-	_, err := s.DB.Exec(query, id)
-	return err
+	query := `UPDATE orders SET quantity = ?, customer_name = ?, customer_email = ?, customer_email_key = ?, ship_name = ?, ship_line1 = ?, ship_line2 = ?, ship_city = ?, ship_region = ?, ship_postal_code = ?, ship_country = ?, delivery_method = ?, shipping_fee = ?, deposit = ?, tax = ?, discount = ?, stock_reserved = ?, payment_method = ?, notes = ? WHERE id = ? AND status = 'Ordered'`
+	a := order.ShippingAddress
+	res, err := tx.Exec(query, order.Quantity, order.CustomerName, order.CustomerEmail, emailaddr.Key(order.CustomerEmail), a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, order.DeliveryMethod, order.ShippingFee, order.Deposit, order.Tax, order.Discount, order.StockReserved, order.PaymentMethod, order.Notes, order.ID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM order_taxes WHERE order_id = ?`, order.ID); err != nil {
+		return false, err
+	}
+	if err := insertOrderTaxes(tx, order.ID, order.Taxes); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
 }
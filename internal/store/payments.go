@@ -0,0 +1,115 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+)
+
+const paymentColumns = `id, order_id, provider, method, checkout_id, reference, amount, currency, status, paid_at, created_at, updated_at`
+
+func scanPayment(row interface{ Scan(...any) error }) (*models.Payment, error) {
+	var p models.Payment
+	var paidAt sql.NullTime
+	if err := row.Scan(&p.ID, &p.OrderID, &p.Provider, &p.Method, &p.CheckoutID, &p.Reference, &p.Amount, &p.Currency, &p.Status, &paidAt, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	p.PaidAt = paidAt.Time
+	return &p, nil
+}
+
+// CreatePayment records a payment and sets its ID.
+func (s *Store) CreatePayment(p *models.Payment) error {
+	query := `
+		INSERT INTO payments (order_id, provider, method, checkout_id, reference, amount, currency, status, paid_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`
+	var paidAt sql.NullTime
+	if !p.PaidAt.IsZero() {
+		paidAt = sql.NullTime{Time: p.PaidAt, Valid: true}
+	}
+	res, err := s.DB.Exec(query, p.OrderID, p.Provider, p.Method, p.CheckoutID, p.Reference, p.Amount, p.Currency, p.Status, paidAt)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	p.ID = int(id)
+	return err
+}
+
+// SetPaymentCheckout stores the provider's checkout ID once it is created.
+func (s *Store) SetPaymentCheckout(id int, checkoutID string) error {
+	_, err := s.DB.Exec(`UPDATE payments SET checkout_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, checkoutID, id)
+	return err
+}
+
+// UpdatePaymentStatus sets a payment's status, and its reference if one is
+// given. A payment's paid_at is set the first time it is paid.
+func (s *Store) UpdatePaymentStatus(id int, status, reference string) error {
+	query := `
+		UPDATE payments SET status = ?, reference = COALESCE(NULLIF(?, ''), reference),
+			paid_at = CASE WHEN ? = 'paid' THEN COALESCE(paid_at, CURRENT_TIMESTAMP) ELSE paid_at END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := s.DB.Exec(query, status, reference, status, id)
+	return err
+}
+
+// SetPaymentAmount corrects the amount of a payment, for when the provider
+// reports that a different amount was paid.
+func (s *Store) SetPaymentAmount(id int, amount float64) error {
+	_, err := s.DB.Exec(`UPDATE payments SET amount = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, amount, id)
+	return err
+}
+
+// GetPayment returns nil, nil when no payment has the given ID.
+func (s *Store) GetPayment(id int) (*models.Payment, error) {
+	p, err := scanPayment(s.DB.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+func (s *Store) DeletePayment(id int) error {
+	_, err := s.DB.Exec(`DELETE FROM payments WHERE id = ?`, id)
+	return err
+}
+
+// GetPaymentByCheckout returns nil, nil when no payment has the checkout ID.
+func (s *Store) GetPaymentByCheckout(provider, checkoutID string) (*models.Payment, error) {
+	p, err := scanPayment(s.DB.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE provider = ? AND checkout_id = ?`, provider, checkoutID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// GetPaymentByReference returns nil, nil when no payment has the reference.
+func (s *Store) GetPaymentByReference(provider, reference string) (*models.Payment, error) {
+	p, err := scanPayment(s.DB.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE provider = ? AND reference = ? AND reference != ''`, provider, reference))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// ListPayments returns an order's payments, oldest first.
+func (s *Store) ListPayments(orderID int) ([]models.Payment, error) {
+	rows, err := s.DB.Query(`SELECT `+paymentColumns+` FROM payments WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *p)
+	}
+	return list, rows.Err()
+}
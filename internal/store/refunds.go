@@ -0,0 +1,101 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+)
+
+const refundColumns = `id, order_id, COALESCE(payment_id, 0), method, amount, reference, note, created_at`
+
+func scanRefund(row interface{ Scan(...any) error }) (*models.Refund, error) {
+	var r models.Refund
+	if err := row.Scan(&r.ID, &r.OrderID, &r.PaymentID, &r.Method, &r.Amount, &r.Reference, &r.Note, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+const insertRefundQuery = `
+	INSERT INTO refunds (order_id, payment_id, method, amount, reference, note, created_at)
+	VALUES (?, NULLIF(?, 0), ?, ?, ?, ?, CURRENT_TIMESTAMP)
+`
+
+// CreateRefund records a refund and sets its ID.
+func (s *Store) CreateRefund(r *models.Refund) error {
+	res, err := s.DB.Exec(insertRefundQuery, r.OrderID, r.PaymentID, r.Method, r.Amount, r.Reference, r.Note)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	r.ID = int(id)
+	return err
+}
+
+// RefundPayment marks the refund's payment refunded and records the refund,
+// setting its ID.
+func (s *Store) RefundPayment(r *models.Refund) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE payments SET status = 'refunded', updated_at = CURRENT_TIMESTAMP WHERE id = ?`, r.PaymentID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(insertRefundQuery, r.OrderID, r.PaymentID, r.Method, r.Amount, r.Reference, r.Note)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	r.ID = int(id)
+	return tx.Commit()
+}
+
+// GetRefund returns nil, nil when no refund has the given ID.
+func (s *Store) GetRefund(id int) (*models.Refund, error) {
+	r, err := scanRefund(s.DB.QueryRow(`SELECT `+refundColumns+` FROM refunds WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+func (s *Store) DeleteRefund(id int) error {
+	_, err := s.DB.Exec(`DELETE FROM refunds WHERE id = ?`, id)
+	return err
+}
+
+// ListRefunds returns an order's refunds, oldest first.
+func (s *Store) ListRefunds(orderID int) ([]models.Refund, error) {
+	rows, err := s.DB.Query(`SELECT `+refundColumns+` FROM refunds WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.Refund
+	for rows.Next() {
+		r, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *r)
+	}
+	return list, rows.Err()
+}
+
+// LoadPayments fills in an order's payments and refunds, which its amount
+// paid and balance are worked out from.
+func (s *Store) LoadPayments(order *models.Order) error {
+	var err error
+	if order.Payments, err = s.ListPayments(order.ID); err != nil {
+		return err
+	}
+	order.Refunds, err = s.ListRefunds(order.ID)
+	return err
+}
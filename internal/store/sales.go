@@ -0,0 +1,211 @@
+package store
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+// Bucket sizes for the sales report's time series.
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// Buckets lists the bucket sizes, smallest first.
+var Buckets = []string{BucketDay, BucketWeek, BucketMonth}
+
+// orderTotalSQL is what the customer owes for an order o, as in
+// models.Order.Total.
+const orderTotalSQL = `(o.unit_price * o.quantity - o.discount + o.shipping_fee + CASE WHEN o.tax_inclusive THEN 0 ELSE o.tax END)`
+
+// notCancelled leaves cancelled orders out of the sales report; they were
+// never paid for, or were refunded.
+const notCancelled = `o.status != 'Cancelled'`
+
+// SalesPoint is the orders placed in one day, week or month.
+type SalesPoint struct {
+	Start   time.Time
+	Orders  int
+	Revenue float64
+}
+
+// ItemRevenue is what one item brought in: its price less discounts,
+// without delivery or tax.
+type ItemRevenue struct {
+	ItemID   int
+	Title    string
+	Orders   int
+	Quantity int
+	Revenue  float64
+}
+
+// SalesReport summarises the orders placed over a period, leaving out
+// cancelled ones.
+type SalesReport struct {
+	Bucket  string
+	Series  []SalesPoint // One per bucket, including empty ones
+	Orders  int
+	Revenue float64
+
+	// Orders delivered in the period and the average time from being
+	// placed to being marked Delivered.
+	Delivered       int
+	AverageDelivery time.Duration
+
+	// Customers who ordered in the period, by email, and how many of them
+	// have ordered more than once by its end.
+	Customers       int
+	RepeatCustomers int
+
+	TopItems []ItemRevenue
+}
+
+// RepeatRate is the percentage of customers who ordered more than once, to
+// one decimal place.
+func (r SalesReport) RepeatRate() float64 {
+	if r.Customers == 0 {
+		return 0
+	}
+	return math.Round(float64(r.RepeatCustomers)/float64(r.Customers)*1000) / 10
+}
+
+// AverageDeliveryDays is AverageDelivery in days.
+func (r SalesReport) AverageDeliveryDays() float64 {
+	return r.AverageDelivery.Hours() / 24
+}
+
+// AverageOrder is the average order total.
+func (r SalesReport) AverageOrder() float64 {
+	if r.Orders == 0 {
+		return 0
+	}
+	return r.Revenue / float64(r.Orders)
+}
+
+// BucketStart returns the start of the day, week (from Monday) or month t
+// falls in.
+func BucketStart(t time.Time, bucket string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch bucket {
+	case BucketWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// nextBucket returns the start of the bucket after the one starting at start.
+func nextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// GetSalesReport reports on the orders placed from the start of from to the
+// end of to, with the orders and revenue per bucket, which must be one of
+// Buckets. At most topItems items are listed.
+func (s *Store) GetSalesReport(from, to time.Time, bucket string, topItems int) (*SalesReport, error) {
+	start, end := from.Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02")
+	report := &SalesReport{Bucket: bucket}
+
+	// Per day, gathered into buckets here so weeks and months line up with
+	// BucketStart
+	rows, err := s.DB.Query(`
+		SELECT date(o.created_at), COUNT(*), COALESCE(SUM(`+orderTotalSQL+`), 0)
+		FROM orders o
+		WHERE `+notCancelled+` AND o.created_at >= ? AND o.created_at < ?
+		GROUP BY 1
+	`, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byBucket := make(map[time.Time]*SalesPoint)
+	for t := BucketStart(from, bucket); !t.After(to); t = nextBucket(t, bucket) {
+		report.Series = append(report.Series, SalesPoint{Start: t})
+	}
+	for i := range report.Series {
+		byBucket[report.Series[i].Start] = &report.Series[i]
+	}
+	for rows.Next() {
+		var day string
+		var orders int
+		var revenue float64
+		if err := rows.Scan(&day, &orders, &revenue); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			return nil, err
+		}
+		if p := byBucket[BucketStart(t, bucket)]; p != nil {
+			p.Orders += orders
+			p.Revenue += revenue
+		}
+		report.Orders += orders
+		report.Revenue += revenue
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Fulfilment time
+	var days sql.NullFloat64
+	err = s.DB.QueryRow(`
+		SELECT COUNT(*), AVG(julianday(o.delivered_at) - julianday(o.created_at))
+		FROM orders o
+		WHERE o.status = 'Delivered' AND o.delivered_at >= ? AND o.delivered_at < ?
+	`, start, end).Scan(&report.Delivered, &days)
+	if err != nil {
+		return nil, err
+	}
+	report.AverageDelivery = time.Duration(days.Float64 * float64(24*time.Hour))
+
+	// Repeat customers. Orders from before emails were normalized have no
+	// key, so fall back to the address itself.
+	err = s.DB.QueryRow(`
+		WITH customers AS (
+			SELECT DISTINCT COALESCE(o.customer_email_key, lower(o.customer_email)) AS email
+			FROM orders o
+			WHERE `+notCancelled+` AND o.created_at >= ? AND o.created_at < ?
+		)
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN (
+			SELECT COUNT(*) FROM orders o
+			WHERE `+notCancelled+` AND o.created_at < ? AND COALESCE(o.customer_email_key, lower(o.customer_email)) = c.email
+		) > 1 THEN 1 ELSE 0 END), 0)
+		FROM customers c
+	`, start, end, end).Scan(&report.Customers, &report.RepeatCustomers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Top items
+	itemRows, err := s.DB.Query(`
+		SELECT o.item_id, COALESCE(i.title, ''), COUNT(*), SUM(o.quantity), SUM(o.unit_price * o.quantity - o.discount) AS revenue
+		FROM orders o
+		LEFT JOIN items i ON i.id = o.item_id
+		WHERE `+notCancelled+` AND o.created_at >= ? AND o.created_at < ?
+		GROUP BY o.item_id
+		ORDER BY revenue DESC
+		LIMIT ?
+	`, start, end, topItems)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var ir ItemRevenue
+		if err := itemRows.Scan(&ir.ItemID, &ir.Title, &ir.Orders, &ir.Quantity, &ir.Revenue); err != nil {
+			return nil, err
+		}
+		report.TopItems = append(report.TopItems, ir)
+	}
+	return report, itemRows.Err()
+}
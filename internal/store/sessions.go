@@ -0,0 +1,258 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base32"
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// SessionStore is a sessions.Store that keeps session data in SQLite. The
+// cookie only carries a signed random session ID, so a session can be ended
+// server-side by deleting its row, and sessions expire after IdleTimeout
+// without use or MaxLifetime after they were created, whichever comes first.
+type SessionStore struct {
+	Codecs      []securecookie.Codec
+	Options     *sessions.Options
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+	// ClientIP extracts the address recorded for a session. It defaults to
+	// the host part of RemoteAddr.
+	ClientIP func(r *http.Request) string
+
+	store *Store
+}
+
+// NewSessionStore returns a SessionStore whose session IDs are signed with
+// keyPairs, as with sessions.NewCookieStore.
+func (s *Store) NewSessionStore(idleTimeout, maxLifetime time.Duration, keyPairs ...[]byte) *SessionStore {
+	return &SessionStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: int(maxLifetime.Seconds()),
+		},
+		IdleTimeout: idleTimeout,
+		MaxLifetime: maxLifetime,
+		ClientIP: func(r *http.Request) string {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				return r.RemoteAddr
+			}
+			return host
+		},
+		store: s,
+	}
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("-%d seconds", int(d.Seconds()))
+}
+
+// Get returns a cached session for the request, loading it on first use.
+func (ss *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(ss, name)
+}
+
+// New loads the session named by the request's cookie, or returns a new empty
+// session if there is no cookie or the session has expired or been revoked.
+func (ss *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(ss, name)
+	opts := *ss.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var id string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &id, ss.Codecs...); err != nil {
+		return session, err
+	}
+
+	var data []byte
+	query := `
+		SELECT data FROM sessions
+		WHERE token_hash = ? AND name = ?
+		  AND last_seen_at > datetime('now', ?)
+		  AND created_at > datetime('now', ?)
+	`
+	err = ss.store.DB.QueryRow(query, HashToken(id), name, seconds(ss.IdleTimeout), seconds(ss.MaxLifetime)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+	session.ID = id
+	session.IsNew = false
+
+	// Only touch last_seen_at once a minute to avoid a write on every request.
+	touch := `UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP WHERE token_hash = ? AND last_seen_at < datetime('now', '-60 seconds')`
+	if _, err := ss.store.DB.Exec(touch, HashToken(id)); err != nil {
+		slog.Error("Failed to update session last seen time", "error", err)
+	}
+	return session, nil
+}
+
+// Save writes the session to the database and sets the cookie. A MaxAge <= 0
+// deletes the session. New sessions without values are not stored at all, so
+// anonymous page views don't create rows.
+func (ss *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if _, err := ss.store.DB.Exec(`DELETE FROM sessions WHERE token_hash = ?`, HashToken(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" && len(session.Values) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return err
+	}
+
+	// Sessions belong to an admin user only while they are logged in.
+	var userID any
+	if authenticated, _ := session.Values["authenticated"].(bool); authenticated {
+		if id, ok := session.Values["user_id"].(int); ok {
+			userID = id
+		}
+	}
+	ip := ss.ClientIP(r)
+	userAgent := r.UserAgent()
+
+	if session.ID == "" {
+		key := securecookie.GenerateRandomKey(32)
+		if key == nil {
+			return fmt.Errorf("failed to generate session ID")
+		}
+		id := strings.TrimRight(base32.StdEncoding.EncodeToString(key), "=")
+		query := `INSERT INTO sessions (token_hash, name, data, user_id, ip, user_agent) VALUES (?, ?, ?, ?, ?, ?)`
+		if _, err := ss.store.DB.Exec(query, HashToken(id), session.Name(), buf.Bytes(), userID, ip, userAgent); err != nil {
+			return err
+		}
+		session.ID = id
+	} else {
+		query := `UPDATE sessions SET data = ?, user_id = ?, ip = ?, user_agent = ?, last_seen_at = CURRENT_TIMESTAMP WHERE token_hash = ?`
+		res, err := ss.store.DB.Exec(query, buf.Bytes(), userID, ip, userAgent, HashToken(session.ID))
+		if err != nil {
+			return err
+		}
+		// The row is gone if the session was revoked while this request ran;
+		// don't resurrect it.
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.SetCookie(w, sessions.NewCookie(session.Name(), "", &sessions.Options{Path: session.Options.Path, Domain: session.Options.Domain, MaxAge: -1}))
+			return nil
+		}
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, ss.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// RenewID discards the stored copy of a session so that the next Save issues
+// it a fresh ID. Call it when a user logs in to prevent session fixation.
+func (ss *SessionStore) RenewID(session *sessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+	if _, err := ss.store.DB.Exec(`DELETE FROM sessions WHERE token_hash = ?`, HashToken(session.ID)); err != nil {
+		return err
+	}
+	session.ID = ""
+	return nil
+}
+
+// PurgeExpiredSessions deletes sessions past their idle or absolute timeout.
+func (ss *SessionStore) PurgeExpiredSessions() (int64, error) {
+	query := `DELETE FROM sessions WHERE last_seen_at <= datetime('now', ?) OR created_at <= datetime('now', ?)`
+	res, err := ss.store.DB.Exec(query, seconds(ss.IdleTimeout), seconds(ss.MaxLifetime))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ActiveSessions lists logged-in admin sessions that have not timed out,
+// for one user or, with userID 0, for everyone. currentID marks the session
+// making the request.
+func (ss *SessionStore) ActiveSessions(userID int, currentID string) ([]models.UserSession, error) {
+	query := `
+		SELECT s.id, s.user_id, u.username, COALESCE(s.ip, ''), COALESCE(s.user_agent, ''), s.created_at, s.last_seen_at, s.token_hash
+		FROM sessions s
+		JOIN users u ON s.user_id = u.id
+		WHERE (? = 0 OR s.user_id = ?)
+		  AND s.last_seen_at > datetime('now', ?)
+		  AND s.created_at > datetime('now', ?)
+		ORDER BY s.last_seen_at DESC
+	`
+	rows, err := ss.store.DB.Query(query, userID, userID, seconds(ss.IdleTimeout), seconds(ss.MaxLifetime))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currentHash := HashToken(currentID)
+	var list []models.UserSession
+	for rows.Next() {
+		var us models.UserSession
+		var tokenHash string
+		if err := rows.Scan(&us.ID, &us.UserID, &us.Username, &us.IP, &us.UserAgent, &us.CreatedAt, &us.LastSeenAt, &tokenHash); err != nil {
+			return nil, err
+		}
+		us.Current = currentID != "" && tokenHash == currentHash
+		list = append(list, us)
+	}
+	return list, rows.Err()
+}
+
+// GetSessionUserID returns the admin user a session row belongs to, or 0.
+func (ss *SessionStore) GetSessionUserID(id int) (int, error) {
+	var userID sql.NullInt64
+	err := ss.store.DB.QueryRow(`SELECT user_id FROM sessions WHERE id = ?`, id).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return int(userID.Int64), err
+}
+
+// RevokeSession deletes a single session by its row ID.
+func (ss *SessionStore) RevokeSession(id int) error {
+	_, err := ss.store.DB.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+// RevokeUserSessions logs a user out everywhere, except for the session
+// exceptID (a session ID as carried in the cookie) when it is not empty.
+func (ss *SessionStore) RevokeUserSessions(userID int, exceptID string) (int64, error) {
+	res, err := ss.store.DB.Exec(`DELETE FROM sessions WHERE user_id = ? AND token_hash != ?`, userID, HashToken(exceptID))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+)
+
+const shipmentColumns = `id, order_id, carrier, tracking_number, shipped_at, label_file, created_at`
+
+func scanShipment(row interface{ Scan(...any) error }) (*models.Shipment, error) {
+	var s models.Shipment
+	if err := row.Scan(&s.ID, &s.OrderID, &s.Carrier, &s.TrackingNumber, &s.ShippedAt, &s.LabelFile, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CreateShipment records a shipment and sets its ID.
+func (s *Store) CreateShipment(shipment *models.Shipment) error {
+	query := `
+		INSERT INTO shipments (order_id, carrier, tracking_number, shipped_at, label_file, created_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	res, err := s.DB.Exec(query, shipment.OrderID, shipment.Carrier, shipment.TrackingNumber, shipment.ShippedAt, shipment.LabelFile)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	shipment.ID = int(id)
+	return err
+}
+
+// ListShipments returns an order's shipments, oldest first.
+func (s *Store) ListShipments(orderID int) ([]models.Shipment, error) {
+	rows, err := s.DB.Query(`SELECT `+shipmentColumns+` FROM shipments WHERE order_id = ? ORDER BY shipped_at, id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shipments []models.Shipment
+	for rows.Next() {
+		shipment, err := scanShipment(rows)
+		if err != nil {
+			return nil, err
+		}
+		shipments = append(shipments, *shipment)
+	}
+	return shipments, rows.Err()
+}
+
+// GetShipment returns nil, nil when no shipment has the given ID.
+func (s *Store) GetShipment(id int) (*models.Shipment, error) {
+	shipment, err := scanShipment(s.DB.QueryRow(`SELECT `+shipmentColumns+` FROM shipments WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return shipment, err
+}
+
+func (s *Store) DeleteShipment(id int) error {
+	_, err := s.DB.Exec(`DELETE FROM shipments WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/shipping"
+)
+
+// ShippingTable loads every zone and method, for quoting.
+func (s *Store) ShippingTable() (shipping.Table, error) {
+	zones, err := s.ListShippingZones()
+	if err != nil {
+		return shipping.Table{}, err
+	}
+	methods, err := s.ListShippingMethods()
+	if err != nil {
+		return shipping.Table{}, err
+	}
+	return shipping.Table{Zones: zones, Methods: methods}, nil
+}
+
+func (s *Store) ListShippingZones() ([]shipping.Zone, error) {
+	rows, err := s.DB.Query(`SELECT id, name, countries FROM shipping_zones ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var zones []shipping.Zone
+	for rows.Next() {
+		var z shipping.Zone
+		var countries string
+		if err := rows.Scan(&z.ID, &z.Name, &countries); err != nil {
+			return nil, err
+		}
+		z.Countries = shipping.ParseCountries(countries)
+		zones = append(zones, z)
+	}
+	return zones, rows.Err()
+}
+
+// GetShippingZone returns nil if there is no such zone.
+func (s *Store) GetShippingZone(id int) (*shipping.Zone, error) {
+	var z shipping.Zone
+	var countries string
+	err := s.DB.QueryRow(`SELECT id, name, countries FROM shipping_zones WHERE id = ?`, id).Scan(&z.ID, &z.Name, &countries)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	z.Countries = shipping.ParseCountries(countries)
+	return &z, nil
+}
+
+func (s *Store) CreateShippingZone(z *shipping.Zone) error {
+	_, err := s.DB.Exec(`INSERT INTO shipping_zones (name, countries) VALUES (?, ?)`, z.Name, strings.Join(z.Countries, ","))
+	return err
+}
+
+func (s *Store) UpdateShippingZone(z *shipping.Zone) error {
+	_, err := s.DB.Exec(`UPDATE shipping_zones SET name = ?, countries = ? WHERE id = ?`, z.Name, strings.Join(z.Countries, ","), z.ID)
+	return err
+}
+
+// DeleteShippingZone deletes a zone and its methods. Orders keep the method
+// name and fee they were placed with.
+func (s *Store) DeleteShippingZone(id int) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM shipping_methods WHERE zone_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM shipping_zones WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const shippingMethodColumns = `id, COALESCE(zone_id, 0), name, kind, base_fee, per_kg, max_weight_grams, free_over, active`
+
+func scanShippingMethod(row interface{ Scan(...any) error }) (shipping.Method, error) {
+	var m shipping.Method
+	err := row.Scan(&m.ID, &m.ZoneID, &m.Name, &m.Kind, &m.BaseFee, &m.PerKg, &m.MaxWeightGrams, &m.FreeOver, &m.Active)
+	return m, err
+}
+
+func (s *Store) ListShippingMethods() ([]shipping.Method, error) {
+	rows, err := s.DB.Query(`SELECT ` + shippingMethodColumns + ` FROM shipping_methods ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var methods []shipping.Method
+	for rows.Next() {
+		m, err := scanShippingMethod(rows)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, m)
+	}
+	return methods, rows.Err()
+}
+
+// GetShippingMethod returns nil if there is no such method.
+func (s *Store) GetShippingMethod(id int) (*shipping.Method, error) {
+	m, err := scanShippingMethod(s.DB.QueryRow(`SELECT `+shippingMethodColumns+` FROM shipping_methods WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (s *Store) CreateShippingMethod(m *shipping.Method) error {
+	query := `
+		INSERT INTO shipping_methods (zone_id, name, kind, base_fee, per_kg, max_weight_grams, free_over, active)
+		VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := s.DB.Exec(query, m.ZoneID, m.Name, m.Kind, m.BaseFee, m.PerKg, m.MaxWeightGrams, m.FreeOver, m.Active)
+	return err
+}
+
+func (s *Store) UpdateShippingMethod(m *shipping.Method) error {
+	query := `
+		UPDATE shipping_methods
+		SET zone_id = NULLIF(?, 0), name = ?, kind = ?, base_fee = ?, per_kg = ?, max_weight_grams = ?, free_over = ?, active = ?
+		WHERE id = ?
+	`
+	_, err := s.DB.Exec(query, m.ZoneID, m.Name, m.Kind, m.BaseFee, m.PerKg, m.MaxWeightGrams, m.FreeOver, m.Active, m.ID)
+	return err
+}
+
+func (s *Store) DeleteShippingMethod(id int) error {
+	_, err := s.DB.Exec(`DELETE FROM shipping_methods WHERE id = ?`, id)
+	return err
+}
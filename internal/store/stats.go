@@ -1,12 +1,37 @@
 package store
 
-import "database/sql"
+import (
+	"database/sql"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/models"
+)
 
 type DashboardStats struct {
 	TotalItems       int
 	TotalOrders      int
 	OrdersByStatus   map[string]int
 	ItemOrderCounts  []ItemOrderCount
+	Cancellations    []CancellationCount
+	RefundCount      int
+	RefundTotal      float64
+}
+
+// CancellationCount is how many orders were cancelled for a reason, and by
+// whom. Orders cancelled before reasons were recorded have Reason "" and
+// count towards neither customers nor admins.
+type CancellationCount struct {
+	Reason     string
+	Count      int
+	ByCustomer int
+	ByAdmin    int
+}
+
+// ReasonLabel names the reason for display.
+func (c CancellationCount) ReasonLabel() string {
+	if c.Reason == "" {
+		return "Not recorded"
+	}
+	return models.CancelReasonLabel(c.Reason)
 }
 
 type ItemOrderCount struct {
@@ -67,5 +92,34 @@ func (s *Store) GetDashboardStats() (*DashboardStats, error) {
 		stats.ItemOrderCounts = append(stats.ItemOrderCounts, ioc)
 	}
 
+	// 5. Cancellations by reason
+	cancelRows, err := s.DB.Query(`
+		SELECT COALESCE(c.reason, ''), COUNT(*),
+			SUM(CASE WHEN c.cancelled_by = 'customer' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN c.cancelled_by = 'admin' THEN 1 ELSE 0 END)
+		FROM orders o
+		LEFT JOIN order_cancellations c ON c.order_id = o.id
+		WHERE o.status = 'Cancelled'
+		GROUP BY 1
+		ORDER BY 2 DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer cancelRows.Close()
+	for cancelRows.Next() {
+		var cc CancellationCount
+		if err := cancelRows.Scan(&cc.Reason, &cc.Count, &cc.ByCustomer, &cc.ByAdmin); err != nil {
+			return nil, err
+		}
+		stats.Cancellations = append(stats.Cancellations, cc)
+	}
+
+	// 6. Refunds
+	err = s.DB.QueryRow("SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM refunds").Scan(&stats.RefundCount, &stats.RefundTotal)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
 	return stats, nil
 }
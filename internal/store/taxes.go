@@ -0,0 +1,147 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/tax"
+)
+
+// TaxTable loads every tax rate, for working out tax with settings.
+func (s *Store) TaxTable(settings tax.Settings) (tax.Table, error) {
+	rates, err := s.ListTaxRates()
+	if err != nil {
+		return tax.Table{}, err
+	}
+	return tax.Table{Settings: settings, Rates: rates}, nil
+}
+
+const taxRateColumns = `id, name, country, region, tax_class, percent`
+
+func scanTaxRate(row interface{ Scan(...any) error }) (tax.Rate, error) {
+	var r tax.Rate
+	err := row.Scan(&r.ID, &r.Name, &r.Country, &r.Region, &r.Class, &r.Percent)
+	return r, err
+}
+
+func (s *Store) ListTaxRates() ([]tax.Rate, error) {
+	rows, err := s.DB.Query(`SELECT ` + taxRateColumns + ` FROM tax_rates ORDER BY country, region, tax_class, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []tax.Rate
+	for rows.Next() {
+		r, err := scanTaxRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// GetTaxRate returns nil if there is no such rate.
+func (s *Store) GetTaxRate(id int) (*tax.Rate, error) {
+	r, err := scanTaxRate(s.DB.QueryRow(`SELECT `+taxRateColumns+` FROM tax_rates WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) CreateTaxRate(r *tax.Rate) error {
+	query := `INSERT INTO tax_rates (name, country, region, tax_class, percent) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.DB.Exec(query, r.Name, r.Country, r.Region, r.Class, r.Percent)
+	return err
+}
+
+// UpdateTaxRate changes a rate. Orders already placed keep the tax they
+// were charged.
+func (s *Store) UpdateTaxRate(r *tax.Rate) error {
+	query := `UPDATE tax_rates SET name = ?, country = ?, region = ?, tax_class = ?, percent = ? WHERE id = ?`
+	_, err := s.DB.Exec(query, r.Name, r.Country, r.Region, r.Class, r.Percent, r.ID)
+	return err
+}
+
+func (s *Store) DeleteTaxRate(id int) error {
+	_, err := s.DB.Exec(`DELETE FROM tax_rates WHERE id = ?`, id)
+	return err
+}
+
+// insertOrderTaxes records the tax lines of an order.
+func insertOrderTaxes(tx *sql.Tx, orderID int, lines []tax.Line) error {
+	for _, l := range lines {
+		query := `INSERT INTO order_taxes (order_id, line, name, percent, taxable, amount) VALUES (?, ?, ?, ?, ?, ?)`
+		if _, err := tx.Exec(query, orderID, l.Line, l.Name, l.Percent, l.Taxable, l.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListOrderTaxes returns the tax charged on each line of an order.
+func (s *Store) ListOrderTaxes(orderID int) ([]tax.Line, error) {
+	rows, err := s.DB.Query(`SELECT line, name, percent, taxable, amount FROM order_taxes WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []tax.Line
+	for rows.Next() {
+		var l tax.Line
+		if err := rows.Scan(&l.Line, &l.Name, &l.Percent, &l.Taxable, &l.Amount); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
+
+// TaxSummary is the tax charged at one rate over a period.
+type TaxSummary struct {
+	Name    string
+	Percent float64
+	Orders  int
+	Taxable float64
+	Amount  float64
+}
+
+// Label names the rate for display, e.g. "VAT 20%".
+func (t TaxSummary) Label() string {
+	return tax.Line{Name: t.Name, Percent: t.Percent}.Label()
+}
+
+// TaxReport adds up the tax charged per rate on orders placed from the
+// start of day from to the end of day to (UTC). Cancelled orders are left
+// out.
+func (s *Store) TaxReport(from, to time.Time) ([]TaxSummary, error) {
+	query := `
+		SELECT t.name, t.percent, COUNT(DISTINCT t.order_id), ROUND(SUM(t.taxable), 2), ROUND(SUM(t.amount), 2)
+		FROM order_taxes t
+		JOIN orders o ON o.id = t.order_id
+		WHERE o.status != 'Cancelled' AND o.created_at >= ? AND o.created_at < ?
+		GROUP BY t.name, t.percent
+		ORDER BY t.name, t.percent
+	`
+	rows, err := s.DB.Query(query, from.Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var report []TaxSummary
+	for rows.Next() {
+		var t TaxSummary
+		if err := rows.Scan(&t.Name, &t.Percent, &t.Orders, &t.Taxable, &t.Amount); err != nil {
+			return nil, err
+		}
+		report = append(report, t)
+	}
+	return report, rows.Err()
+}
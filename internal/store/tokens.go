@@ -0,0 +1,37 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashToken is what the database stores in place of a bearer token (session
+// IDs, order links, sign-in links), so a copy of the database can't be used
+// to get in.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PurgeExpiredTokens deletes expired sign-in, invite and reset tokens, login
+// attempts older than 30 days and form submissions older than a week,
+// returning the number of rows removed.
+func (s *Store) PurgeExpiredTokens() (int64, error) {
+	queries := []string{
+		`DELETE FROM login_tokens WHERE expires_at <= datetime('now')`,
+		`DELETE FROM user_tokens WHERE expires_at <= datetime('now')`,
+		`DELETE FROM login_attempts WHERE created_at <= datetime('now', '-30 days')`,
+		`DELETE FROM form_submissions WHERE created_at <= datetime('now', '-7 days')`,
+		`UPDATE orders SET magic_token_hash = NULL WHERE magic_token_hash IS NOT NULL AND magic_token_expiry <= datetime('now')`,
+	}
+	var total int64
+	for _, query := range queries {
+		res, err := s.DB.Exec(query)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
@@ -2,27 +2,120 @@ package store
 
 import (
 	"database/sql"
+	"fmt"
+	"time"
 
 	"github.com/alextreichler/crochetbyjuliette/internal/models"
 )
 
-func (s *Store) GetUserByUsername(username string) (*models.User, error) {
-	query := `SELECT id, username, password FROM users WHERE username = ?`
-	row := s.DB.QueryRow(query, username)
+const userColumns = `id, username, password, COALESCE(email, ''), COALESCE(role, 'owner'), COALESCE(active, 1),
+	COALESCE(totp_secret, ''), COALESCE(totp_enabled, 0), COALESCE(totp_last_step, 0)`
 
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
 	var user models.User
-	if err := row.Scan(&user.ID, &user.Username, &user.Password); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
+	if err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Email, &user.Role, &user.Active,
+		&user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep); err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+func (s *Store) GetUserByUsername(username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+	user, err := scanUser(s.DB.QueryRow(query, username))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return user, err
+}
+
+// GetUserByEmail matches case-insensitively and returns nil, nil when there is no match.
+func (s *Store) GetUserByEmail(email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email != '' AND LOWER(email) = LOWER(?)`
+	user, err := scanUser(s.DB.QueryRow(query, email))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return user, err
+}
+
+// GetUserByID returns nil, nil when no user has the given ID.
+func (s *Store) GetUserByID(id int) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	user, err := scanUser(s.DB.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (s *Store) ListUsers() ([]models.User, error) {
+	rows, err := s.DB.Query(`SELECT ` + userColumns + ` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
 // CreateUser is mainly for seeding the initial admin
-func (s *Store) CreateUser(username, hashedPassword string) error {
-	query := `INSERT INTO users (username, password) VALUES (?, ?)`
-	_, err := s.DB.Exec(query, username, hashedPassword)
+func (s *Store) CreateUser(username, hashedPassword, role string) error {
+	query := `INSERT INTO users (username, password, role, active) VALUES (?, ?, ?, 1)`
+	_, err := s.DB.Exec(query, username, hashedPassword, role)
+	return err
+}
+
+// CreateInvitedUser adds a user without a password. They cannot log in until
+// they accept their invite and choose one.
+func (s *Store) CreateInvitedUser(username, email, role string) (int, error) {
+	query := `INSERT INTO users (username, password, email, role, active) VALUES (?, '', ?, ?, 1)`
+	res, err := s.DB.Exec(query, username, email, role)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *Store) UpdateUser(user *models.User) error {
+	query := `UPDATE users SET email = ?, role = ?, active = ? WHERE id = ?`
+	_, err := s.DB.Exec(query, user.Email, user.Role, user.Active, user.ID)
+	return err
+}
+
+func (s *Store) UpdateUserPassword(id int, hashedPassword string) error {
+	query := `UPDATE users SET password = ? WHERE id = ?`
+	_, err := s.DB.Exec(query, hashedPassword, id)
+	return err
+}
+
+// User Tokens (invites and password resets). Only their hashes are stored.
+
+func (s *Store) CreateUserToken(token string, userID int, purpose string, validFor time.Duration) error {
+	query := `INSERT INTO user_tokens (token, user_id, purpose, expires_at) VALUES (?, ?, ?, datetime('now', ?))`
+	_, err := s.DB.Exec(query, HashToken(token), userID, purpose, fmt.Sprintf("+%d seconds", int(validFor.Seconds())))
+	return err
+}
+
+// GetUserIDByToken returns the user a token belongs to, if it has not expired.
+func (s *Store) GetUserIDByToken(token, purpose string) (int, error) {
+	var userID int
+	query := `SELECT user_id FROM user_tokens WHERE token = ? AND purpose = ? AND expires_at > datetime('now')`
+	err := s.DB.QueryRow(query, HashToken(token), purpose).Scan(&userID)
+	return userID, err
+}
+
+// DeleteUserTokens removes every token of the given purpose for a user.
+func (s *Store) DeleteUserTokens(userID int, purpose string) error {
+	_, err := s.DB.Exec(`DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?`, userID, purpose)
 	return err
 }
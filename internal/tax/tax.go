@@ -0,0 +1,195 @@
+// Package tax works out the sales tax or VAT on an order from the shop's
+// tax rates.
+package tax
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alextreichler/crochetbyjuliette/internal/address"
+)
+
+// Tax classes. Items have one of Classes; delivery charges are taxed at
+// the ClassShipping rates.
+const (
+	ClassStandard = "standard"
+	ClassReduced  = "reduced"
+	ClassZero     = "zero" // Never taxed
+	ClassShipping = "shipping"
+)
+
+// Classes lists the item tax classes in display order.
+var Classes = []string{ClassStandard, ClassReduced, ClassZero}
+
+// RateClasses lists the classes rates can be set for.
+var RateClasses = []string{ClassStandard, ClassReduced, ClassShipping}
+
+// ClassLabel returns a human readable name for a tax class.
+func ClassLabel(class string) string {
+	switch class {
+	case ClassStandard:
+		return "Standard"
+	case ClassReduced:
+		return "Reduced"
+	case ClassZero:
+		return "Zero-rated / exempt"
+	case ClassShipping:
+		return "Delivery charges"
+	}
+	return class
+}
+
+// Order lines that are taxed.
+const (
+	LineItem     = "item"
+	LineShipping = "shipping"
+)
+
+// Rate is a tax charged on one class of goods in a country, or in one
+// region of it. All the rates that match an order apply, so a national
+// and a regional tax can both be charged.
+type Rate struct {
+	ID      int     `json:"id"`
+	Name    string  `json:"name"`    // Shown to customers, e.g. "VAT"
+	Country string  `json:"country"` // ISO 3166-1 alpha-2
+	Region  string  `json:"region"`  // Region code; "" for the whole country
+	Class   string  `json:"class"`
+	Percent float64 `json:"percent"`
+}
+
+// Applies reports whether the rate is charged on class in country and
+// region.
+func (r Rate) Applies(class, country, region string) bool {
+	return r.Class == class && r.Country == country && (r.Region == "" || strings.EqualFold(r.Region, region))
+}
+
+// Validate returns a message per invalid field, keyed by "name", "country",
+// "region", "class" or "percent"; an empty map means the rate is valid.
+func (r Rate) Validate() map[string]string {
+	errors := make(map[string]string)
+	if strings.TrimSpace(r.Name) == "" {
+		errors["name"] = "Name is required, e.g. VAT or Sales tax."
+	}
+	if c, ok := address.Lookup(r.Country); !ok {
+		errors["country"] = "Choose a country."
+	} else if r.Region != "" && c.Regions != nil {
+		if _, ok := c.Regions[r.Region]; !ok {
+			errors["region"] = "Unknown " + strings.ToLower(c.RegionLabel) + " code: " + r.Region + "."
+		}
+	}
+	if !slices.Contains(RateClasses, r.Class) {
+		errors["class"] = "Invalid tax class."
+	}
+	if !(r.Percent > 0) || r.Percent > 100 {
+		errors["percent"] = "Rate must be a percentage above 0 and up to 100."
+	}
+	return errors
+}
+
+// Line is the tax charged at one rate on one line of an order.
+type Line struct {
+	Line    string  `json:"line"` // LineItem or LineShipping
+	Name    string  `json:"name"`
+	Percent float64 `json:"percent"`
+	Taxable float64 `json:"taxable"` // The amount taxed, before tax
+	Amount  float64 `json:"amount"`
+}
+
+// Settings are how the shop charges tax.
+type Settings struct {
+	// Inclusive means prices already include tax, which is then worked out
+	// of them; otherwise tax is added on top.
+	Inclusive bool
+	// Where the shop is. Orders with no shipping address are taxed here.
+	Country string
+	Region  string
+}
+
+// Table is the shop's tax configuration.
+type Table struct {
+	Settings
+	Rates []Rate
+}
+
+// Apply works out the tax on amount, charged for line of an order with the
+// given class, delivered to country and region. Pass an empty country for
+// orders that aren't shipped. It returns nothing if no rates apply.
+func (t Table) Apply(line, class string, amount float64, country, region string) []Line {
+	if country == "" {
+		country, region = t.Country, t.Region
+	}
+	var rates []Rate
+	total := 0.0
+	for _, r := range t.Rates {
+		if class != ClassZero && r.Applies(class, country, region) {
+			rates = append(rates, r)
+			total += r.Percent
+		}
+	}
+	if len(rates) == 0 || amount <= 0 {
+		return nil
+	}
+
+	taxable := amount
+	if t.Inclusive {
+		taxable = amount / (1 + total/100)
+	}
+	lines := make([]Line, len(rates))
+	for i, r := range rates {
+		lines[i] = Line{
+			Line:    line,
+			Name:    r.Name,
+			Percent: r.Percent,
+			Taxable: round(taxable),
+			Amount:  round(taxable * r.Percent / 100),
+		}
+	}
+	return lines
+}
+
+// Total adds up the tax on lines.
+func Total(lines []Line) float64 {
+	total := 0.0
+	for _, l := range lines {
+		total += l.Amount
+	}
+	return round(total)
+}
+
+// Summarize combines lines charged at the same rate, keeping the order in
+// which rates first appear. The result's Line fields are empty.
+func Summarize(lines []Line) []Line {
+	var summary []Line
+	for _, l := range lines {
+		found := false
+		for i := range summary {
+			if summary[i].Name == l.Name && summary[i].Percent == l.Percent {
+				summary[i].Taxable = round(summary[i].Taxable + l.Taxable)
+				summary[i].Amount = round(summary[i].Amount + l.Amount)
+				found = true
+				break
+			}
+		}
+		if !found {
+			summary = append(summary, Line{Name: l.Name, Percent: l.Percent, Taxable: l.Taxable, Amount: l.Amount})
+		}
+	}
+	return summary
+}
+
+// Label names a rate for display, e.g. "VAT 20%".
+func (l Line) Label() string {
+	return l.Name + " " + FormatPercent(l.Percent)
+}
+
+// FormatPercent formats a rate without needless decimals, e.g. "8.25%".
+func FormatPercent(percent float64) string {
+	s := strings.TrimRight(strings.TrimRight(strconv.FormatFloat(percent, 'f', 3, 64), "0"), ".")
+	return s + "%"
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
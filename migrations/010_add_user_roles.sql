@@ -0,0 +1,5 @@
+-- Migration: 010_add_user_roles.sql
+-- Existing accounts were full admins, so they become owners.
+ALTER TABLE users ADD COLUMN role TEXT DEFAULT 'owner'; -- 'owner', 'staff' or 'read_only'
+ALTER TABLE users ADD COLUMN active INTEGER DEFAULT 1;
+ALTER TABLE users ADD COLUMN email TEXT DEFAULT '';
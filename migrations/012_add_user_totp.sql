@@ -0,0 +1,4 @@
+-- Migration: 012_add_user_totp.sql
+ALTER TABLE users ADD COLUMN totp_secret TEXT DEFAULT ''; -- base32, set during enrollment
+ALTER TABLE users ADD COLUMN totp_enabled INTEGER DEFAULT 0;
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER DEFAULT 0; -- last accepted time step, prevents code replay
@@ -0,0 +1,11 @@
+-- Migration: 014_create_login_attempts.sql
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    success INTEGER NOT NULL DEFAULT 0,
+    reason TEXT DEFAULT '', -- why a failed attempt failed, e.g. 'bad_password', 'bad_2fa_code', 'throttled'
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip, created_at);
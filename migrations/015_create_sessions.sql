@@ -0,0 +1,14 @@
+-- Migration: 015_create_sessions.sql
+CREATE TABLE IF NOT EXISTS sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the session ID carried in the cookie
+    name TEXT NOT NULL, -- cookie name, e.g. 'admin-session'
+    data BLOB,
+    user_id INTEGER, -- set while an admin is logged in
+    ip TEXT DEFAULT '',
+    user_agent TEXT DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
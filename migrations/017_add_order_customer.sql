@@ -0,0 +1,3 @@
+-- Migration: 017_add_order_customer.sql
+ALTER TABLE orders ADD COLUMN customer_id INTEGER REFERENCES customers(id);
+CREATE INDEX IF NOT EXISTS idx_orders_customer ON orders(customer_id);
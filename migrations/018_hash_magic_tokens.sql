@@ -0,0 +1,4 @@
+-- Migration: 018_hash_magic_tokens.sql
+-- Order links are now stored as SHA-256 hashes. Existing plaintext tokens are
+-- hashed by the server at startup (see Store.HashLegacyOrderTokens).
+ALTER TABLE orders ADD COLUMN magic_token_hash TEXT;
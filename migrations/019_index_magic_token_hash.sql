@@ -0,0 +1,5 @@
+-- Migration: 019_index_magic_token_hash.sql
+CREATE INDEX IF NOT EXISTS idx_orders_magic_token_hash ON orders(magic_token_hash);
+-- login_tokens.token now holds a hash too. Outstanding plaintext sign-in
+-- links expire within the hour anyway, so they are simply dropped.
+DELETE FROM login_tokens;
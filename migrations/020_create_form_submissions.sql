@@ -0,0 +1,10 @@
+-- Migration: 020_create_form_submissions.sql
+-- Submissions of the public order and sign-in link forms, for per-email caps.
+CREATE TABLE IF NOT EXISTS form_submissions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    form TEXT NOT NULL, -- 'order' or 'status'
+    email TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_form_submissions_email ON form_submissions(form, email, created_at);
@@ -0,0 +1,4 @@
+-- Migration: 021_add_order_email_key.sql
+-- Case-folded, normalized customer_email for lookups (see internal/emailaddr).
+-- Existing rows are filled in by the server on start.
+ALTER TABLE orders ADD COLUMN customer_email_key TEXT;
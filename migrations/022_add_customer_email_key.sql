@@ -0,0 +1,2 @@
+-- Migration: 022_add_customer_email_key.sql
+ALTER TABLE customers ADD COLUMN email_key TEXT;
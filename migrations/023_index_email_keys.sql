@@ -0,0 +1,3 @@
+-- Migration: 023_index_email_keys.sql
+CREATE INDEX IF NOT EXISTS idx_orders_email_key ON orders(customer_email_key);
+CREATE INDEX IF NOT EXISTS idx_customers_email_key ON customers(email_key);
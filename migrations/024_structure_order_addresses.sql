@@ -0,0 +1,11 @@
+-- Migration: 024_structure_order_addresses.sql
+-- Existing free-text addresses are kept in address_legacy for display; new
+-- orders fill in the structured ship_* columns instead.
+ALTER TABLE orders RENAME COLUMN customer_address TO address_legacy;
+ALTER TABLE orders ADD COLUMN ship_name TEXT DEFAULT '';
+ALTER TABLE orders ADD COLUMN ship_line1 TEXT DEFAULT '';
+ALTER TABLE orders ADD COLUMN ship_line2 TEXT DEFAULT '';
+ALTER TABLE orders ADD COLUMN ship_city TEXT DEFAULT '';
+ALTER TABLE orders ADD COLUMN ship_region TEXT DEFAULT '';
+ALTER TABLE orders ADD COLUMN ship_postal_code TEXT DEFAULT '';
+ALTER TABLE orders ADD COLUMN ship_country TEXT DEFAULT ''; -- ISO 3166-1 alpha-2
@@ -0,0 +1,9 @@
+-- Migration: 025_structure_customer_addresses.sql
+ALTER TABLE customer_addresses RENAME COLUMN address TO address_legacy;
+ALTER TABLE customer_addresses ADD COLUMN name TEXT DEFAULT '';
+ALTER TABLE customer_addresses ADD COLUMN line1 TEXT DEFAULT '';
+ALTER TABLE customer_addresses ADD COLUMN line2 TEXT DEFAULT '';
+ALTER TABLE customer_addresses ADD COLUMN city TEXT DEFAULT '';
+ALTER TABLE customer_addresses ADD COLUMN region TEXT DEFAULT '';
+ALTER TABLE customer_addresses ADD COLUMN postal_code TEXT DEFAULT '';
+ALTER TABLE customer_addresses ADD COLUMN country TEXT DEFAULT '';
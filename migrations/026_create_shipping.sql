@@ -0,0 +1,25 @@
+-- Migration: 026_create_shipping.sql
+-- Shipping zones group countries; each zone has its own methods. A zone with
+-- no countries covers the rest of the world. Pickup methods have no zone.
+CREATE TABLE IF NOT EXISTS shipping_zones (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    countries TEXT NOT NULL DEFAULT '' -- Comma-separated ISO 3166-1 alpha-2 codes
+);
+CREATE TABLE IF NOT EXISTS shipping_methods (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    zone_id INTEGER, -- NULL for pickup methods
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL, -- 'flat', 'weight' or 'pickup'
+    base_fee REAL NOT NULL DEFAULT 0,
+    per_kg REAL NOT NULL DEFAULT 0,
+    max_weight_grams INTEGER NOT NULL DEFAULT 0, -- 0 for no limit
+    free_over REAL NOT NULL DEFAULT 0, -- 0 to never waive the fee
+    active INTEGER NOT NULL DEFAULT 1,
+    FOREIGN KEY(zone_id) REFERENCES shipping_zones(id)
+);
+
+-- Start with the two options the order form always had, both free
+INSERT INTO shipping_zones (name, countries) VALUES ('Everywhere', '');
+INSERT INTO shipping_methods (zone_id, name, kind) VALUES (last_insert_rowid(), 'Shipping', 'flat');
+INSERT INTO shipping_methods (zone_id, name, kind) VALUES (NULL, 'Hand Delivered', 'pickup');
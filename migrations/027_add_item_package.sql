@@ -0,0 +1,6 @@
+-- Migration: 027_add_item_package.sql
+-- Packed weight and size of one item, for weight-based shipping rates.
+ALTER TABLE items ADD COLUMN weight_grams INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE items ADD COLUMN length_cm REAL NOT NULL DEFAULT 0;
+ALTER TABLE items ADD COLUMN width_cm REAL NOT NULL DEFAULT 0;
+ALTER TABLE items ADD COLUMN height_cm REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- Migration: 028_add_order_shipping.sql
+-- The method chosen at checkout. Its name and fee are copied so later rate
+-- changes don't alter existing orders.
+ALTER TABLE orders ADD COLUMN shipping_method_id INTEGER;
+ALTER TABLE orders ADD COLUMN shipping_method TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN shipping_fee REAL NOT NULL DEFAULT 0;
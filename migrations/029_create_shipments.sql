@@ -0,0 +1,14 @@
+-- Migration: 029_create_shipments.sql
+-- Parcels sent for an order. Label PDFs are stored outside static/ and only
+-- served to admins.
+CREATE TABLE IF NOT EXISTS shipments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL,
+    carrier TEXT NOT NULL, -- e.g. 'usps', 'royal_mail' or 'other'
+    tracking_number TEXT NOT NULL,
+    shipped_at DATETIME NOT NULL,
+    label_file TEXT NOT NULL DEFAULT '', -- File name in the labels directory
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(order_id) REFERENCES orders(id)
+);
+CREATE INDEX IF NOT EXISTS idx_shipments_order ON shipments(order_id);
@@ -0,0 +1,18 @@
+-- Migration: 030_create_payments.sql
+-- Online payments. Each checkout started for an order gets a record, which
+-- the provider's webhooks move from pending to paid, failed or refunded.
+CREATE TABLE IF NOT EXISTS payments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL,
+    provider TEXT NOT NULL, -- e.g. 'stripe'
+    checkout_id TEXT NOT NULL DEFAULT '', -- Provider's checkout session
+    reference TEXT NOT NULL DEFAULT '', -- Provider's payment ID, once paid
+    amount REAL NOT NULL,
+    currency TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'paid', 'refunded' or 'failed'
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(order_id) REFERENCES orders(id)
+);
+CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(order_id);
+CREATE INDEX IF NOT EXISTS idx_payments_checkout ON payments(provider, checkout_id);
@@ -0,0 +1,11 @@
+-- Migration: 031_add_order_balances.sql
+-- Orders keep the item price they were placed at, so their total (and what
+-- is still owed) doesn't change when the item's price does.
+ALTER TABLE orders ADD COLUMN unit_price REAL NOT NULL DEFAULT 0;
+UPDATE orders SET unit_price = COALESCE((SELECT price FROM items WHERE items.id = orders.item_id), 0);
+
+-- Payments can also be recorded by hand (provider 'manual'), e.g. cash or a
+-- bank transfer, for part or all of the order total.
+ALTER TABLE payments ADD COLUMN method TEXT NOT NULL DEFAULT 'online'; -- 'online', 'in_person', 'bank_transfer' or 'paypal'
+ALTER TABLE payments ADD COLUMN paid_at DATETIME;
+UPDATE payments SET paid_at = updated_at WHERE status = 'paid';
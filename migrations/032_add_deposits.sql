@@ -0,0 +1,8 @@
+-- Migration: 032_add_deposits.sql
+-- Made-to-order items can ask for a deposit before work starts: a
+-- percentage of the price, or a fixed amount per item.
+ALTER TABLE items ADD COLUMN deposit_type TEXT NOT NULL DEFAULT ''; -- '', 'percent' or 'fixed'
+ALTER TABLE items ADD COLUMN deposit_value REAL NOT NULL DEFAULT 0;
+
+-- The deposit owed on an order, worked out when it was placed
+ALTER TABLE orders ADD COLUMN deposit REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,38 @@
+-- Migration: 033_add_cancellations_and_refunds.sql
+-- Why an order was cancelled, and by whom. One row per cancelled order.
+CREATE TABLE IF NOT EXISTS order_cancellations (
+    order_id INTEGER PRIMARY KEY,
+    reason TEXT NOT NULL, -- Code from models.CancelReasons
+    note TEXT NOT NULL DEFAULT '',
+    cancelled_by TEXT NOT NULL, -- 'customer' or 'admin'
+    user_id INTEGER, -- The admin who cancelled, if one did
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(order_id) REFERENCES orders(id)
+);
+
+-- Money given back to customers. Refunds of online payments are recorded
+-- from the provider's webhooks; others are entered by hand.
+CREATE TABLE IF NOT EXISTS refunds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL,
+    payment_id INTEGER, -- The refunded online payment, if any
+    method TEXT NOT NULL, -- 'online', 'in_person', 'bank_transfer' or 'paypal'
+    amount REAL NOT NULL,
+    reference TEXT NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(order_id) REFERENCES orders(id),
+    FOREIGN KEY(payment_id) REFERENCES payments(id)
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_order ON refunds(order_id);
+
+-- Payments already refunded through the provider
+INSERT INTO refunds (order_id, payment_id, method, amount, reference, created_at)
+SELECT order_id, id, method, amount, reference, updated_at FROM payments WHERE status = 'refunded';
+
+-- Optional stock counts. Items that don't track stock are made to order.
+ALTER TABLE items ADD COLUMN track_stock INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE items ADD COLUMN stock INTEGER NOT NULL DEFAULT 0;
+
+-- How many of the item the order took from stock, returned if it is cancelled
+ALTER TABLE orders ADD COLUMN stock_reserved INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+-- Migration: 034_create_invoices.sql
+-- Invoice numbers, assigned in sequence the first time an order's invoice
+-- is issued so each order keeps the same number.
+CREATE TABLE IF NOT EXISTS invoices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL UNIQUE,
+    number INTEGER NOT NULL UNIQUE,
+    issued_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(order_id) REFERENCES orders(id)
+);
@@ -0,0 +1,31 @@
+-- Migration: 035_add_taxes.sql
+-- Tax rates by country, optionally narrowed to a region, for each tax class.
+-- Every rate matching an order applies.
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL, -- Shown to customers, e.g. 'VAT'
+    country TEXT NOT NULL, -- ISO 3166-1 alpha-2
+    region TEXT NOT NULL DEFAULT '', -- Region code; '' for the whole country
+    tax_class TEXT NOT NULL, -- 'standard', 'reduced' or 'shipping'
+    percent REAL NOT NULL
+);
+
+ALTER TABLE items ADD COLUMN tax_class TEXT NOT NULL DEFAULT 'standard'; -- 'standard', 'reduced' or 'zero'
+
+-- The tax on an order, worked out when it was placed. With tax_inclusive
+-- the prices already included it; otherwise it was added to the total.
+ALTER TABLE orders ADD COLUMN tax REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN tax_inclusive INTEGER NOT NULL DEFAULT 0;
+
+-- The tax charged at each rate on each line of an order
+CREATE TABLE IF NOT EXISTS order_taxes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL,
+    line TEXT NOT NULL, -- 'item' or 'shipping'
+    name TEXT NOT NULL,
+    percent REAL NOT NULL,
+    taxable REAL NOT NULL, -- Amount taxed, before tax
+    amount REAL NOT NULL,
+    FOREIGN KEY(order_id) REFERENCES orders(id)
+);
+CREATE INDEX IF NOT EXISTS idx_order_taxes_order ON order_taxes(order_id);
@@ -0,0 +1,22 @@
+-- Migration: 036_create_discount_codes.sql
+-- Discount codes customers can enter when ordering
+CREATE TABLE IF NOT EXISTS discount_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE, -- Upper case
+    kind TEXT NOT NULL, -- 'percent' or 'fixed'
+    value REAL NOT NULL,
+    min_order REAL NOT NULL DEFAULT 0, -- Items' price needed to use it
+    expires_at DATETIME, -- NULL if it never expires
+    max_uses INTEGER NOT NULL DEFAULT 0, -- 0 for no limit
+    max_uses_per_email INTEGER NOT NULL DEFAULT 0,
+    item_ids TEXT NOT NULL DEFAULT '', -- Comma separated; '' for every item
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The discount taken off an order's items. discount_code is kept as it was
+-- typed in case the code is later deleted.
+ALTER TABLE orders ADD COLUMN discount_code_id INTEGER REFERENCES discount_codes(id);
+ALTER TABLE orders ADD COLUMN discount_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN discount REAL NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_orders_discount_code ON orders(discount_code_id);
@@ -0,0 +1,8 @@
+-- Migration: 037_create_exchange_rates.sql
+-- Exchange rates for showing customers prices in other currencies. Orders
+-- are still charged in the shop's own currency.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency TEXT PRIMARY KEY, -- ISO 4217, upper case
+    rate REAL NOT NULL, -- Units of currency per unit of the shop's currency
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
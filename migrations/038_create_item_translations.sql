@@ -0,0 +1,11 @@
+-- Migration: 038_create_item_translations.sql
+-- Item titles and descriptions in the languages the shop is offered in.
+-- items keeps them in the default language, which is shown wherever a
+-- translation is missing.
+CREATE TABLE IF NOT EXISTS item_translations (
+    item_id INTEGER NOT NULL REFERENCES items(id),
+    lang TEXT NOT NULL, -- As named in locales/, e.g. 'fr'
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (item_id, lang)
+);
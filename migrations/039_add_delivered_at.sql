@@ -0,0 +1,5 @@
+-- Migration: 039_add_delivered_at.sql
+-- When an order was marked Delivered, for the average fulfilment time on the
+-- dashboard. Orders delivered before this was recorded are left NULL and
+-- don't count towards it.
+ALTER TABLE orders ADD COLUMN delivered_at DATETIME;
@@ -0,0 +1,5 @@
+-- Migration: 040_hash_user_tokens.sql
+-- user_tokens.token now holds a SHA-256 hash, like login_tokens. SQLite can't
+-- hash the outstanding plaintext invite and reset links, so they are dropped
+-- and have to be sent again.
+DELETE FROM user_tokens;
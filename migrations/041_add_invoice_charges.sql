@@ -0,0 +1,5 @@
+-- Migration: 041_add_invoice_charges.sql
+-- What an invoice charged, as JSON, saved when it's numbered so that later
+-- changes to the order don't alter an invoice already issued. Invoices
+-- issued before this have theirs saved the next time they're made out.
+ALTER TABLE invoices ADD COLUMN charges TEXT NOT NULL DEFAULT '';
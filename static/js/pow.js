@@ -0,0 +1,46 @@
+// Solves the proof-of-work challenge on forms that have one (see
+// internal/antispam/pow.go). Work starts as soon as the page loads, so it is
+// usually finished by the time the visitor presses submit.
+(function() {
+    function leadingZeroBits(bytes) {
+        var n = 0;
+        for (var i = 0; i < bytes.length; i++) {
+            if (bytes[i] !== 0) {
+                return n + Math.clz32(bytes[i]) - 24;
+            }
+            n += 8;
+        }
+        return n;
+    }
+
+    async function solve(challenge, difficulty) {
+        var encoder = new TextEncoder();
+        for (var nonce = 0; ; nonce++) {
+            var digest = await crypto.subtle.digest('SHA-256', encoder.encode(challenge + nonce));
+            if (leadingZeroBits(new Uint8Array(digest)) >= difficulty) {
+                return String(nonce);
+            }
+        }
+    }
+
+    document.querySelectorAll('input[name="pow_challenge"]').forEach(function(input) {
+        var form = input.form;
+        var nonceInput = form.querySelector('input[name="pow_nonce"]');
+        var solved = solve(input.value, parseInt(input.dataset.difficulty, 10)).then(function(nonce) {
+            nonceInput.value = nonce;
+        });
+
+        form.addEventListener('submit', function(event) {
+            if (nonceInput.value) {
+                return;
+            }
+            event.preventDefault();
+            var button = form.querySelector('[type="submit"]');
+            if (button) {
+                button.disabled = true;
+                button.textContent = 'Checking...';
+            }
+            solved.then(function() { form.submit(); });
+        });
+    });
+})();